@@ -0,0 +1,223 @@
+package api
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/LahcenHaouch/goserver/internal/database"
+	"github.com/google/uuid"
+)
+
+// HandleDeleteUser deletes the account making the request once its password
+// is confirmed. Chirps and every other table referencing users go with it
+// through ON DELETE CASCADE; refresh_tokens predates that and is cleaned up
+// by hand, and so are uploaded files, which live outside the database.
+func (c *ApiConfig) HandleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	type request struct {
+		Password string `json:"password"`
+	}
+
+	userId, err := c.authenticateSession(r)
+	if err != nil {
+		http.Error(w, "unauthorized", 401)
+		return
+	}
+
+	defer r.Body.Close()
+
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Password == "" {
+		http.Error(w, "error parsing request", 400)
+		return
+	}
+
+	user, err := c.Database.GetUserByID(r.Context(), userId)
+	if err != nil {
+		http.Error(w, "unauthorized", 401)
+		return
+	}
+
+	// a stolen access token must not be enough to guess the password
+	limitKeys := c.passwordLoginKeys(r, user.Email.String)
+	if !c.reserveLoginAttempt(w, r, limitKeys) {
+		return
+	}
+
+	if _, err := c.checkPassword(r, user.Email.String, req.Password, limitKeys); err != nil {
+		http.Error(w, "incorrect password", 403)
+		return
+	}
+
+	tx, err := c.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+	defer tx.Rollback()
+	qtx := c.Database.WithTx(tx)
+
+	if err := qtx.DeleteUserRefreshTokens(r.Context(), uuid.NullUUID{UUID: userId, Valid: true}); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	files, err := qtx.ListUserMediaFiles(r.Context(), userId)
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	if _, err := qtx.DeleteUser(r.Context(), userId); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	for _, f := range files {
+		c.deleteBlobs(r.Context(), f.StorageKey, f.ThumbnailKey)
+	}
+
+	c.audit(r, auditEvent{
+		Actor:      userId,
+		Action:     auditUserDeleted,
+		TargetType: auditTargetUser,
+		TargetID:   userId,
+	})
+
+	w.WriteHeader(204)
+}
+
+type userExport struct {
+	ExportedAt time.Time `json:"exported_at"`
+	User       User      `json:"user"`
+	Chirps     []Chirp   `json:"chirps"`
+	Drafts     []Chirp   `json:"drafts"`
+	Sessions   []Session `json:"sessions"`
+}
+
+// HandleExportUser sends the user everything we keep about them: a single
+// JSON document, or with ?format=zip an archive of one JSON file per kind
+// of data.
+func (c *ApiConfig) HandleExportUser(w http.ResponseWriter, r *http.Request) {
+	claims, err := c.authenticateLogin(r)
+	if err != nil {
+		http.Error(w, "unauthorized", 401)
+		return
+	}
+
+	userId, err := claims.UserID()
+	if err != nil {
+		http.Error(w, "unauthorized", 401)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "zip" {
+		http.Error(w, "format must be json or zip", 400)
+		return
+	}
+
+	user, err := c.Database.GetUserByID(r.Context(), userId)
+	if err != nil {
+		http.Error(w, "unauthorized", 401)
+		return
+	}
+
+	var chirps []database.Chirp
+	page := chirpPage{Author: uuid.NullUUID{UUID: userId, Valid: true}, Limit: maxChirpLimit}
+	for {
+		batch, err := c.listChirps(r.Context(), page)
+		if err != nil {
+			http.Error(w, "internal server error", 500)
+			return
+		}
+		chirps = append(chirps, batch...)
+		if len(batch) < int(page.Limit) {
+			break
+		}
+		cursor := cursorOf(batch[len(batch)-1])
+		page.Cursor = &cursor
+	}
+
+	drafts, err := c.Database.ListUserDrafts(r.Context(), uuid.NullUUID{UUID: userId, Valid: true})
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	sessions, err := c.Database.ListSessions(r.Context(), userId)
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	export := userExport{
+		ExportedAt: time.Now().UTC(),
+		User:       parseDbUser(user),
+		Chirps:     make([]Chirp, 0, len(chirps)),
+		Drafts:     make([]Chirp, 0, len(drafts)),
+		Sessions:   make([]Session, 0, len(sessions)),
+	}
+	export.Chirps = append(export.Chirps, parseDbChirps(chirps)...)
+	export.Drafts = append(export.Drafts, parseDbChirps(drafts)...)
+	for _, chirps := range [][]Chirp{export.Chirps, export.Drafts} {
+		if err := c.loadChirpDetails(r.Context(), chirps, uuid.NullUUID{UUID: userId, Valid: true}); err != nil {
+			http.Error(w, "internal server error", 500)
+			return
+		}
+	}
+	for _, s := range sessions {
+		export.Sessions = append(export.Sessions, parseDbSession(s, claims.Session()))
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	if format != "zip" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="chirpy-export.json"`)
+		if err := json.NewEncoder(w).Encode(export); err != nil {
+			log.Printf("error writing export of user %s: %q", userId, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="chirpy-export.zip"`)
+
+	// the headers are sent by now, so errors can only be logged
+	archive := zip.NewWriter(w)
+	for name, data := range map[string]any{
+		"user.json":     export.User,
+		"chirps.json":   export.Chirps,
+		"drafts.json":   export.Drafts,
+		"sessions.json": export.Sessions,
+	} {
+		f, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: export.ExportedAt,
+		})
+		if err != nil {
+			log.Printf("error writing export of user %s: %q", userId, err)
+			return
+		}
+
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(data); err != nil {
+			log.Printf("error writing export of user %s: %q", userId, err)
+			return
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		log.Printf("error writing export of user %s: %q", userId, err)
+	}
+}
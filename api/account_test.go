@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// audit_events can't be changed, so nothing recorded about an account may
+// hold its email once it is deleted.
+func TestDeletedUserEmailNotInAuditEvents(t *testing.T) {
+	c := testConfig(t)
+	user := createTestUser(t, c, "ann@example.com")
+	tokens := loginTestUser(t, c, user, uuid.NullUUID{}, nil)
+
+	login(c, "ann@example.com", "wrong password")
+	login(c, "nobody@example.com", "wrong password")
+
+	req := httptest.NewRequest(http.MethodPut, "/api/users", strings.NewReader(`{"email":"ann.b@example.com","password":"`+testPassword+`"}`))
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	rec := httptest.NewRecorder()
+	c.HandleUpdateUser(rec, req)
+	if rec.Code != 200 {
+		t.Fatalf("expected 200 changing email, got %d: %s", rec.Code, rec.Body)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/users", strings.NewReader(`{"password":"`+testPassword+`"}`))
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	rec = httptest.NewRecorder()
+	c.HandleDeleteUser(rec, req)
+	if rec.Code != 204 {
+		t.Fatalf("expected 204 deleting the user, got %d: %s", rec.Code, rec.Body)
+	}
+
+	var n int
+	if err := c.DB.QueryRow("SELECT COUNT(*) FROM audit_events WHERE payload::text LIKE '%@example.com%'").Scan(&n); err != nil {
+		t.Fatalf("error counting audit events: %q", err)
+	}
+	if n != 0 {
+		t.Fatalf("expected no audit event to hold an email, got %d", n)
+	}
+}
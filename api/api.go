@@ -1,24 +1,51 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/LahcenHaouch/goserver/internal/auth"
 	"github.com/LahcenHaouch/goserver/internal/database"
+	"github.com/LahcenHaouch/goserver/internal/lockout"
+	"github.com/LahcenHaouch/goserver/internal/mail"
+	"github.com/LahcenHaouch/goserver/internal/media"
 	"github.com/LahcenHaouch/goserver/utils"
 	"github.com/google/uuid"
 )
 
+const (
+	accessTokenTTL  = time.Hour
+	refreshTokenTTL = time.Hour * 24 * 60
+)
+
 type ApiConfig struct {
-	FileServerHits int
-	Database       *database.Queries
-	TokenSecret    string
-	PolkaKey       string
+	FileServerHits       int
+	DB                   *sql.DB
+	Database             *database.Queries
+	Keys                 *auth.KeyRing
+	KeyAlgorithm         string
+	KeyRotation          time.Duration
+	Passwords            *auth.PasswordHasher
+	PasswordPolicy       *auth.PasswordPolicy
+	Mailer               mail.Mailer
+	BaseURL              string
+	RequireVerifiedEmail bool
+	TrustProxy           bool
+	LoginLimiter         *lockout.Limiter
+	PolkaKey             string
+	ChirpEditWindow      time.Duration
+	Media                media.BlobStore
+	// IntrospectionClients are the resource servers allowed to introspect
+	// tokens issued to other clients.
+	IntrospectionClients []uuid.UUID
 }
 
 func (a ApiConfig) HealthzHandler(res http.ResponseWriter, req *http.Request) {
@@ -51,6 +78,86 @@ func (cfg *ApiConfig) ResetHandler(res http.ResponseWriter, req *http.Request) {
 	res.Write([]byte(fmt.Sprintf("Hits: %d", cfg.FileServerHits)))
 }
 
+// authenticate returns the id of the user behind the request's bearer
+// token. Access tokens from login carry every scope; personal access tokens
+// and tokens issued to OAuth clients must have been granted scope.
+func (c *ApiConfig) authenticate(r *http.Request, scope string) (uuid.UUID, error) {
+	tokenStr, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if !auth.IsPersonalAccessToken(tokenStr) {
+		claims, err := c.parseAccessToken(r.Context(), tokenStr)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		if claims.IsClientToken() && !auth.HasScope(claims.Scopes(), scope) {
+			return uuid.Nil, auth.ErrInsufficientScope
+		}
+		return claims.UserID()
+	}
+
+	pat, err := c.Database.GetPersonalAccessTokenByHash(r.Context(), auth.HashToken(tokenStr))
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if pat.RevokedAt.Valid || (pat.ExpiresAt.Valid && time.Now().After(pat.ExpiresAt.Time)) {
+		return uuid.Nil, errors.New("personal access token revoked or expired")
+	}
+
+	if !auth.HasScope(pat.Scopes, scope) {
+		return uuid.Nil, auth.ErrInsufficientScope
+	}
+
+	if err := c.Database.TouchPersonalAccessToken(r.Context(), pat.ID); err != nil {
+		log.Printf("error updating personal access token %s: %q", pat.ID, err)
+	}
+
+	return pat.UserID, nil
+}
+
+// authenticateSession only accepts access tokens from login, for endpoints
+// that manage credentials and must not be reachable with a script's or a
+// third-party app's token.
+func (c *ApiConfig) authenticateSession(r *http.Request) (uuid.UUID, error) {
+	claims, err := c.authenticateLogin(r)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return claims.UserID()
+}
+
+// authenticateLogin returns the claims of the request's bearer token if it
+// is an access token from login.
+func (c *ApiConfig) authenticateLogin(r *http.Request) (*auth.Claims, error) {
+	tokenStr, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := c.parseAccessToken(r.Context(), tokenStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.IsClientToken() {
+		return nil, errClientToken
+	}
+
+	return claims, nil
+}
+
+// authStatus is the status code to answer a failed authenticate with.
+func authStatus(err error) int {
+	if errors.Is(err, auth.ErrInsufficientScope) {
+		return 403
+	}
+	return 401
+}
+
 type CreateUser struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
@@ -61,7 +168,39 @@ type User struct {
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	Email       string    `json:"email"`
+	Handle      string    `json:"handle,omitempty"`
 	IsChirpyRed bool      `json:"is_chirpy_red"`
+	IsVerified  bool      `json:"is_verified"`
+	Role        string    `json:"role"`
+}
+
+// validateCredentials checks an email and password pair against our rules,
+// returning one error per broken rule.
+func (c *ApiConfig) validateCredentials(email, password string) []auth.FieldError {
+	var errs []auth.FieldError
+
+	if !validEmail(email) {
+		errs = append(errs, auth.FieldError{Field: "email", Code: "invalid", Message: "email is not a valid address"})
+	}
+
+	return append(errs, c.PasswordPolicy.Validate(password, email)...)
+}
+
+func respondWithFieldErrors(w http.ResponseWriter, errs []auth.FieldError) {
+	utils.RespondWithJSON(w, map[string][]auth.FieldError{"errors": errs}, 400)
+}
+
+func parseDbUser(user database.User) User {
+	return User{
+		ID:          user.ID,
+		CreatedAt:   user.CreatedAt.Time,
+		UpdatedAt:   user.UpdatedAt.Time,
+		Email:       user.Email.String,
+		Handle:      user.Handle.String,
+		IsChirpyRed: user.IsChirpyRed,
+		IsVerified:  user.VerifiedAt.Valid,
+		Role:        user.Role,
+	}
 }
 
 func (c *ApiConfig) HandleCreateUser(w http.ResponseWriter, r *http.Request) {
@@ -74,7 +213,12 @@ func (c *ApiConfig) HandleCreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(rUser.Password)
+	if errs := c.validateCredentials(rUser.Email, rUser.Password); len(errs) > 0 {
+		respondWithFieldErrors(w, errs)
+		return
+	}
+
+	hashedPassword, err := c.Passwords.Hash(rUser.Password)
 	if err != nil {
 		utils.RespondWithError(w, map[string]string{"error": "Error hashing password"}, 500)
 		return
@@ -86,12 +230,10 @@ func (c *ApiConfig) HandleCreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	newUser := User{
-		ID:          user.ID,
-		CreatedAt:   user.CreatedAt.Time,
-		UpdatedAt:   user.UpdatedAt.Time,
-		Email:       user.Email.String,
-		IsChirpyRed: user.IsChirpyRed,
+	newUser := parseDbUser(user)
+
+	if err := c.sendVerificationEmail(r.Context(), user.ID, user.Email.String); err != nil {
+		log.Printf("error sending verification mail: %q", err)
 	}
 
 	body, err := json.Marshal(newUser)
@@ -105,25 +247,55 @@ func (c *ApiConfig) HandleCreateUser(w http.ResponseWriter, r *http.Request) {
 }
 
 type PostChirp struct {
-	Body string `json:"body"`
+	Body        string      `json:"body"`
+	InReplyToID *uuid.UUID  `json:"in_reply_to_id"`
+	QuoteOfID   *uuid.UUID  `json:"quote_of_id"`
+	MediaIDs    []uuid.UUID `json:"media_ids"`
 }
 
 type Chirp struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserId    uuid.UUID `json:"user_id"`
+	ID          uuid.UUID     `json:"id"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+	Body        string        `json:"body"`
+	UserId      uuid.UUID     `json:"user_id"`
+	InReplyToID *uuid.UUID    `json:"in_reply_to_id"`
+	RechirpOfID *uuid.UUID    `json:"rechirp_of_id"`
+	QuoteOfID   *uuid.UUID    `json:"quote_of_id"`
+	Status      string        `json:"status"`
+	PublishAt   *time.Time    `json:"publish_at,omitempty"`
+	Original    *Chirp        `json:"original,omitempty"`
+	ReplyCount  int64         `json:"reply_count"`
+	LikeCount   int64         `json:"like_count"`
+	LikedByMe   *bool         `json:"liked_by_me,omitempty"`
+	Entities    ChirpEntities `json:"entities"`
+	Media       []Media       `json:"media"`
 }
 
 func parseDbChirp(chirp database.Chirp) Chirp {
-	return Chirp{
+	parsed := Chirp{
 		ID:        chirp.ID,
 		CreatedAt: chirp.CreatedAt.Time,
 		UpdatedAt: chirp.UpdatedAt.Time,
 		Body:      chirp.Body.String,
 		UserId:    chirp.UserID.UUID,
+		Status:    chirp.Status,
+		Entities:  newChirpEntities(),
+		Media:     []Media{},
+	}
+	if chirp.InReplyToID.Valid {
+		parsed.InReplyToID = &chirp.InReplyToID.UUID
+	}
+	if chirp.RechirpOfID.Valid {
+		parsed.RechirpOfID = &chirp.RechirpOfID.UUID
+	}
+	if chirp.QuoteOfID.Valid {
+		parsed.QuoteOfID = &chirp.QuoteOfID.UUID
 	}
+	if chirp.PublishAt.Valid {
+		parsed.PublishAt = &chirp.PublishAt.Time
+	}
+	return parsed
 }
 
 func parseDbChirps(chirps []database.Chirp) []Chirp {
@@ -136,52 +308,127 @@ func parseDbChirps(chirps []database.Chirp) []Chirp {
 	return parsed
 }
 
-func (c *ApiConfig) HandleGetChirps(w http.ResponseWriter, r *http.Request) {
-	authorId := r.URL.Query().Get("author_id")
-	sort := r.URL.Query().Get("sort")
+// loadChirpDetails fills in what Chirp shows beyond the chirps table, as
+// seen by viewer when set. Rechirped and quoted chirps are embedded with
+// their details, but without their own originals.
+func (c *ApiConfig) loadChirpDetails(ctx context.Context, chirps []Chirp, viewer uuid.NullUUID) error {
+	originals, err := c.loadOriginals(ctx, chirps)
+	if err != nil {
+		return err
+	}
+
+	all := append(append(make([]Chirp, 0, len(chirps)+len(originals)), chirps...), originals...)
+	if err := c.loadEntities(ctx, all); err != nil {
+		return err
+	}
+	if err := c.loadReplyCounts(ctx, all); err != nil {
+		return err
+	}
+	if err := c.loadLikes(ctx, all, viewer); err != nil {
+		return err
+	}
+	if err := c.loadMedia(ctx, all); err != nil {
+		return err
+	}
+
+	copy(chirps, all)
+	embedOriginals(chirps, all[len(chirps):])
+	return nil
+}
 
-	var chirps []database.Chirp
+// HandleGetChirps lists chirps a page at a time, oldest first unless
+// sort=desc. The next page is fetched by passing next_cursor back as cursor,
+// or by following the Link header.
+func (c *ApiConfig) HandleGetChirps(w http.ResponseWriter, r *http.Request) {
+	var page chirpPage
 
-	if len(authorId) > 0 {
-		userId, err := uuid.Parse(authorId)
+	if v := r.URL.Query().Get("author_id"); v != "" {
+		userId, err := uuid.Parse(v)
 		if err != nil {
-			http.Error(w, "error parsing author_id", 500)
+			http.Error(w, "invalid author_id", 400)
 			return
 		}
-		if sort == "desc" {
-			chirps, err = c.Database.GetChirpsByAuthorIdDESC(r.Context(), uuid.NullUUID{
-				UUID: userId, Valid: true,
-			})
-		} else {
-			chirps, err = c.Database.GetChirpsByAuthorId(r.Context(), uuid.NullUUID{UUID: userId, Valid: true})
-		}
+		page.Author = uuid.NullUUID{UUID: userId, Valid: true}
+	}
+
+	c.serveChirps(w, r, page)
+}
+
+// serveChirps responds with the page of chirps selected by page and the
+// sort, cursor and limit query parameters.
+func (c *ApiConfig) serveChirps(w http.ResponseWriter, r *http.Request, page chirpPage) {
+	viewer := c.viewer(r)
+
+	query := r.URL.Query()
+	page.Desc = query.Get("sort") == "desc"
+	page.Limit = defaultChirpLimit
+
+	if v := query.Get("cursor"); v != "" {
+		cursor, err := parseChirpCursor(v)
 		if err != nil {
-			utils.RespondWithError(w, map[string]string{"error": "error fetching chirps from database"}, 500)
+			http.Error(w, "invalid cursor", 400)
 			return
 		}
-	} else {
-		var err error
-
-		if sort == "desc" {
-			chirps, err = c.Database.GetChirpsDESC(r.Context())
-		} else {
-			chirps, err = c.Database.GetChirps(r.Context())
-		}
+		page.Cursor = &cursor
+	}
 
-		if err != nil {
-			utils.RespondWithError(w, map[string]string{"error": "error fetching chirps from database"}, 500)
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxChirpLimit {
+			http.Error(w, "invalid limit", 400)
 			return
 		}
+		page.Limit = int32(limit)
 	}
 
-	body, err := json.Marshal(parseDbChirps(chirps))
+	// one more than asked tells us whether there is a next page
+	limit := page.Limit
+	page.Limit++
+
+	chirps, err := c.listChirps(r.Context(), page)
 	if err != nil {
-		utils.RespondWithError(w, map[string]string{"error": "error converting chirps to []byte"}, 500)
+		utils.RespondWithError(w, map[string]string{"error": "error fetching chirps from database"}, 500)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(body)
+	type response struct {
+		Chirps     []Chirp `json:"chirps"`
+		NextCursor *string `json:"next_cursor"`
+	}
+
+	resp := response{Chirps: make([]Chirp, 0, len(chirps))}
+	links := []string{c.chirpsLink(r, "", "first")}
+	if len(chirps) > int(limit) {
+		chirps = chirps[:limit]
+		cursor := cursorOf(chirps[len(chirps)-1]).String()
+		resp.NextCursor = &cursor
+		links = append(links, c.chirpsLink(r, cursor, "next"))
+	}
+	resp.Chirps = append(resp.Chirps, parseDbChirps(chirps)...)
+
+	if err := c.loadChirpDetails(r.Context(), resp.Chirps, viewer); err != nil {
+		utils.RespondWithError(w, map[string]string{"error": "error fetching chirps from database"}, 500)
+		return
+	}
+
+	w.Header().Set("Link", strings.Join(links, ", "))
+	utils.RespondWithJSON(w, resp, 200)
+}
+
+// chirpsLink is an RFC 8288 link to the request's listing starting at
+// cursor, keeping its other query parameters.
+func (c *ApiConfig) chirpsLink(r *http.Request, cursor, rel string) string {
+	query := r.URL.Query()
+	query.Del("cursor")
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+
+	link := c.BaseURL + r.URL.Path
+	if len(query) > 0 {
+		link += "?" + query.Encode()
+	}
+	return fmt.Sprintf("<%s>; rel=%q", link, rel)
 }
 
 func (c *ApiConfig) HandleGetChirp(w http.ResponseWriter, r *http.Request) {
@@ -192,14 +439,20 @@ func (c *ApiConfig) HandleGetChirp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dbChirp, err := c.Database.GetChirp(r.Context(), chirpId)
+	viewer := c.viewer(r)
+
+	dbChirp, err := c.Database.GetPublishedChirp(r.Context(), chirpId)
 	if err != nil {
 		utils.RespondWithError(w, map[string]string{"error": "error fetching chirp"}, 404)
 		return
 	}
-	chirp := parseDbChirp(dbChirp)
+	chirps := []Chirp{parseDbChirp(dbChirp)}
+	if err := c.loadChirpDetails(r.Context(), chirps, viewer); err != nil {
+		utils.RespondWithError(w, map[string]string{"error": "error fetching chirp"}, 500)
+		return
+	}
 
-	body, err := json.Marshal(chirp)
+	body, err := json.Marshal(chirps[0])
 	if err != nil {
 		utils.RespondWithError(w, map[string]string{"error": "error parsing chirp"}, 500)
 		return
@@ -213,17 +466,13 @@ func (c *ApiConfig) HandleCreateChirp(w http.ResponseWriter, r *http.Request) {
 	decoder := json.NewDecoder(r.Body)
 	defer r.Body.Close()
 
-	token, err := auth.GetBearerToken(r.Header)
+	userId, err := c.authenticate(r, auth.ScopeChirpsWrite)
 	if err != nil {
-		http.Error(w, "401 Unauthorized", 401)
-		log.Println("184")
+		http.Error(w, "401 Unauthorized", authStatus(err))
 		return
 	}
 
-	userId, err := auth.ValidateJWT(token, c.TokenSecret)
-	if err != nil {
-		http.Error(w, "401 Unauthorized", 401)
-		log.Println("190")
+	if !c.checkCanPost(w, r, userId) {
 		return
 	}
 
@@ -233,24 +482,21 @@ func (c *ApiConfig) HandleCreateChirp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(chirp.Body) > 140 {
-		utils.RespondWithError(w, map[string]string{"error": "body length > 140"}, 400)
+	if !checkChirpBody(w, chirp.Body, chirp.QuoteOfID != nil) {
 		return
 	}
 
-	newChirp, err := c.Database.CreateChirp(r.Context(), database.CreateChirpParams{Body: sql.NullString{String: utils.RemoveBadWords(chirp.Body), Valid: true}, UserID: uuid.NullUUID{UUID: userId, Valid: true}})
-	if err != nil {
-		utils.RespondWithError(w, map[string]string{"error": "error creating chirp"}, 500)
+	newChirp, ok := c.insertChirp(w, r, userId, chirp, chirpStatusPublished, sql.NullTime{})
+	if !ok {
 		return
 	}
 
-	jsonChirp := Chirp{
-		ID:        newChirp.ID,
-		CreatedAt: newChirp.CreatedAt.Time,
-		UpdatedAt: newChirp.UpdatedAt.Time,
-		Body:      newChirp.Body.String,
-		UserId:    newChirp.UserID.UUID,
+	chirps := []Chirp{parseDbChirp(newChirp)}
+	if err := c.loadChirpDetails(r.Context(), chirps, uuid.NullUUID{UUID: userId, Valid: true}); err != nil {
+		// the chirp exists, so failing now would only make clients post it again
+		log.Printf("error loading details of chirp %s: %q", newChirp.ID, err)
 	}
+	jsonChirp := chirps[0]
 
 	newBody, err := json.Marshal(jsonChirp)
 	if err != nil {
@@ -262,18 +508,87 @@ func (c *ApiConfig) HandleCreateChirp(w http.ResponseWriter, r *http.Request) {
 	w.Write(newBody)
 }
 
+// insertChirp stores a chirp, published or not, with its entities. It
+// answers the request and returns false when it can't.
+func (c *ApiConfig) insertChirp(w http.ResponseWriter, r *http.Request, userId uuid.UUID, chirp PostChirp, status string, publishAt sql.NullTime) (database.Chirp, bool) {
+	if len(chirp.MediaIDs) > maxChirpMedia {
+		utils.RespondWithError(w, map[string]string{"error": "a chirp can have up to 4 media"}, 400)
+		return database.Chirp{}, false
+	}
+
+	tx, err := c.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		utils.RespondWithError(w, map[string]string{"error": "error creating chirp"}, 500)
+		return database.Chirp{}, false
+	}
+	defer tx.Rollback()
+	qtx := c.Database.WithTx(tx)
+
+	// replying to or quoting a rechirp means the chirp it reshares
+	var inReplyTo, quoteOf uuid.NullUUID
+	for _, ref := range []struct {
+		id    *uuid.UUID
+		to    *uuid.NullUUID
+		field string
+	}{
+		{chirp.InReplyToID, &inReplyTo, "in_reply_to_id"},
+		{chirp.QuoteOfID, &quoteOf, "quote_of_id"},
+	} {
+		if ref.id == nil {
+			continue
+		}
+		original, err := resolveRechirp(r.Context(), qtx, *ref.id)
+		if err != nil {
+			utils.RespondWithError(w, map[string]string{"error": ref.field + " is not an existing chirp"}, 400)
+			return database.Chirp{}, false
+		}
+		*ref.to = uuid.NullUUID{UUID: original.ID, Valid: true}
+	}
+
+	newChirp, err := qtx.CreateChirp(r.Context(), database.CreateChirpParams{
+		Body:        sql.NullString{String: utils.RemoveBadWords(chirp.Body), Valid: true},
+		UserID:      uuid.NullUUID{UUID: userId, Valid: true},
+		InReplyToID: inReplyTo,
+		QuoteOfID:   quoteOf,
+		Status:      status,
+		PublishAt:   publishAt,
+	})
+	if err != nil {
+		utils.RespondWithError(w, map[string]string{"error": "error creating chirp"}, 500)
+		return database.Chirp{}, false
+	}
+
+	// entities are parsed from the stored body, so offsets match what
+	// readers get and censored words never become tags
+	if err := saveEntities(r.Context(), qtx, newChirp.ID, newChirp.Body.String); err != nil {
+		utils.RespondWithError(w, map[string]string{"error": "error creating chirp"}, 500)
+		return database.Chirp{}, false
+	}
+
+	err = attachMedia(r.Context(), qtx, userId, newChirp.ID, chirp.MediaIDs)
+	if errors.Is(err, errInvalidMedia) {
+		utils.RespondWithError(w, map[string]string{"error": err.Error()}, 400)
+		return database.Chirp{}, false
+	}
+	if err != nil {
+		utils.RespondWithError(w, map[string]string{"error": "error creating chirp"}, 500)
+		return database.Chirp{}, false
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.RespondWithError(w, map[string]string{"error": "error creating chirp"}, 500)
+		return database.Chirp{}, false
+	}
+
+	return newChirp, true
+}
+
 type Login struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
 
 func (c *ApiConfig) HandleLogin(w http.ResponseWriter, r *http.Request) {
-	type newBody struct {
-		User
-		Token        string `json:"token"`
-		RefreshToken string `json:"refresh_token"`
-	}
-
 	body := r.Body
 	defer r.Body.Close()
 
@@ -283,52 +598,107 @@ func (c *ApiConfig) HandleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := c.Database.GetUser(r.Context(), sql.NullString{String: login.Email, Valid: true})
-	if err != nil {
-		http.Error(w, "Incorrect email or password", 401)
+	limitKeys := c.passwordLoginKeys(r, login.Email)
+	if !c.reserveLoginAttempt(w, r, limitKeys) {
 		return
 	}
 
-	if err = auth.CheckPasswordHash(login.Password, user.HashedPassword); err != nil {
+	user, err := c.checkPassword(r, login.Email, login.Password, limitKeys)
+	if err != nil {
 		http.Error(w, "Incorrect email or password", 401)
 		return
 	}
 
-	token, err := auth.MakeJWT(user.ID, c.TokenSecret, time.Hour)
+	hasTOTP, err := c.hasTOTP(r.Context(), user.ID)
 	if err != nil {
-		http.Error(w, "Error generating jwt token", 500)
+		http.Error(w, "internal server error", 500)
+		return
+	}
+	if hasTOTP {
+		c.respondWithMFAPending(w, user.ID)
 		return
 	}
 
-	u := User{
-		ID:          user.ID,
-		CreatedAt:   user.CreatedAt.Time,
-		UpdatedAt:   user.UpdatedAt.Time,
-		Email:       user.Email.String,
-		IsChirpyRed: user.IsChirpyRed,
+	c.respondWithLogin(w, r, user)
+}
+
+var errInvalidCredentials = errors.New("incorrect email or password")
+
+// checkPassword returns the user with email if password is theirs. The
+// attempt must have been reserved on limitKeys beforehand, which are reset
+// when it succeeds.
+func (c *ApiConfig) checkPassword(r *http.Request, email, password string, limitKeys []loginKey) (database.User, error) {
+	user, err := c.Database.GetUser(r.Context(), sql.NullString{String: email, Valid: true})
+	if err != nil {
+		c.audit(r, auditEvent{
+			Action:  auditLoginFailed,
+			Payload: map[string]any{"reason": "unknown_email"},
+		})
+		return database.User{}, errInvalidCredentials
+	}
+
+	if err = auth.CheckPasswordHash(password, user.HashedPassword); err != nil {
+		c.audit(r, auditEvent{
+			Action:     auditLoginFailed,
+			TargetType: auditTargetUser,
+			TargetID:   user.ID,
+			Payload:    map[string]any{"reason": "wrong_password"},
+		})
+		return database.User{}, errInvalidCredentials
 	}
+	c.resetLoginFailures(r.Context(), limitKeys)
+
+	if c.Passwords.NeedsRehash(user.HashedPassword) {
+		c.rehashPassword(r.Context(), user.ID, password)
+	}
+
+	return user, nil
+}
 
-	refreshTokenStr, err := auth.MakeRefreshToken()
+// rehashPassword upgrades a stored hash made with an outdated algorithm or
+// parameters, now that we know the plaintext. Failing only costs us the
+// upgrade, so errors are logged rather than failing the login.
+func (c *ApiConfig) rehashPassword(ctx context.Context, userId uuid.UUID, password string) {
+	hashedPassword, err := c.Passwords.Hash(password)
 	if err != nil {
-		http.Error(w, "error creating refresh token", 500)
+		log.Printf("error rehashing password of user %s: %q", userId, err)
 		return
 	}
 
-	now := time.Now()
-	refreshToken, err := c.Database.CreateRefreshToken(
-		r.Context(), database.CreateRefreshTokenParams{
-			Token:     refreshTokenStr,
-			UserID:    uuid.NullUUID{UUID: u.ID, Valid: true},
-			ExpiresAt: sql.NullTime{Time: now.Add(time.Hour * 24 * 60), Valid: true}})
+	if err := c.Database.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{
+		ID:             userId,
+		HashedPassword: hashedPassword,
+	}); err != nil {
+		log.Printf("error saving rehashed password of user %s: %q", userId, err)
+	}
+}
 
+// respondWithLogin starts a new session for user and responds with its
+// access and refresh tokens.
+func (c *ApiConfig) respondWithLogin(w http.ResponseWriter, r *http.Request, user database.User) {
+	type newBody struct {
+		User
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	tokens, err := c.startSession(r, user, uuid.NullUUID{}, nil)
 	if err != nil {
-		http.Error(w, "error saving refresh token", 500)
+		http.Error(w, "error starting session", 500)
 		return
 	}
+
+	c.audit(r, auditEvent{
+		Actor:      user.ID,
+		Action:     auditLoginSucceeded,
+		TargetType: auditTargetUser,
+		TargetID:   user.ID,
+	})
+
 	resp := newBody{
-		User:         u,
-		Token:        token,
-		RefreshToken: refreshToken.Token,
+		User:         parseDbUser(user),
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
 	}
 
 	bodyToSend, err := json.Marshal(resp)
@@ -341,10 +711,14 @@ func (c *ApiConfig) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	w.Write(bodyToSend)
 }
 
+// HandleRefresh trades a refresh token for a new access token and a new
+// refresh token from the same family. The presented token is revoked, so
+// seeing it again means it leaked: the whole family is revoked.
 func (c *ApiConfig) HandleRefresh(w http.ResponseWriter, r *http.Request) {
 	tokenStr, err := auth.GetBearerToken(r.Header)
 	if err != nil {
 		http.Error(w, "error reading token", 401)
+		return
 	}
 
 	token, err := c.Database.GetRefreshToken(r.Context(), tokenStr)
@@ -354,18 +728,55 @@ func (c *ApiConfig) HandleRefresh(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if token.RevokedAt.Valid {
+		c.revokeReusedSession(r, token)
+		http.Error(w, "error retrieving token", 401)
+		return
+	}
+
+	if !token.ExpiresAt.Valid || time.Now().After(token.ExpiresAt.Time) {
+		http.Error(w, "refresh token expired", 401)
+		return
+	}
+
+	session, err := c.Database.GetSession(r.Context(), token.FamilyID)
+	if err != nil {
+		http.Error(w, "error retrieving token", 401)
+		return
+	}
+
+	// OAuth clients refresh through HandleToken, which keeps their scopes
+	if session.ClientID.Valid {
 		http.Error(w, "error retrieving token", 401)
 		return
 	}
 
-	accessToken, err := auth.MakeJWT(token.UserID.UUID, c.TokenSecret, time.Hour)
+	// the role is read again so a refreshed token never outlives a change
+	user, err := c.Database.GetUserByID(r.Context(), token.UserID.UUID)
+	if err != nil {
+		http.Error(w, "error retrieving user", 401)
+		return
+	}
+
+	accessToken, err := c.issueAccessToken(user, session)
 	if err != nil {
 		http.Error(w, "error creating access token", 500)
 		return
 	}
 
+	newTokenStr, err := c.rotateRefreshToken(r, token)
+	if errors.Is(err, errRefreshTokenReused) {
+		c.revokeReusedSession(r, token)
+		http.Error(w, "error retrieving token", 401)
+		return
+	}
+	if err != nil {
+		http.Error(w, "error rotating refresh token", 500)
+		return
+	}
+
 	m := map[string]string{
-		"token": accessToken,
+		"token":         accessToken,
+		"refresh_token": newTokenStr,
 	}
 	body, err := json.Marshal(m)
 	if err != nil {
@@ -373,48 +784,44 @@ func (c *ApiConfig) HandleRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Write(body)
 	w.WriteHeader(200)
+	w.Write(body)
 }
 
+// HandleRevoke ends the session of a refresh token. The app sends it as a
+// bearer token; OAuth clients post it with their credentials instead.
 func (c *ApiConfig) HandleRevoke(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		c.revokeClientToken(w, r)
+		return
+	}
+
 	tokenStr, err := auth.GetBearerToken(r.Header)
 	if err != nil {
 		http.Error(w, "error token string", 401)
 		return
 	}
 
-	_, err = c.Database.GetRefreshToken(r.Context(), tokenStr)
+	token, err := c.Database.GetRefreshToken(r.Context(), tokenStr)
 	if err != nil {
 		http.Error(w, "error retrieving token from db", 401)
 		return
 	}
 
-	now := time.Now()
-	nullTime := sql.NullTime{
-		Time:  now,
-		Valid: true,
-	}
-	err = c.Database.UpdateRefreshToken(r.Context(), database.UpdateRefreshTokenParams{
-		Token:     tokenStr,
-		UpdatedAt: nullTime,
-		RevokedAt: nullTime,
-	})
-	if err != nil {
+	// access tokens issued from this refresh token must stop working too
+	if err := c.endSession(r, token.UserID.UUID, token.FamilyID); err != nil {
 		http.Error(w, "error udpdating token", 500)
 		return
 	}
+
 	w.WriteHeader(204)
 }
 
+// HandleUpdateUser changes the email and password of the account. Either
+// is enough to take the account over, so only login sessions may change
+// them, not personal access tokens or OAuth clients.
 func (c *ApiConfig) HandleUpdateUser(w http.ResponseWriter, r *http.Request) {
-	tokenStr, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		http.Error(w, "unauthorized", 401)
-		return
-	}
-
-	userId, err := auth.ValidateJWT(tokenStr, c.TokenSecret)
+	userId, err := c.authenticateSession(r)
 	if err != nil {
 		http.Error(w, "unauthorized", 401)
 		return
@@ -428,7 +835,20 @@ func (c *ApiConfig) HandleUpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(user.Password)
+	if errs := c.validateCredentials(user.Email, user.Password); len(errs) > 0 {
+		respondWithFieldErrors(w, errs)
+		return
+	}
+
+	currentUser, err := c.Database.GetUserByID(r.Context(), userId)
+	if err != nil {
+		http.Error(w, "unauthorized", 401)
+		return
+	}
+
+	passwordChanged := auth.CheckPasswordHash(user.Password, currentUser.HashedPassword) != nil
+
+	hashedPassword, err := c.Passwords.Hash(user.Password)
 	if err != nil {
 		http.Error(w, "Internal server error", 500)
 		return
@@ -444,11 +864,37 @@ func (c *ApiConfig) HandleUpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if passwordChanged {
+		c.audit(r, auditEvent{
+			Actor:      userId,
+			Action:     auditPasswordChanged,
+			TargetType: auditTargetUser,
+			TargetID:   userId,
+		})
+	}
+
+	if currentUser.Email.String != updatedUser.Email.String {
+		c.audit(r, auditEvent{
+			Actor:      userId,
+			Action:     auditEmailChanged,
+			TargetType: auditTargetUser,
+			TargetID:   userId,
+		})
+
+		if err := c.sendVerificationEmail(r.Context(), userId, updatedUser.Email.String); err != nil {
+			log.Printf("error sending verification mail: %q", err)
+		}
+	}
+
 	body, err := json.Marshal(User{
-		ID:        userId,
-		Email:     updatedUser.Email.String,
-		CreatedAt: updatedUser.CreatedAt.Time,
-		UpdatedAt: updatedUser.UpdatedAt.Time,
+		ID:          userId,
+		Email:       updatedUser.Email.String,
+		Handle:      updatedUser.Handle.String,
+		CreatedAt:   updatedUser.CreatedAt.Time,
+		UpdatedAt:   updatedUser.UpdatedAt.Time,
+		IsChirpyRed: updatedUser.IsChirpyRed,
+		IsVerified:  updatedUser.VerifiedAt.Valid,
+		Role:        updatedUser.Role,
 	})
 	if err != nil {
 		http.Error(w, "Internal server error", 500)
@@ -457,16 +903,13 @@ func (c *ApiConfig) HandleUpdateUser(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(200)
 }
 
+// HandleDeleteChirp deletes a chirp. Its replies and quotes are kept, the
+// replies as top-level chirps and the quotes without the original; its
+// rechirps go with it.
 func (c *ApiConfig) HandleDeleteChirp(w http.ResponseWriter, r *http.Request) {
-	tokenStr, err := auth.GetBearerToken(r.Header)
+	userId, err := c.authenticate(r, auth.ScopeChirpsWrite)
 	if err != nil {
-		http.Error(w, "unauthorized", 401)
-		return
-	}
-
-	userId, err := auth.ValidateJWT(tokenStr, c.TokenSecret)
-	if err != nil {
-		http.Error(w, "unauthorized", 401)
+		http.Error(w, "unauthorized", authStatus(err))
 		return
 	}
 
@@ -478,14 +921,22 @@ func (c *ApiConfig) HandleDeleteChirp(w http.ResponseWriter, r *http.Request) {
 	}
 
 	chirp, err := c.Database.GetChirp(r.Context(), chirpId)
-	if err != nil {
+	if err != nil || (chirp.Status != chirpStatusPublished && chirp.UserID.UUID != userId) {
 		http.Error(w, "not found", 404)
 		return
 	}
 
+	// moderators may delete anyone's chirps
 	if chirp.UserID.UUID != userId {
-		http.Error(w, "unauthorized", 403)
-		return
+		user, err := c.Database.GetUserByID(r.Context(), userId)
+		if err != nil {
+			http.Error(w, "unauthorized", 401)
+			return
+		}
+		if !auth.HasRole(user.Role, auth.RoleModerator) {
+			http.Error(w, "unauthorized", 403)
+			return
+		}
 	}
 
 	err = c.Database.DeleteChirp(r.Context(), chirpId)
@@ -494,6 +945,14 @@ func (c *ApiConfig) HandleDeleteChirp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	c.audit(r, auditEvent{
+		Actor:      userId,
+		Action:     auditChirpDeleted,
+		TargetType: auditTargetChirp,
+		TargetID:   chirpId,
+		Payload:    map[string]any{"author_id": chirp.UserID.UUID, "body": chirp.Body.String},
+	})
+
 	w.WriteHeader(204)
 }
 
@@ -532,6 +991,13 @@ func (c *ApiConfig) HandleWebHook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	c.audit(r, auditEvent{
+		Action:     auditUserUpgraded,
+		TargetType: auditTargetUser,
+		TargetID:   webHook.Data.UserId,
+		Payload:    map[string]any{"event": webHook.Event},
+	})
+
 	w.WriteHeader(204)
 	return
 }
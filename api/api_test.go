@@ -0,0 +1,186 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LahcenHaouch/goserver/internal/auth"
+	"github.com/LahcenHaouch/goserver/internal/database"
+	"github.com/LahcenHaouch/goserver/internal/lockout"
+	"github.com/LahcenHaouch/goserver/internal/mail"
+	"github.com/LahcenHaouch/goserver/internal/media"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	_ "github.com/lib/pq"
+)
+
+// testDB opens a database with the migrations of sql/schema applied, in a
+// schema of its own dropped after the test. Tests using it are skipped
+// unless TEST_DB_URL points at a Postgres database they may create schemas
+// in. params are added to the connection, such as a timezone.
+func testDB(t *testing.T, params map[string]string) *sql.DB {
+	t.Helper()
+
+	dbURL := os.Getenv("TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DB_URL not set")
+	}
+
+	admin, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("error connecting to db: %q", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("error creating schema: %q", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Logf("error dropping schema %s: %q", schema, err)
+		}
+	})
+
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		t.Fatalf("TEST_DB_URL must be a URL: %q", err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	for k, v := range params {
+		query.Set(k, v)
+	}
+	u.RawQuery = query.Encode()
+
+	db, err := sql.Open("postgres", u.String())
+	if err != nil {
+		t.Fatalf("error connecting to db: %q", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	files, err := filepath.Glob("../sql/schema/*.sql")
+	if err != nil {
+		t.Fatalf("error listing migrations: %q", err)
+	}
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("error reading %s: %q", file, err)
+		}
+		up, _, _ := strings.Cut(string(b), "-- +goose Down")
+		if _, err := db.Exec(up); err != nil {
+			t.Fatalf("error applying %s: %q", file, err)
+		}
+	}
+
+	return db
+}
+
+// testConfig is an ApiConfig on a test database, with a signing key and
+// fast password hashing.
+func testConfig(t *testing.T) *ApiConfig {
+	t.Helper()
+	return testConfigWith(t, nil)
+}
+
+func testConfigWith(t *testing.T, params map[string]string) *ApiConfig {
+	t.Helper()
+
+	db := testDB(t, params)
+	queries := database.New(db)
+
+	c := &ApiConfig{
+		DB:              db,
+		Database:        queries,
+		Keys:            auth.NewKeyRing(),
+		KeyAlgorithm:    auth.AlgEdDSA,
+		KeyRotation:     24 * time.Hour,
+		Passwords:       &auth.PasswordHasher{Algorithm: auth.AlgBcrypt, BcryptCost: bcrypt.MinCost},
+		PasswordPolicy:  auth.DefaultPasswordPolicy,
+		Mailer:          mail.LogMailer{From: "chirpy@example.com"},
+		BaseURL:         "http://chirpy.test",
+		LoginLimiter:    lockout.NewLimiter(lockout.NewPostgresStore(queries)),
+		ChirpEditWindow: 15 * time.Minute,
+		Media:           media.NewLocalStore(t.TempDir()),
+	}
+	if err := c.RotateSigningKeys(context.Background()); err != nil {
+		t.Fatalf("error creating signing key: %q", err)
+	}
+	return c
+}
+
+const testPassword = "correct horse battery"
+
+func createTestUser(t *testing.T, c *ApiConfig, email string) database.User {
+	t.Helper()
+
+	hash, err := c.Passwords.Hash(testPassword)
+	if err != nil {
+		t.Fatalf("error hashing password: %q", err)
+	}
+	user, err := c.Database.CreateUser(context.Background(), database.CreateUserParams{
+		Email:          sql.NullString{String: email, Valid: true},
+		HashedPassword: hash,
+	})
+	if err != nil {
+		t.Fatalf("error creating user: %q", err)
+	}
+	return user
+}
+
+// loginTestUser starts a session for user, of clientId when set, and
+// returns its tokens.
+func loginTestUser(t *testing.T, c *ApiConfig, user database.User, clientId uuid.NullUUID, scopes []string) sessionTokens {
+	t.Helper()
+
+	tokens, err := c.startSession(httptest.NewRequest(http.MethodPost, "/api/login", nil), user, clientId, scopes)
+	if err != nil {
+		t.Fatalf("error starting session: %q", err)
+	}
+	return tokens
+}
+
+// createTestClient registers an OAuth client owned by owner. It is
+// confidential when secret isn't empty.
+func createTestClient(t *testing.T, c *ApiConfig, owner database.User, secret string) database.OauthClient {
+	t.Helper()
+
+	var secretHash sql.NullString
+	if secret != "" {
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+	client, err := c.Database.CreateOAuthClient(context.Background(), database.CreateOAuthClientParams{
+		OwnerID:      owner.ID,
+		Name:         "test client",
+		SecretHash:   secretHash,
+		RedirectUris: []string{"http://client.test/callback"},
+	})
+	if err != nil {
+		t.Fatalf("error creating client: %q", err)
+	}
+	return client
+}
+
+func createTestChirp(t *testing.T, c *ApiConfig, user database.User, body string) database.Chirp {
+	t.Helper()
+
+	chirp, err := c.Database.CreateChirp(context.Background(), database.CreateChirpParams{
+		Body:   sql.NullString{String: body, Valid: true},
+		UserID: uuid.NullUUID{UUID: user.ID, Valid: true},
+		Status: chirpStatusPublished,
+	})
+	if err != nil {
+		t.Fatalf("error creating chirp: %q", err)
+	}
+	return chirp
+}
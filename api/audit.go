@@ -0,0 +1,208 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/LahcenHaouch/goserver/internal/database"
+	"github.com/LahcenHaouch/goserver/utils"
+	"github.com/google/uuid"
+)
+
+const (
+	auditLoginSucceeded  = "login.succeeded"
+	auditLoginFailed     = "login.failed"
+	auditPasswordChanged = "user.password_changed"
+	auditPasswordReset   = "user.password_reset"
+	auditEmailChanged    = "user.email_changed"
+	auditRoleChanged     = "user.role_changed"
+	auditUserDeleted     = "user.deleted"
+	auditUserUpgraded    = "user.upgraded"
+	auditSessionRevoked  = "session.revoked"
+	auditSessionsRevoked = "session.revoked_all"
+	auditTokenRevoked    = "token.revoked"
+	auditChirpDeleted    = "chirp.deleted"
+	auditTOTPEnabled     = "totp.enabled"
+	auditTOTPDisabled    = "totp.disabled"
+	auditOAuthAuthorized = "oauth.authorized"
+)
+
+const (
+	auditTargetUser        = "user"
+	auditTargetSession     = "session"
+	auditTargetToken       = "personal_access_token"
+	auditTargetChirp       = "chirp"
+	auditTargetOAuthClient = "oauth_client"
+)
+
+const (
+	defaultAuditEventLimit = 50
+	maxAuditEventLimit     = 500
+)
+
+// auditEvent is a security-sensitive action to record. Actor is uuid.Nil
+// when nobody is logged in, such as a failed login or a webhook. Events
+// can't be changed once recorded, so they refer to users by id only: an
+// email in Payload would outlive the account's deletion.
+type auditEvent struct {
+	Actor      uuid.UUID
+	Action     string
+	TargetType string
+	TargetID   uuid.UUID
+	Payload    map[string]any
+}
+
+type AuditEvent struct {
+	ID         int64           `json:"id"`
+	CreatedAt  time.Time       `json:"created_at"`
+	ActorID    *uuid.UUID      `json:"actor_id"`
+	Action     string          `json:"action"`
+	TargetType *string         `json:"target_type"`
+	TargetID   *string         `json:"target_id"`
+	IP         string          `json:"ip"`
+	UserAgent  string          `json:"user_agent"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// audit records e along with where the request came from. The action it
+// describes already happened, so failing to record it is only logged.
+func (c *ApiConfig) audit(r *http.Request, e auditEvent) {
+	payload := []byte("{}")
+	if e.Payload != nil {
+		var err error
+		if payload, err = json.Marshal(e.Payload); err != nil {
+			log.Printf("error marshalling audit event %s: %q", e.Action, err)
+			return
+		}
+	}
+
+	params := database.CreateAuditEventParams{
+		ActorID:   uuid.NullUUID{UUID: e.Actor, Valid: e.Actor != uuid.Nil},
+		Action:    e.Action,
+		Ip:        c.clientIP(r),
+		UserAgent: r.UserAgent(),
+		Payload:   payload,
+	}
+	if e.TargetType != "" {
+		params.TargetType = sql.NullString{String: e.TargetType, Valid: true}
+		params.TargetID = sql.NullString{String: e.TargetID.String(), Valid: true}
+	}
+
+	if err := c.Database.CreateAuditEvent(r.Context(), params); err != nil {
+		log.Printf("error recording audit event %s: %q", e.Action, err)
+	}
+}
+
+func nullStringPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+func parseDbAuditEvent(e database.AuditEvent) AuditEvent {
+	event := AuditEvent{
+		ID:         e.ID,
+		CreatedAt:  e.CreatedAt,
+		Action:     e.Action,
+		TargetType: nullStringPtr(e.TargetType),
+		TargetID:   nullStringPtr(e.TargetID),
+		IP:         e.Ip,
+		UserAgent:  e.UserAgent,
+		Payload:    e.Payload,
+	}
+	if e.ActorID.Valid {
+		event.ActorID = &e.ActorID.UUID
+	}
+	return event
+}
+
+// HandleListAuditEvents lists audit events, newest first. Every query
+// parameter is an optional filter; pages are chained by passing the
+// next_cursor of a response as cursor.
+func (c *ApiConfig) HandleListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	params := database.ListAuditEventsParams{Limit: defaultAuditEventLimit}
+
+	if v := query.Get("actor_id"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			http.Error(w, "invalid actor_id", 400)
+			return
+		}
+		params.ActorID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	for name, param := range map[string]*sql.NullString{
+		"action":      &params.Action,
+		"target_type": &params.TargetType,
+		"target_id":   &params.TargetID,
+	} {
+		if v := query.Get(name); v != "" {
+			*param = sql.NullString{String: v, Valid: true}
+		}
+	}
+
+	for name, param := range map[string]*sql.NullTime{
+		"since": &params.Since,
+		"until": &params.Until,
+	} {
+		if v := query.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, "invalid "+name+", expected an RFC 3339 time", 400)
+				return
+			}
+			*param = sql.NullTime{Time: t.UTC(), Valid: true}
+		}
+	}
+
+	if v := query.Get("cursor"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid cursor", 400)
+			return
+		}
+		params.BeforeID = sql.NullInt64{Int64: id, Valid: true}
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxAuditEventLimit {
+			http.Error(w, "invalid limit", 400)
+			return
+		}
+		params.Limit = int32(limit)
+	}
+
+	// one more than asked tells us whether there is a next page
+	limit := params.Limit
+	params.Limit++
+
+	events, err := c.Database.ListAuditEvents(r.Context(), params)
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	type response struct {
+		Events     []AuditEvent `json:"events"`
+		NextCursor *string      `json:"next_cursor"`
+	}
+
+	resp := response{Events: make([]AuditEvent, 0, len(events))}
+	if len(events) > int(limit) {
+		events = events[:limit]
+		cursor := strconv.FormatInt(events[len(events)-1].ID, 10)
+		resp.NextCursor = &cursor
+	}
+	for _, e := range events {
+		resp.Events = append(resp.Events, parseDbAuditEvent(e))
+	}
+
+	utils.RespondWithJSON(w, resp, 200)
+}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/LahcenHaouch/goserver/internal/auth"
+	"github.com/LahcenHaouch/goserver/internal/database"
+	"github.com/LahcenHaouch/goserver/utils"
+	"github.com/google/uuid"
+)
+
+const maxChirpLength = 140
+
+// ChirpRevision is a version of a chirp's body that an edit replaced.
+type ChirpRevision struct {
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+// checkChirpBody answers the request and returns false when body can't be
+// posted, new or edited. Quotes must say something of their own.
+func checkChirpBody(w http.ResponseWriter, body string, quote bool) bool {
+	if len(body) > maxChirpLength {
+		utils.RespondWithError(w, map[string]string{"error": "body length > 140"}, 400)
+		return false
+	}
+
+	if quote && strings.TrimSpace(body) == "" {
+		utils.RespondWithError(w, map[string]string{"error": "a quote needs a body"}, 400)
+		return false
+	}
+
+	return true
+}
+
+// HandleEditChirp lets authors change the body of a chirp within
+// ChirpEditWindow of posting it. The replaced body is kept as a revision.
+func (c *ApiConfig) HandleEditChirp(w http.ResponseWriter, r *http.Request) {
+	type request struct {
+		Body string `json:"body"`
+	}
+
+	userId, err := c.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		http.Error(w, "unauthorized", authStatus(err))
+		return
+	}
+
+	chirpId, err := uuid.Parse(r.PathValue("chirpId"))
+	if err != nil {
+		utils.RespondWithError(w, map[string]string{"error": "error parsing chirp id"}, 400)
+		return
+	}
+
+	defer r.Body.Close()
+
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, map[string]string{"error": "error decoding body"}, 400)
+		return
+	}
+
+	tx, err := c.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+	defer tx.Rollback()
+	qtx := c.Database.WithTx(tx)
+
+	// the lock keeps concurrent edits from losing each other's revisions
+	chirp, err := qtx.GetChirpForUpdate(r.Context(), chirpId)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "not found", 404)
+		return
+	}
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	// drafts are changed through their own endpoint
+	if chirp.Status != chirpStatusPublished {
+		http.Error(w, "not found", 404)
+		return
+	}
+
+	if chirp.UserID.UUID != userId {
+		http.Error(w, "only the author can edit a chirp", 403)
+		return
+	}
+
+	if chirp.RechirpOfID.Valid {
+		utils.RespondWithError(w, map[string]string{"error": "rechirps can't be edited"}, 400)
+		return
+	}
+
+	editable, err := qtx.IsChirpEditable(r.Context(), database.IsChirpEditableParams{
+		ID:            chirp.ID,
+		WindowSeconds: c.ChirpEditWindow.Seconds(),
+	})
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+	if c.ChirpEditWindow <= 0 || !editable {
+		utils.RespondWithError(w, map[string]string{
+			"error": fmt.Sprintf("chirps can only be edited within %s of being posted", c.ChirpEditWindow),
+		}, 403)
+		return
+	}
+
+	if !checkChirpBody(w, req.Body, chirp.QuoteOfID.Valid) {
+		return
+	}
+
+	body := utils.RemoveBadWords(req.Body)
+	if body != chirp.Body.String {
+		if err := qtx.CreateChirpRevision(r.Context(), database.CreateChirpRevisionParams{
+			ChirpID:   chirp.ID,
+			Body:      chirp.Body.String,
+			CreatedAt: chirp.UpdatedAt.Time,
+		}); err != nil {
+			http.Error(w, "internal server error", 500)
+			return
+		}
+
+		chirp, err = qtx.UpdateChirpBody(r.Context(), database.UpdateChirpBodyParams{
+			ID:   chirp.ID,
+			Body: sql.NullString{String: body, Valid: true},
+		})
+		if err != nil {
+			http.Error(w, "internal server error", 500)
+			return
+		}
+
+		if err := qtx.DeleteChirpEntities(r.Context(), chirp.ID); err != nil {
+			http.Error(w, "internal server error", 500)
+			return
+		}
+		if err := saveEntities(r.Context(), qtx, chirp.ID, body); err != nil {
+			http.Error(w, "internal server error", 500)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	chirps := []Chirp{parseDbChirp(chirp)}
+	if err := c.loadChirpDetails(r.Context(), chirps, uuid.NullUUID{UUID: userId, Valid: true}); err != nil {
+		log.Printf("error loading details of chirp %s: %q", chirp.ID, err)
+	}
+
+	utils.RespondWithJSON(w, chirps[0], 200)
+}
+
+// HandleListChirpRevisions lists the bodies a chirp had before its edits,
+// latest first. The current body is the chirp's own.
+func (c *ApiConfig) HandleListChirpRevisions(w http.ResponseWriter, r *http.Request) {
+	chirpId, err := uuid.Parse(r.PathValue("chirpId"))
+	if err != nil {
+		utils.RespondWithError(w, map[string]string{"error": "error parsing chirp id"}, 400)
+		return
+	}
+
+	if _, err := c.Database.GetPublishedChirp(r.Context(), chirpId); err != nil {
+		utils.RespondWithError(w, map[string]string{"error": "error fetching chirp"}, 404)
+		return
+	}
+
+	revisions, err := c.Database.ListChirpRevisions(r.Context(), chirpId)
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	type response struct {
+		Revisions []ChirpRevision `json:"revisions"`
+	}
+
+	resp := response{Revisions: make([]ChirpRevision, 0, len(revisions))}
+	for _, rev := range revisions {
+		resp.Revisions = append(resp.Revisions, ChirpRevision{
+			Body:       rev.Body,
+			CreatedAt:  rev.CreatedAt,
+			ReplacedAt: rev.ReplacedAt,
+		})
+	}
+
+	utils.RespondWithJSON(w, resp, 200)
+}
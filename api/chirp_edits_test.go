@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func editChirp(c *ApiConfig, token string, id uuid.UUID, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, "/api/chirps/"+id.String(), strings.NewReader(`{"body":"`+body+`"}`))
+	req.SetPathValue("chirpId", id.String())
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	c.HandleEditChirp(rec, req)
+	return rec
+}
+
+// The edit window must last ChirpEditWindow whatever time zone the
+// database session is in.
+func TestChirpEditWindowAcrossTimeZones(t *testing.T) {
+	for _, tz := range []string{"UTC", "Asia/Tokyo", "America/New_York"} {
+		t.Run(tz, func(t *testing.T) {
+			c := testConfigWith(t, map[string]string{"timezone": tz})
+			user := createTestUser(t, c, "ann@example.com")
+			tokens := loginTestUser(t, c, user, uuid.NullUUID{}, nil)
+
+			fresh := createTestChirp(t, c, user, "just posted")
+			if rec := editChirp(c, tokens.AccessToken, fresh.ID, "edited"); rec.Code != 200 {
+				t.Fatalf("expected 200 within the window, got %d: %s", rec.Code, rec.Body)
+			}
+
+			old := createTestChirp(t, c, user, "posted a while ago")
+			if _, err := c.DB.Exec("UPDATE chirps SET created_at = NOW() - interval '20 minutes' WHERE id = $1", old.ID); err != nil {
+				t.Fatalf("error moving created_at: %q", err)
+			}
+			if rec := editChirp(c, tokens.AccessToken, old.ID, "edited"); rec.Code != 403 {
+				t.Fatalf("expected 403 past the window, got %d", rec.Code)
+			}
+		})
+	}
+}
+
+func TestEditChirpKeepsRevisions(t *testing.T) {
+	c := testConfig(t)
+	user := createTestUser(t, c, "ann@example.com")
+	other := createTestUser(t, c, "bob@example.com")
+	tokens := loginTestUser(t, c, user, uuid.NullUUID{}, nil)
+	otherTokens := loginTestUser(t, c, other, uuid.NullUUID{}, nil)
+	chirp := createTestChirp(t, c, user, "first")
+
+	if rec := editChirp(c, otherTokens.AccessToken, chirp.ID, "hijacked"); rec.Code != 403 {
+		t.Fatalf("expected 403 for another user's chirp, got %d", rec.Code)
+	}
+
+	for _, body := range []string{"second", "third"} {
+		if rec := editChirp(c, tokens.AccessToken, chirp.ID, body); rec.Code != 200 {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/chirps/"+chirp.ID.String()+"/revisions", nil)
+	req.SetPathValue("chirpId", chirp.ID.String())
+	rec := httptest.NewRecorder()
+	c.HandleListChirpRevisions(rec, req)
+	if rec.Code != 200 {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var resp struct {
+		Revisions []ChirpRevision `json:"revisions"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("error decoding revisions: %q", err)
+	}
+	if len(resp.Revisions) != 2 || resp.Revisions[0].Body != "second" || resp.Revisions[1].Body != "first" {
+		t.Fatalf("expected revisions second and first, got %+v", resp.Revisions)
+	}
+}
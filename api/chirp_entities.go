@@ -0,0 +1,163 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/LahcenHaouch/goserver/internal/database"
+	"github.com/LahcenHaouch/goserver/internal/entities"
+	"github.com/google/uuid"
+)
+
+// ChirpEntities are the hashtags and mentions of a chirp. Start and End are
+// byte offsets into the body, End excluded.
+type ChirpEntities struct {
+	Hashtags []HashtagEntity `json:"hashtags"`
+	Mentions []MentionEntity `json:"mentions"`
+}
+
+type HashtagEntity struct {
+	Tag   string `json:"tag"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+type MentionEntity struct {
+	UserID uuid.UUID `json:"user_id"`
+	Start  int       `json:"start"`
+	End    int       `json:"end"`
+}
+
+func newChirpEntities() ChirpEntities {
+	return ChirpEntities{Hashtags: []HashtagEntity{}, Mentions: []MentionEntity{}}
+}
+
+// saveEntities parses the entities of a new chirp and stores them. Mentions
+// of handles nobody has taken stay plain text.
+func saveEntities(ctx context.Context, q *database.Queries, chirpId uuid.UUID, body string) error {
+	parsed := entities.Parse(body)
+
+	for _, tag := range parsed.Hashtags {
+		if err := q.CreateChirpTag(ctx, database.CreateChirpTagParams{
+			ChirpID:     chirpId,
+			Tag:         tag.Tag,
+			StartOffset: int32(tag.Start),
+			EndOffset:   int32(tag.End),
+		}); err != nil {
+			return err
+		}
+	}
+
+	if len(parsed.Mentions) == 0 {
+		return nil
+	}
+
+	handles := make([]string, 0, len(parsed.Mentions))
+	for _, m := range parsed.Mentions {
+		handles = append(handles, strings.ToLower(m.Handle))
+	}
+
+	users, err := q.GetUsersByHandles(ctx, handles)
+	if err != nil {
+		return err
+	}
+
+	userIds := make(map[string]uuid.UUID, len(users))
+	for _, u := range users {
+		userIds[strings.ToLower(u.Handle.String)] = u.ID
+	}
+
+	for _, m := range parsed.Mentions {
+		userId, ok := userIds[strings.ToLower(m.Handle)]
+		if !ok {
+			continue
+		}
+
+		if err := q.CreateChirpMention(ctx, database.CreateChirpMentionParams{
+			ChirpID:     chirpId,
+			UserID:      userId,
+			StartOffset: int32(m.Start),
+			EndOffset:   int32(m.End),
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadEntities fills in the entities of chirps.
+func (c *ApiConfig) loadEntities(ctx context.Context, chirps []Chirp) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(chirps))
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.ID)
+	}
+
+	tags, err := c.Database.ListChirpTags(ctx, ids)
+	if err != nil {
+		return err
+	}
+	hashtags := make(map[uuid.UUID][]HashtagEntity)
+	for _, t := range tags {
+		hashtags[t.ChirpID] = append(hashtags[t.ChirpID], HashtagEntity{
+			Tag:   t.Tag,
+			Start: int(t.StartOffset),
+			End:   int(t.EndOffset),
+		})
+	}
+
+	rows, err := c.Database.ListChirpMentions(ctx, ids)
+	if err != nil {
+		return err
+	}
+	mentions := make(map[uuid.UUID][]MentionEntity)
+	for _, m := range rows {
+		mentions[m.ChirpID] = append(mentions[m.ChirpID], MentionEntity{
+			UserID: m.UserID,
+			Start:  int(m.StartOffset),
+			End:    int(m.EndOffset),
+		})
+	}
+
+	// a chirp may be listed twice, such as when it is also embedded
+	for i := range chirps {
+		chirps[i].Entities.Hashtags = append(chirps[i].Entities.Hashtags, hashtags[chirps[i].ID]...)
+		chirps[i].Entities.Mentions = append(chirps[i].Entities.Mentions, mentions[chirps[i].ID]...)
+	}
+
+	return nil
+}
+
+// HandleGetTagChirps lists the chirps tagged with {tag}, paginated like
+// HandleGetChirps.
+func (c *ApiConfig) HandleGetTagChirps(w http.ResponseWriter, r *http.Request) {
+	tag := r.PathValue("tag")
+	if !entities.ValidTag(tag) {
+		http.Error(w, "invalid tag", 400)
+		return
+	}
+
+	c.serveChirps(w, r, chirpPage{Tag: entities.NormalizeTag(tag)})
+}
+
+// HandleGetUserMentions lists the chirps mentioning {userId}, paginated
+// like HandleGetChirps.
+func (c *ApiConfig) HandleGetUserMentions(w http.ResponseWriter, r *http.Request) {
+	userId, err := uuid.Parse(r.PathValue("userId"))
+	if err != nil {
+		http.Error(w, "invalid user id", 400)
+		return
+	}
+
+	if _, err := c.Database.GetUserByID(r.Context(), userId); err != nil {
+		http.Error(w, "user not found", 404)
+		return
+	}
+
+	c.serveChirps(w, r, chirpPage{Mentioned: uuid.NullUUID{UUID: userId, Valid: true}})
+}
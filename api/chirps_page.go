@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LahcenHaouch/goserver/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultChirpLimit = 20
+	maxChirpLimit     = 100
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// chirpCursor is the position of a chirp in (created_at, id) order. Clients
+// get it as an opaque string and hand it back to fetch the next page.
+type chirpCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+func (cur chirpCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cur.raw()))
+}
+
+func (cur chirpCursor) raw() string {
+	return cur.CreatedAt.Format(time.RFC3339Nano) + "|" + cur.ID.String()
+}
+
+func parseChirpCursor(s string) (chirpCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return chirpCursor{}, errInvalidCursor
+	}
+	return parseRawChirpCursor(string(raw))
+}
+
+func parseRawChirpCursor(raw string) (chirpCursor, error) {
+	createdAt, id, ok := strings.Cut(raw, "|")
+	if !ok {
+		return chirpCursor{}, errInvalidCursor
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return chirpCursor{}, errInvalidCursor
+	}
+
+	chirpId, err := uuid.Parse(id)
+	if err != nil {
+		return chirpCursor{}, errInvalidCursor
+	}
+
+	return chirpCursor{CreatedAt: t, ID: chirpId}, nil
+}
+
+// searchCursor is the position of a chirp in search results, which are
+// ordered by rank before (created_at, id).
+type searchCursor struct {
+	Rank float32
+	chirpCursor
+}
+
+func (cur searchCursor) String() string {
+	raw := strconv.FormatFloat(float64(cur.Rank), 'g', -1, 32) + "|" + cur.chirpCursor.raw()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func parseSearchCursor(s string) (searchCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return searchCursor{}, errInvalidCursor
+	}
+
+	rank, rest, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return searchCursor{}, errInvalidCursor
+	}
+
+	r, err := strconv.ParseFloat(rank, 32)
+	if err != nil {
+		return searchCursor{}, errInvalidCursor
+	}
+
+	cur, err := parseRawChirpCursor(rest)
+	if err != nil {
+		return searchCursor{}, errInvalidCursor
+	}
+
+	return searchCursor{Rank: float32(r), chirpCursor: cur}, nil
+}
+
+func cursorOf(chirp database.Chirp) chirpCursor {
+	return chirpCursor{CreatedAt: chirp.CreatedAt.Time, ID: chirp.ID}
+}
+
+// chirpPage selects a page of chirps: those of Author, tagged with Tag and
+// mentioning Mentioned, for each that is set, after Cursor if set, oldest
+// first unless Desc.
+type chirpPage struct {
+	Author    uuid.NullUUID
+	Tag       string
+	Mentioned uuid.NullUUID
+	Cursor    *chirpCursor
+	Desc      bool
+	Limit     int32
+}
+
+func (c *ApiConfig) listChirps(ctx context.Context, page chirpPage) ([]database.Chirp, error) {
+	var at sql.NullTime
+	var id uuid.NullUUID
+	tag := sql.NullString{String: page.Tag, Valid: page.Tag != ""}
+	if page.Cursor != nil {
+		at = sql.NullTime{Time: page.Cursor.CreatedAt, Valid: true}
+		id = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+	}
+
+	if page.Desc {
+		return c.Database.ListChirpsDESC(ctx, database.ListChirpsDESCParams{
+			AuthorID:        page.Author,
+			Tag:             tag,
+			MentionedUserID: page.Mentioned,
+			BeforeCreatedAt: at,
+			BeforeID:        id,
+			Limit:           page.Limit,
+		})
+	}
+	return c.Database.ListChirps(ctx, database.ListChirpsParams{
+		AuthorID:        page.Author,
+		Tag:             tag,
+		MentionedUserID: page.Mentioned,
+		AfterCreatedAt:  at,
+		AfterID:         id,
+		Limit:           page.Limit,
+	})
+}
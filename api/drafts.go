@@ -0,0 +1,325 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/LahcenHaouch/goserver/internal/auth"
+	"github.com/LahcenHaouch/goserver/internal/database"
+	"github.com/LahcenHaouch/goserver/utils"
+	"github.com/google/uuid"
+)
+
+// A chirp is a draft until its author publishes it, or scheduled when it
+// publishes itself at publish_at. Only published chirps are shown to others.
+const (
+	chirpStatusDraft     = "draft"
+	chirpStatusScheduled = "scheduled"
+	chirpStatusPublished = "published"
+)
+
+const (
+	// scheduledChirpInterval is how often due chirps are looked for, so how
+	// late after publish_at they can come out.
+	scheduledChirpInterval = 15 * time.Second
+	scheduledChirpBatch    = 100
+)
+
+type PostDraft struct {
+	PostChirp
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+// draftStatus answers the request and returns false when publishAt isn't
+// in the future. Without one the chirp stays a draft.
+func draftStatus(w http.ResponseWriter, publishAt *time.Time) (string, sql.NullTime, bool) {
+	if publishAt == nil {
+		return chirpStatusDraft, sql.NullTime{}, true
+	}
+
+	if !publishAt.After(time.Now()) {
+		utils.RespondWithError(w, map[string]string{"error": "publish_at must be in the future"}, 400)
+		return "", sql.NullTime{}, false
+	}
+
+	return chirpStatusScheduled, sql.NullTime{Time: publishAt.UTC(), Valid: true}, true
+}
+
+// HandleCreateDraft saves a chirp without publishing it, or schedules it
+// when publish_at is set.
+func (c *ApiConfig) HandleCreateDraft(w http.ResponseWriter, r *http.Request) {
+	userId, err := c.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		http.Error(w, "unauthorized", authStatus(err))
+		return
+	}
+
+	if !c.checkCanPost(w, r, userId) {
+		return
+	}
+
+	defer r.Body.Close()
+
+	var draft PostDraft
+	if err := json.NewDecoder(r.Body).Decode(&draft); err != nil {
+		utils.RespondWithError(w, map[string]string{"error": "error decoding body"}, 400)
+		return
+	}
+
+	if !checkChirpBody(w, draft.Body, draft.QuoteOfID != nil) {
+		return
+	}
+
+	status, publishAt, ok := draftStatus(w, draft.PublishAt)
+	if !ok {
+		return
+	}
+
+	newDraft, ok := c.insertChirp(w, r, userId, draft.PostChirp, status, publishAt)
+	if !ok {
+		return
+	}
+
+	chirps := []Chirp{parseDbChirp(newDraft)}
+	if err := c.loadChirpDetails(r.Context(), chirps, uuid.NullUUID{UUID: userId, Valid: true}); err != nil {
+		log.Printf("error loading details of chirp %s: %q", newDraft.ID, err)
+	}
+
+	utils.RespondWithJSON(w, chirps[0], 201)
+}
+
+// HandleListDrafts lists the caller's drafts and scheduled chirps, the
+// next to be published first. Published chirps can be read by anyone, so
+// these are what chirps:read is for.
+func (c *ApiConfig) HandleListDrafts(w http.ResponseWriter, r *http.Request) {
+	userId, err := c.authenticate(r, auth.ScopeChirpsRead)
+	if err != nil {
+		http.Error(w, "unauthorized", authStatus(err))
+		return
+	}
+
+	drafts, err := c.Database.ListUserDrafts(r.Context(), uuid.NullUUID{UUID: userId, Valid: true})
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	type response struct {
+		Drafts []Chirp `json:"drafts"`
+	}
+
+	resp := response{Drafts: make([]Chirp, 0, len(drafts))}
+	resp.Drafts = append(resp.Drafts, parseDbChirps(drafts)...)
+	if err := c.loadChirpDetails(r.Context(), resp.Drafts, uuid.NullUUID{UUID: userId, Valid: true}); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	utils.RespondWithJSON(w, resp, 200)
+}
+
+// HandleUpdateDraft replaces the body and publish_at of a draft. Leaving
+// publish_at out unschedules it.
+func (c *ApiConfig) HandleUpdateDraft(w http.ResponseWriter, r *http.Request) {
+	type request struct {
+		Body      string     `json:"body"`
+		PublishAt *time.Time `json:"publish_at"`
+	}
+
+	userId, err := c.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		http.Error(w, "unauthorized", authStatus(err))
+		return
+	}
+
+	draftId, err := uuid.Parse(r.PathValue("draftId"))
+	if err != nil {
+		http.Error(w, "bad request", 400)
+		return
+	}
+
+	if !c.checkCanPost(w, r, userId) {
+		return
+	}
+
+	defer r.Body.Close()
+
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.RespondWithError(w, map[string]string{"error": "error decoding body"}, 400)
+		return
+	}
+
+	status, publishAt, ok := draftStatus(w, req.PublishAt)
+	if !ok {
+		return
+	}
+
+	tx, err := c.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+	defer tx.Rollback()
+	qtx := c.Database.WithTx(tx)
+
+	// the lock keeps the scheduler from publishing the draft mid-update
+	draft, err := qtx.GetDraftForUpdate(r.Context(), database.GetDraftForUpdateParams{
+		ID:     draftId,
+		UserID: uuid.NullUUID{UUID: userId, Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "not found", 404)
+		return
+	}
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	if !checkChirpBody(w, req.Body, draft.QuoteOfID.Valid) {
+		return
+	}
+
+	body := utils.RemoveBadWords(req.Body)
+	draft, err = qtx.UpdateDraft(r.Context(), database.UpdateDraftParams{
+		ID:        draft.ID,
+		Body:      sql.NullString{String: body, Valid: true},
+		Status:    status,
+		PublishAt: publishAt,
+	})
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	if err := qtx.DeleteChirpEntities(r.Context(), draft.ID); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+	if err := saveEntities(r.Context(), qtx, draft.ID, body); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	chirps := []Chirp{parseDbChirp(draft)}
+	if err := c.loadChirpDetails(r.Context(), chirps, uuid.NullUUID{UUID: userId, Valid: true}); err != nil {
+		log.Printf("error loading details of chirp %s: %q", draft.ID, err)
+	}
+
+	utils.RespondWithJSON(w, chirps[0], 200)
+}
+
+// HandleDeleteDraft discards a draft or scheduled chirp.
+func (c *ApiConfig) HandleDeleteDraft(w http.ResponseWriter, r *http.Request) {
+	userId, err := c.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		http.Error(w, "unauthorized", authStatus(err))
+		return
+	}
+
+	draftId, err := uuid.Parse(r.PathValue("draftId"))
+	if err != nil {
+		http.Error(w, "bad request", 400)
+		return
+	}
+
+	deleted, err := c.Database.DeleteDraft(r.Context(), database.DeleteDraftParams{
+		ID:     draftId,
+		UserID: uuid.NullUUID{UUID: userId, Valid: true},
+	})
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+	if deleted == 0 {
+		http.Error(w, "not found", 404)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// HandlePublishDraft publishes a draft or scheduled chirp right away. It
+// is dated from now, not from when the draft was saved.
+func (c *ApiConfig) HandlePublishDraft(w http.ResponseWriter, r *http.Request) {
+	userId, err := c.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		http.Error(w, "unauthorized", authStatus(err))
+		return
+	}
+
+	draftId, err := uuid.Parse(r.PathValue("draftId"))
+	if err != nil {
+		http.Error(w, "bad request", 400)
+		return
+	}
+
+	if !c.checkCanPost(w, r, userId) {
+		return
+	}
+
+	chirp, err := c.Database.PublishDraft(r.Context(), database.PublishDraftParams{
+		ID:     draftId,
+		UserID: uuid.NullUUID{UUID: userId, Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "not found", 404)
+		return
+	}
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	chirps := []Chirp{parseDbChirp(chirp)}
+	if err := c.loadChirpDetails(r.Context(), chirps, uuid.NullUUID{UUID: userId, Valid: true}); err != nil {
+		log.Printf("error loading details of chirp %s: %q", chirp.ID, err)
+	}
+
+	utils.RespondWithJSON(w, chirps[0], 200)
+}
+
+// publishDueChirps publishes every scheduled chirp whose publish_at has
+// passed. Other servers doing the same at once publish other chirps.
+func (c *ApiConfig) publishDueChirps(ctx context.Context) error {
+	for {
+		published, err := c.Database.PublishDueChirps(ctx, scheduledChirpBatch)
+		if err != nil {
+			return err
+		}
+		if len(published) < scheduledChirpBatch {
+			return nil
+		}
+	}
+}
+
+// StartScheduler publishes scheduled chirps in the background until ctx is
+// cancelled.
+func (c *ApiConfig) StartScheduler(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(scheduledChirpInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := c.publishDueChirps(ctx); err != nil {
+					log.Printf("error publishing scheduled chirps: %q", err)
+				}
+			}
+		}
+	}()
+}
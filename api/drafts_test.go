@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LahcenHaouch/goserver/internal/auth"
+	"github.com/LahcenHaouch/goserver/internal/database"
+	"github.com/google/uuid"
+)
+
+func postDraft(t *testing.T, c *ApiConfig, token string, publishAt time.Time) Chirp {
+	t.Helper()
+
+	body := `{"body":"later","publish_at":"` + publishAt.Format(time.RFC3339) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/drafts", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	c.HandleCreateDraft(rec, req)
+	if rec.Code != 201 {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+
+	var draft Chirp
+	if err := json.NewDecoder(rec.Body).Decode(&draft); err != nil {
+		t.Fatalf("error decoding draft: %q", err)
+	}
+	return draft
+}
+
+func chirpStatus(t *testing.T, c *ApiConfig, id uuid.UUID) string {
+	t.Helper()
+
+	var status string
+	if err := c.DB.QueryRow("SELECT status FROM chirps WHERE id = $1", id).Scan(&status); err != nil {
+		t.Fatalf("error reading chirp: %q", err)
+	}
+	return status
+}
+
+// The scheduler must publish at publish_at whatever time zone the database
+// session is in, not hours early or late.
+func TestScheduledChirpsPublishOnTime(t *testing.T) {
+	for _, tz := range []string{"UTC", "Asia/Tokyo", "America/New_York"} {
+		t.Run(tz, func(t *testing.T) {
+			c := testConfigWith(t, map[string]string{"timezone": tz})
+			user := createTestUser(t, c, "ann@example.com")
+			tokens := loginTestUser(t, c, user, uuid.NullUUID{}, nil)
+
+			later := postDraft(t, c, tokens.AccessToken, time.Now().Add(time.Hour))
+			due := postDraft(t, c, tokens.AccessToken, time.Now().Add(time.Hour))
+			if _, err := c.DB.Exec("UPDATE chirps SET publish_at = $2 WHERE id = $1", due.ID, time.Now().Add(-time.Second)); err != nil {
+				t.Fatalf("error moving publish_at: %q", err)
+			}
+
+			if err := c.publishDueChirps(context.Background()); err != nil {
+				t.Fatalf("error publishing chirps: %q", err)
+			}
+
+			if status := chirpStatus(t, c, later.ID); status != chirpStatusScheduled {
+				t.Fatalf("expected the chirp due in an hour to stay scheduled, got %s", status)
+			}
+			if status := chirpStatus(t, c, due.ID); status != chirpStatusPublished {
+				t.Fatalf("expected the due chirp to be published, got %s", status)
+			}
+		})
+	}
+}
+
+func TestUpdateDraftRequiresVerifiedEmail(t *testing.T) {
+	c := testConfig(t)
+	user := createTestUser(t, c, "ann@example.com")
+	tokens := loginTestUser(t, c, user, uuid.NullUUID{}, nil)
+	draft := postDraft(t, c, tokens.AccessToken, time.Now().Add(time.Hour))
+
+	c.RequireVerifiedEmail = true
+	req := httptest.NewRequest(http.MethodPut, "/api/drafts/"+draft.ID.String(), strings.NewReader(`{"body":"edited"}`))
+	req.SetPathValue("draftId", draft.ID.String())
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	rec := httptest.NewRecorder()
+	c.HandleUpdateDraft(rec, req)
+	if rec.Code != 403 {
+		t.Fatalf("expected 403, got %d", rec.Code)
+	}
+
+	if _, err := c.Database.MarkUserVerified(context.Background(), database.MarkUserVerifiedParams{ID: user.ID, Email: user.Email}); err != nil {
+		t.Fatalf("error verifying user: %q", err)
+	}
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPut, "/api/drafts/"+draft.ID.String(), strings.NewReader(`{"body":"edited"}`))
+	req.SetPathValue("draftId", draft.ID.String())
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	c.HandleUpdateDraft(rec, req)
+	if rec.Code != 200 {
+		t.Fatalf("expected 200 once verified, got %d", rec.Code)
+	}
+}
+
+func TestListDraftsRequiresReadScope(t *testing.T) {
+	c := testConfig(t)
+	user := createTestUser(t, c, "ann@example.com")
+	client := createTestClient(t, c, user, "s3cret")
+	tokens := loginTestUser(t, c, user, uuid.NullUUID{}, nil)
+	postDraft(t, c, tokens.AccessToken, time.Now().Add(time.Hour))
+
+	for _, tc := range []struct {
+		scope  string
+		status int
+	}{
+		{auth.ScopeChirpsWrite, 403},
+		{auth.ScopeChirpsRead, 200},
+	} {
+		clientTokens := loginTestUser(t, c, user, uuid.NullUUID{UUID: client.ID, Valid: true}, []string{tc.scope})
+		req := httptest.NewRequest(http.MethodGet, "/api/drafts", nil)
+		req.Header.Set("Authorization", "Bearer "+clientTokens.AccessToken)
+		rec := httptest.NewRecorder()
+		c.HandleListDrafts(rec, req)
+		if rec.Code != tc.status {
+			t.Fatalf("expected %d with %s, got %d", tc.status, tc.scope, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/LahcenHaouch/goserver/internal/auth"
+	"github.com/LahcenHaouch/goserver/internal/database"
+	"github.com/LahcenHaouch/goserver/internal/entities"
+	"github.com/LahcenHaouch/goserver/utils"
+	"github.com/lib/pq"
+)
+
+// HandleSetHandle sets the handle the user is mentioned by, or clears it
+// when empty. Handles are unique regardless of case.
+func (c *ApiConfig) HandleSetHandle(w http.ResponseWriter, r *http.Request) {
+	userId, err := c.authenticate(r, auth.ScopeAccountWrite)
+	if err != nil {
+		http.Error(w, "unauthorized", authStatus(err))
+		return
+	}
+
+	defer r.Body.Close()
+
+	var body struct {
+		Handle string `json:"handle"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "error parsing body", 400)
+		return
+	}
+
+	if body.Handle != "" && !entities.ValidHandle(body.Handle) {
+		respondWithFieldErrors(w, []auth.FieldError{{
+			Field:   "handle",
+			Code:    "invalid",
+			Message: fmt.Sprintf("handle must be at most %d letters, digits or underscores", entities.MaxHandleLength),
+		}})
+		return
+	}
+
+	user, err := c.Database.SetUserHandle(r.Context(), database.SetUserHandleParams{
+		ID:     userId,
+		Handle: sql.NullString{String: body.Handle, Valid: body.Handle != ""},
+	})
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		utils.RespondWithError(w, map[string]string{"error": "handle already taken"}, 409)
+		return
+	}
+	if err != nil {
+		http.Error(w, "error updating handle", 500)
+		return
+	}
+
+	utils.RespondWithJSON(w, parseDbUser(user), 200)
+}
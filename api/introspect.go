@@ -0,0 +1,186 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/LahcenHaouch/goserver/internal/auth"
+	"github.com/LahcenHaouch/goserver/utils"
+	"github.com/google/uuid"
+)
+
+// introspection is a token introspection response of RFC 7662. Inactive
+// tokens only get Active, so nothing is told about why they aren't.
+type introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+var inactive = introspection{Active: false}
+
+// introspectAccessToken describes an access token from login, an OAuth
+// client or a personal access token.
+func (c *ApiConfig) introspectAccessToken(r *http.Request, tokenStr string) introspection {
+	if auth.IsPersonalAccessToken(tokenStr) {
+		pat, err := c.Database.GetPersonalAccessTokenByHash(r.Context(), auth.HashToken(tokenStr))
+		if err != nil || pat.RevokedAt.Valid || (pat.ExpiresAt.Valid && time.Now().After(pat.ExpiresAt.Time)) {
+			return inactive
+		}
+
+		resp := introspection{
+			Active:   true,
+			Scope:    strings.Join(pat.Scopes, " "),
+			Subject:  pat.UserID.String(),
+			IssuedAt: pat.CreatedAt.Unix(),
+		}
+		if pat.ExpiresAt.Valid {
+			resp.ExpiresAt = pat.ExpiresAt.Time.Unix()
+		}
+		return resp
+	}
+
+	claims, err := c.parseAccessToken(r.Context(), tokenStr)
+	if err != nil {
+		return inactive
+	}
+
+	resp := introspection{
+		Active:  true,
+		Scope:   strings.Join(auth.AllScopes(), " "),
+		Subject: claims.Subject,
+	}
+	if claims.ExpiresAt != nil {
+		resp.ExpiresAt = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		resp.IssuedAt = claims.IssuedAt.Unix()
+	}
+	if claims.IsClientToken() {
+		resp.Scope = claims.Scope
+		resp.ClientID = claims.ClientID
+	}
+	return resp
+}
+
+func (c *ApiConfig) introspectRefreshToken(r *http.Request, tokenStr string) introspection {
+	token, err := c.Database.GetRefreshToken(r.Context(), tokenStr)
+	if err != nil || token.RevokedAt.Valid || !token.ExpiresAt.Valid || time.Now().After(token.ExpiresAt.Time) {
+		return inactive
+	}
+
+	session, err := c.Database.GetSession(r.Context(), token.FamilyID)
+	if err != nil {
+		log.Printf("error retrieving session %s: %q", token.FamilyID, err)
+		return inactive
+	}
+	if session.RevokedAt.Valid {
+		return inactive
+	}
+
+	resp := introspection{
+		Active:    true,
+		Scope:     strings.Join(auth.AllScopes(), " "),
+		Subject:   session.UserID.String(),
+		ExpiresAt: token.ExpiresAt.Time.Unix(),
+		IssuedAt:  token.CreatedAt.Time.Unix(),
+	}
+	if session.ClientID.Valid {
+		resp.Scope = strings.Join(session.Scopes, " ")
+		resp.ClientID = session.ClientID.UUID.String()
+	}
+	return resp
+}
+
+// HandleIntrospect tells a confidential client whether a token is active
+// and what it allows, as in RFC 7662. Clients only learn about the tokens
+// issued to them; the resource servers of IntrospectionClients learn about
+// any token. token_type_hint only decides which kind of token is looked up
+// first.
+func (c *ApiConfig) HandleIntrospect(w http.ResponseWriter, r *http.Request) {
+	client, ok := c.requireClient(w, r)
+	if !ok {
+		return
+	}
+
+	// a public client only proves its client_id, which is no secret
+	if !client.SecretHash.Valid {
+		respondWithOAuthError(w, 401, "invalid_client", "introspection requires client credentials")
+		return
+	}
+
+	tokenStr := r.PostForm.Get("token")
+	if tokenStr == "" {
+		respondWithOAuthError(w, 400, "invalid_request", "token is required")
+		return
+	}
+
+	lookups := []func(*http.Request, string) introspection{c.introspectAccessToken, c.introspectRefreshToken}
+	if r.PostForm.Get("token_type_hint") == "refresh_token" {
+		lookups[0], lookups[1] = lookups[1], lookups[0]
+	}
+
+	resp := inactive
+	for _, lookup := range lookups {
+		if resp = lookup(r, tokenStr); resp.Active {
+			break
+		}
+	}
+
+	if resp.Active && resp.ClientID != client.ID.String() && !slices.Contains(c.IntrospectionClients, client.ID) {
+		resp = inactive
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	utils.RespondWithJSON(w, resp, 200)
+}
+
+// revokeClientToken revokes a token issued to the calling client, as in
+// RFC 7009, ending the session it belongs to. Unknown tokens and tokens of
+// other clients are ignored, and the answer is 200 either way so clients
+// can't probe for tokens.
+func (c *ApiConfig) revokeClientToken(w http.ResponseWriter, r *http.Request) {
+	client, ok := c.requireClient(w, r)
+	if !ok {
+		return
+	}
+
+	tokenStr := r.PostForm.Get("token")
+	if tokenStr == "" {
+		respondWithOAuthError(w, 400, "invalid_request", "token is required")
+		return
+	}
+
+	var sessionId uuid.UUID
+	if claims, err := c.Keys.ParseJWT(tokenStr); err == nil {
+		if claims.ClientID == client.ID.String() {
+			sessionId = claims.Session()
+		}
+	} else if token, err := c.Database.GetRefreshToken(r.Context(), tokenStr); err == nil {
+		sessionId = token.FamilyID
+	}
+
+	if sessionId == uuid.Nil {
+		w.WriteHeader(200)
+		return
+	}
+
+	session, err := c.Database.GetSession(r.Context(), sessionId)
+	if err != nil || session.ClientID.UUID != client.ID {
+		w.WriteHeader(200)
+		return
+	}
+
+	if err := c.endSession(r, session.UserID, session.ID); err != nil {
+		respondWithOAuthError(w, 503, "temporarily_unavailable", "error revoking token")
+		return
+	}
+
+	w.WriteHeader(200)
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/LahcenHaouch/goserver/internal/auth"
+	"github.com/LahcenHaouch/goserver/internal/database"
+	"github.com/google/uuid"
+)
+
+func postForm(handler http.HandlerFunc, path string, form url.Values, client database.OauthClient, secret string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(client.ID.String(), secret)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func introspect(t *testing.T, c *ApiConfig, client database.OauthClient, secret, token string) (int, introspection) {
+	t.Helper()
+
+	rec := postForm(c.HandleIntrospect, "/oauth/introspect", url.Values{"token": {token}}, client, secret)
+	var resp introspection
+	if rec.Code == 200 {
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("error decoding response: %q", err)
+		}
+	}
+	return rec.Code, resp
+}
+
+func TestIntrospectRequiresConfidentialClient(t *testing.T) {
+	c := testConfig(t)
+	user := createTestUser(t, c, "owner@example.com")
+	public := createTestClient(t, c, user, "")
+	tokens := loginTestUser(t, c, user, uuid.NullUUID{UUID: public.ID, Valid: true}, []string{auth.ScopeChirpsRead})
+
+	if code, _ := introspect(t, c, public, "", tokens.AccessToken); code != 401 {
+		t.Fatalf("expected 401 for a public client, got %d", code)
+	}
+
+	confidential := createTestClient(t, c, user, "s3cret")
+	if code, _ := introspect(t, c, confidential, "wrong", tokens.AccessToken); code != 401 {
+		t.Fatalf("expected 401 for a wrong secret, got %d", code)
+	}
+}
+
+func TestIntrospectOnlyOwnTokens(t *testing.T) {
+	c := testConfig(t)
+	user := createTestUser(t, c, "owner@example.com")
+	client := createTestClient(t, c, user, "s3cret")
+	other := createTestClient(t, c, user, "0ther")
+
+	own := loginTestUser(t, c, user, uuid.NullUUID{UUID: client.ID, Valid: true}, []string{auth.ScopeChirpsRead})
+	others := loginTestUser(t, c, user, uuid.NullUUID{UUID: other.ID, Valid: true}, []string{auth.ScopeChirpsRead})
+	firstParty := loginTestUser(t, c, user, uuid.NullUUID{}, nil)
+
+	for _, token := range []string{own.AccessToken, own.RefreshToken} {
+		code, resp := introspect(t, c, client, "s3cret", token)
+		if code != 200 || !resp.Active || resp.ClientID != client.ID.String() || resp.Subject != user.ID.String() {
+			t.Fatalf("expected its own token to be active, got %d %+v", code, resp)
+		}
+	}
+
+	for _, token := range []string{others.AccessToken, others.RefreshToken, firstParty.AccessToken, firstParty.RefreshToken} {
+		code, resp := introspect(t, c, client, "s3cret", token)
+		if code != 200 || resp != inactive {
+			t.Fatalf("expected another's token to be inactive, got %d %+v", code, resp)
+		}
+	}
+}
+
+func TestIntrospectResourceServer(t *testing.T) {
+	c := testConfig(t)
+	user := createTestUser(t, c, "owner@example.com")
+	server := createTestClient(t, c, user, "s3cret")
+	c.IntrospectionClients = []uuid.UUID{server.ID}
+
+	tokens := loginTestUser(t, c, user, uuid.NullUUID{}, nil)
+	code, resp := introspect(t, c, server, "s3cret", tokens.AccessToken)
+	if code != 200 || !resp.Active || resp.Subject != user.ID.String() {
+		t.Fatalf("expected the token to be active, got %d %+v", code, resp)
+	}
+
+	if err := c.endSession(httptest.NewRequest(http.MethodPost, "/api/revoke", nil), user.ID, tokens.SessionID); err != nil {
+		t.Fatalf("error ending session: %q", err)
+	}
+	if code, resp := introspect(t, c, server, "s3cret", tokens.AccessToken); code != 200 || resp != inactive {
+		t.Fatalf("expected a revoked token to be inactive, got %d %+v", code, resp)
+	}
+}
+
+func TestRevokeBearerAndClient(t *testing.T) {
+	c := testConfig(t)
+	user := createTestUser(t, c, "owner@example.com")
+	client := createTestClient(t, c, user, "s3cret")
+
+	firstParty := loginTestUser(t, c, user, uuid.NullUUID{}, nil)
+	req := httptest.NewRequest(http.MethodPost, "/api/revoke", nil)
+	req.Header.Set("Authorization", "Bearer "+firstParty.RefreshToken)
+	rec := httptest.NewRecorder()
+	c.HandleRevoke(rec, req)
+	if rec.Code != 204 {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+
+	// a client can't revoke a token it wasn't issued
+	other := loginTestUser(t, c, user, uuid.NullUUID{}, nil)
+	if rec := postForm(c.HandleRevoke, "/oauth/revoke", url.Values{"token": {other.RefreshToken}}, client, "s3cret"); rec.Code != 200 {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if _, err := c.parseAccessToken(req.Context(), other.AccessToken); err != nil {
+		t.Fatalf("expected another's session to survive, got %q", err)
+	}
+
+	own := loginTestUser(t, c, user, uuid.NullUUID{UUID: client.ID, Valid: true}, []string{auth.ScopeChirpsRead})
+	if rec := postForm(c.HandleRevoke, "/oauth/revoke", url.Values{"token": {own.RefreshToken}}, client, "s3cret"); rec.Code != 200 {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if _, err := c.parseAccessToken(req.Context(), own.AccessToken); err == nil {
+		t.Fatalf("expected the revoked session's access token to be rejected")
+	}
+}
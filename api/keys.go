@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/LahcenHaouch/goserver/internal/auth"
+	"github.com/LahcenHaouch/goserver/internal/database"
+)
+
+const (
+	// keys are reloaded this often so every instance picks up a key rotated
+	// by another one
+	keyReloadInterval = time.Minute
+	// keyPublishDelay is how long a new key is only published before it
+	// signs, so every instance has reloaded and accepts its tokens
+	keyPublishDelay = 2 * keyReloadInterval
+	// unknownKeyReloadInterval bounds the reloads of tokens signed with a
+	// kid an instance doesn't hold yet
+	unknownKeyReloadInterval = 5 * time.Second
+)
+
+// LoadSigningKeys loads the active key and the keys retired recently enough
+// to still verify unexpired access tokens.
+func (c *ApiConfig) LoadSigningKeys(ctx context.Context) error {
+	dbKeys, err := c.Database.GetSigningKeys(ctx, sql.NullTime{Time: time.Now().Add(-accessTokenTTL), Valid: true})
+	if err != nil {
+		return err
+	}
+
+	keys := make([]*auth.SigningKey, 0, len(dbKeys))
+	for _, k := range dbKeys {
+		key, err := auth.ParseSigningKey(k.Kid, k.Algorithm, []byte(k.PrivateKey), k.CreatedAt, k.ActiveAt, k.RetiredAt.Time)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+
+	return c.Keys.Load(keys)
+}
+
+// RotateSigningKeys creates a new signing key when there is none or the
+// newest one is older than KeyRotation, then reloads the key ring. The new
+// key only signs after keyPublishDelay, the old one signing until then,
+// unless there is no key signing yet. An advisory lock makes instances
+// rotate one after the other, so the ones waiting see the new key.
+func (c *ApiConfig) RotateSigningKeys(ctx context.Context) error {
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := c.Database.WithTx(tx)
+
+	if err := qtx.LockSigningKeys(ctx); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	keys, err := qtx.GetSigningKeys(ctx, sql.NullTime{Time: now, Valid: true})
+	if err != nil {
+		return err
+	}
+
+	if len(keys) == 0 || keys[0].RetiredAt.Valid || now.Sub(keys[0].CreatedAt) >= c.KeyRotation {
+		key, err := auth.GenerateSigningKey(c.KeyAlgorithm)
+		if err != nil {
+			return err
+		}
+		key.ActiveAt = key.CreatedAt
+		if hasSigningKey(keys, now) {
+			key.ActiveAt = key.CreatedAt.Add(keyPublishDelay)
+		}
+
+		privateKey, err := key.MarshalPrivateKey()
+		if err != nil {
+			return err
+		}
+
+		if _, err := qtx.CreateSigningKey(ctx, database.CreateSigningKeyParams{
+			Kid:        key.ID,
+			CreatedAt:  key.CreatedAt,
+			Algorithm:  key.Algorithm,
+			PrivateKey: string(privateKey),
+			ActiveAt:   key.ActiveAt,
+		}); err != nil {
+			return err
+		}
+
+		if err := qtx.RetireSigningKeys(ctx, database.RetireSigningKeysParams{
+			Kid:       key.ID,
+			RetiredAt: sql.NullTime{Time: key.ActiveAt, Valid: true},
+		}); err != nil {
+			return err
+		}
+
+		if err := qtx.DeleteRetiredSigningKeys(ctx, sql.NullTime{Time: now.Add(-accessTokenTTL), Valid: true}); err != nil {
+			return err
+		}
+
+		log.Printf("rotated signing key, new kid: %s", key.ID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return c.LoadSigningKeys(ctx)
+}
+
+// hasSigningKey reports whether one of keys signs tokens at now.
+func hasSigningKey(keys []database.SigningKey, now time.Time) bool {
+	for _, k := range keys {
+		if !now.Before(k.ActiveAt) && (!k.RetiredAt.Valid || now.Before(k.RetiredAt.Time)) {
+			return true
+		}
+	}
+	return false
+}
+
+// reloadForUnknownKey reloads the key ring when a token is signed with a
+// kid it doesn't hold, in case another instance just created the key. It
+// returns whether it did.
+func (c *ApiConfig) reloadForUnknownKey(ctx context.Context) bool {
+	if !c.Keys.ReloadDue(time.Now(), unknownKeyReloadInterval) {
+		return false
+	}
+
+	if err := c.LoadSigningKeys(ctx); err != nil {
+		log.Printf("error reloading signing keys: %q", err)
+		return false
+	}
+	return true
+}
+
+// StartKeyRotation rotates and reloads signing keys in the background until
+// ctx is cancelled.
+func (c *ApiConfig) StartKeyRotation(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(keyReloadInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := c.RotateSigningKeys(ctx); err != nil {
+					log.Printf("error rotating signing keys: %q", err)
+				}
+			}
+		}
+	}()
+}
+
+func (c *ApiConfig) HandleJWKS(w http.ResponseWriter, r *http.Request) {
+	body, err := json.Marshal(c.Keys.JWKS())
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	w.Write(body)
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/LahcenHaouch/goserver/internal/auth"
+	"github.com/google/uuid"
+)
+
+// instance is another server sharing c's database, with its own key ring.
+func instance(c *ApiConfig) *ApiConfig {
+	return &ApiConfig{
+		DB:           c.DB,
+		Database:     c.Database,
+		Keys:         auth.NewKeyRing(),
+		KeyAlgorithm: c.KeyAlgorithm,
+		KeyRotation:  c.KeyRotation,
+	}
+}
+
+func TestRotateSigningKeysFreshDatabase(t *testing.T) {
+	c := testConfig(t)
+	if _, err := c.DB.Exec("DELETE FROM signing_keys"); err != nil {
+		t.Fatalf("error deleting keys: %q", err)
+	}
+
+	instances := make([]*ApiConfig, 5)
+	var wg sync.WaitGroup
+	for i := range instances {
+		instances[i] = instance(c)
+		wg.Add(1)
+		go func(c *ApiConfig) {
+			defer wg.Done()
+			if err := c.RotateSigningKeys(context.Background()); err != nil {
+				t.Errorf("error starting up: %q", err)
+			}
+		}(instances[i])
+	}
+	wg.Wait()
+
+	var count int
+	if err := c.DB.QueryRow("SELECT count(*) FROM signing_keys").Scan(&count); err != nil {
+		t.Fatalf("error counting keys: %q", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected one key, got %d", count)
+	}
+	for _, i := range instances {
+		if i.Keys.Active() == nil {
+			t.Fatalf("expected every instance to have a signing key")
+		}
+	}
+}
+
+func TestRotatedKeyIsPublishedFirst(t *testing.T) {
+	c := testConfig(t)
+	other := instance(c)
+	if err := other.LoadSigningKeys(context.Background()); err != nil {
+		t.Fatalf("error loading keys: %q", err)
+	}
+
+	oldKid := c.Keys.Active().ID
+	c.KeyRotation = 0
+	if err := c.RotateSigningKeys(context.Background()); err != nil {
+		t.Fatalf("error rotating keys: %q", err)
+	}
+	if kid := c.Keys.Active().ID; kid != oldKid {
+		t.Fatalf("expected the new key to wait before signing, got %s", kid)
+	}
+	if len(c.Keys.JWKS().Keys) != 2 {
+		t.Fatalf("expected the new key to be published")
+	}
+
+	// once the new key signs, an instance that hasn't reloaded yet fetches
+	// it when it sees its kid
+	if _, err := c.DB.Exec("UPDATE signing_keys SET active_at = NOW() - interval '1 second' WHERE kid <> $1", oldKid); err != nil {
+		t.Fatalf("error activating key: %q", err)
+	}
+	if _, err := c.DB.Exec("UPDATE signing_keys SET retired_at = NOW() - interval '1 second' WHERE kid = $1", oldKid); err != nil {
+		t.Fatalf("error retiring key: %q", err)
+	}
+	if err := c.LoadSigningKeys(context.Background()); err != nil {
+		t.Fatalf("error loading keys: %q", err)
+	}
+	if c.Keys.Active().ID == oldKid {
+		t.Fatalf("expected the new key to sign")
+	}
+
+	user := createTestUser(t, c, "ann@example.com")
+	tokens := loginTestUser(t, c, user, uuid.NullUUID{}, nil)
+	if _, err := other.parseAccessToken(context.Background(), tokens.AccessToken); err != nil {
+		t.Fatalf("expected a token of the new key to be accepted, got %q", err)
+	}
+}
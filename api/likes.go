@@ -0,0 +1,211 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LahcenHaouch/goserver/internal/auth"
+	"github.com/LahcenHaouch/goserver/internal/database"
+	"github.com/LahcenHaouch/goserver/utils"
+	"github.com/google/uuid"
+)
+
+// Like is a user liking a chirp.
+type Like struct {
+	UserID  uuid.UUID `json:"user_id"`
+	LikedAt time.Time `json:"liked_at"`
+}
+
+// viewer is the user behind the request's bearer token, if it has one.
+// Endpoints anyone can read use it to personalize their response, so a
+// token that doesn't authenticate, or lacks chirps:read, is read as no
+// token rather than turning the request down.
+func (c *ApiConfig) viewer(r *http.Request) uuid.NullUUID {
+	if r.Header.Get("Authorization") == "" {
+		return uuid.NullUUID{}
+	}
+
+	userId, err := c.authenticate(r, auth.ScopeChirpsRead)
+	if err != nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: userId, Valid: true}
+}
+
+// loadLikes fills in the like counts of chirps, and whether viewer liked
+// them when set.
+func (c *ApiConfig) loadLikes(ctx context.Context, chirps []Chirp, viewer uuid.NullUUID) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(chirps))
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.ID)
+	}
+
+	counts, err := c.Database.CountChirpLikes(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	likes := make(map[uuid.UUID]int64, len(counts))
+	for _, count := range counts {
+		likes[count.ChirpID] = count.Likes
+	}
+	for i := range chirps {
+		chirps[i].LikeCount = likes[chirps[i].ID]
+	}
+
+	if !viewer.Valid {
+		return nil
+	}
+
+	liked, err := c.Database.ListLikedChirpIDs(ctx, database.ListLikedChirpIDsParams{
+		UserID:   viewer.UUID,
+		ChirpIds: ids,
+	})
+	if err != nil {
+		return err
+	}
+
+	likedByMe := make(map[uuid.UUID]bool, len(liked))
+	for _, id := range liked {
+		likedByMe[id] = true
+	}
+	for i := range chirps {
+		l := likedByMe[chirps[i].ID]
+		chirps[i].LikedByMe = &l
+	}
+
+	return nil
+}
+
+// HandleLikeChirp likes a chirp. Liking it again changes nothing.
+func (c *ApiConfig) HandleLikeChirp(w http.ResponseWriter, r *http.Request) {
+	userId, err := c.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		http.Error(w, "unauthorized", authStatus(err))
+		return
+	}
+
+	chirpId, err := uuid.Parse(r.PathValue("chirpId"))
+	if err != nil {
+		http.Error(w, "bad request", 400)
+		return
+	}
+
+	if _, err := c.Database.GetPublishedChirp(r.Context(), chirpId); err != nil {
+		http.Error(w, "not found", 404)
+		return
+	}
+
+	if _, err := c.Database.LikeChirp(r.Context(), database.LikeChirpParams{
+		ChirpID: chirpId,
+		UserID:  userId,
+	}); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// HandleUnlikeChirp takes back a like. Chirps that weren't liked are fine.
+func (c *ApiConfig) HandleUnlikeChirp(w http.ResponseWriter, r *http.Request) {
+	userId, err := c.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		http.Error(w, "unauthorized", authStatus(err))
+		return
+	}
+
+	chirpId, err := uuid.Parse(r.PathValue("chirpId"))
+	if err != nil {
+		http.Error(w, "bad request", 400)
+		return
+	}
+
+	if _, err := c.Database.UnlikeChirp(r.Context(), database.UnlikeChirpParams{
+		ChirpID: chirpId,
+		UserID:  userId,
+	}); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// HandleListChirpLikes lists who liked a chirp, latest first, paginated
+// with limit and cursor like HandleGetChirps.
+func (c *ApiConfig) HandleListChirpLikes(w http.ResponseWriter, r *http.Request) {
+	chirpId, err := uuid.Parse(r.PathValue("chirpId"))
+	if err != nil {
+		http.Error(w, "bad request", 400)
+		return
+	}
+
+	query := r.URL.Query()
+	params := database.ListChirpLikesParams{ChirpID: chirpId, Limit: defaultChirpLimit}
+
+	// a like's position has the same shape as a chirp's, with the user
+	// in place of the chirp id
+	if v := query.Get("cursor"); v != "" {
+		cursor, err := parseChirpCursor(v)
+		if err != nil {
+			http.Error(w, "invalid cursor", 400)
+			return
+		}
+		params.BeforeCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		params.BeforeUserID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxChirpLimit {
+			http.Error(w, "invalid limit", 400)
+			return
+		}
+		params.Limit = int32(limit)
+	}
+
+	if _, err := c.Database.GetPublishedChirp(r.Context(), chirpId); err != nil {
+		http.Error(w, "not found", 404)
+		return
+	}
+
+	// one more than asked tells us whether there is a next page
+	limit := params.Limit
+	params.Limit++
+
+	likes, err := c.Database.ListChirpLikes(r.Context(), params)
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	type response struct {
+		Likes      []Like  `json:"likes"`
+		NextCursor *string `json:"next_cursor"`
+	}
+
+	resp := response{Likes: make([]Like, 0, len(likes))}
+	links := []string{c.chirpsLink(r, "", "first")}
+	if len(likes) > int(limit) {
+		likes = likes[:limit]
+		last := likes[len(likes)-1]
+		cursor := chirpCursor{CreatedAt: last.CreatedAt, ID: last.UserID}.String()
+		resp.NextCursor = &cursor
+		links = append(links, c.chirpsLink(r, cursor, "next"))
+	}
+	for _, like := range likes {
+		resp.Likes = append(resp.Likes, Like{UserID: like.UserID, LikedAt: like.CreatedAt})
+	}
+
+	w.Header().Set("Link", strings.Join(links, ", "))
+	utils.RespondWithJSON(w, resp, 200)
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/LahcenHaouch/goserver/internal/auth"
+	"github.com/LahcenHaouch/goserver/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestViewerIgnoresBadToken(t *testing.T) {
+	c := &ApiConfig{Keys: auth.NewKeyRing()}
+
+	for _, header := range []string{"", "Bearer not-a-jwt", "Bearer", "Basic dXNlcjpwYXNz"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/chirps", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		if viewer := c.viewer(req); viewer.Valid {
+			t.Fatalf("expected no viewer for %q, got %s", header, viewer.UUID)
+		}
+	}
+}
+
+func TestGetChirpsWithUnusableToken(t *testing.T) {
+	c := testConfig(t)
+	user := createTestUser(t, c, "ann@example.com")
+	chirp := createTestChirp(t, c, user, "hello")
+
+	revoked := loginTestUser(t, c, user, uuid.NullUUID{}, nil)
+	if err := c.endSession(httptest.NewRequest(http.MethodPost, "/api/revoke", nil), user.ID, revoked.SessionID); err != nil {
+		t.Fatalf("error ending session: %q", err)
+	}
+
+	pat, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		t.Fatalf("error making token: %q", err)
+	}
+	if _, err := c.Database.CreatePersonalAccessToken(context.Background(), database.CreatePersonalAccessTokenParams{
+		UserID:    user.ID,
+		Name:      "writer",
+		TokenHash: auth.HashToken(pat),
+		Scopes:    []string{auth.ScopeChirpsWrite},
+		ExpiresAt: sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true},
+	}); err != nil {
+		t.Fatalf("error creating token: %q", err)
+	}
+
+	tokens := map[string]string{
+		"garbage":       "not-a-jwt",
+		"revoked":       revoked.AccessToken,
+		"missing scope": pat,
+	}
+	for name, token := range tokens {
+		for path, handler := range map[string]http.HandlerFunc{
+			"/api/chirps":                      c.HandleGetChirps,
+			"/api/chirps/" + chirp.ID.String(): c.HandleGetChirp,
+		} {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.SetPathValue("chirpId", chirp.ID.String())
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != 200 {
+				t.Fatalf("%s token on %s: expected 200, got %d", name, path, rec.Code)
+			}
+
+			var resp struct {
+				Chirps    []map[string]any `json:"chirps"`
+				LikedByMe *bool            `json:"liked_by_me"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("error decoding response: %q", err)
+			}
+			if resp.LikedByMe != nil {
+				t.Fatalf("%s token on %s: expected no liked_by_me", name, path)
+			}
+			for _, got := range resp.Chirps {
+				if _, ok := got["liked_by_me"]; ok {
+					t.Fatalf("%s token on %s: expected no liked_by_me, got %v", name, path, got)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LahcenHaouch/goserver/internal/lockout"
+	"github.com/google/uuid"
+)
+
+var (
+	accountLoginPolicy = lockout.Policy{
+		FreeAttempts:    5,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute * 5,
+		LockoutAfter:    15,
+		LockoutDuration: time.Minute * 30,
+		Window:          time.Hour * 24,
+	}
+	// many users can share an IP, so it gets more room than an account
+	ipLoginPolicy = lockout.Policy{
+		FreeAttempts:    20,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute * 5,
+		LockoutAfter:    100,
+		LockoutDuration: time.Hour,
+		Window:          time.Hour * 24,
+	}
+)
+
+type loginKey struct {
+	key    string
+	policy lockout.Policy
+}
+
+func (c *ApiConfig) passwordLoginKeys(r *http.Request, email string) []loginKey {
+	return []loginKey{
+		{key: "account:" + strings.ToLower(email), policy: accountLoginPolicy},
+		{key: "ip:" + c.clientIP(r), policy: ipLoginPolicy},
+	}
+}
+
+func (c *ApiConfig) mfaLoginKeys(r *http.Request, userId uuid.UUID) []loginKey {
+	return []loginKey{
+		{key: "mfa:" + userId.String(), policy: accountLoginPolicy},
+		{key: "ip:" + c.clientIP(r), policy: ipLoginPolicy},
+	}
+}
+
+// reserveLoginAttempt counts an attempt against every key as failed before
+// it is checked, so parallel attempts can't slip past the backoff together.
+// It answers 429 with a Retry-After header and returns false when any of
+// keys is still backing off. Attempts that succeed are taken back with
+// resetLoginFailures.
+func (c *ApiConfig) reserveLoginAttempt(w http.ResponseWriter, r *http.Request, keys []loginKey) bool {
+	var wait time.Duration
+
+	for _, k := range keys {
+		d, err := c.LoginLimiter.Reserve(r.Context(), k.key, k.policy)
+		if err != nil {
+			http.Error(w, "internal server error", 500)
+			return false
+		}
+		if d > wait {
+			wait = d
+		}
+	}
+
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "too many failed login attempts", 429)
+		return false
+	}
+
+	return true
+}
+
+// resetLoginFailures clears the account's counter after a successful login
+// and takes back the attempt reserved on the others. The IP counter is not
+// cleared so one valid account can't be used to reset the counter while
+// guessing passwords of others.
+func (c *ApiConfig) resetLoginFailures(ctx context.Context, keys []loginKey) {
+	if err := c.LoginLimiter.Reset(ctx, keys[0].key); err != nil {
+		log.Printf("error resetting failed logins for %s: %q", keys[0].key, err)
+	}
+	for _, k := range keys[1:] {
+		if err := c.LoginLimiter.Release(ctx, k.key); err != nil {
+			log.Printf("error releasing login attempt for %s: %q", k.key, err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func login(c *ApiConfig, email, password string) int {
+	req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"email":"`+email+`","password":"`+password+`"}`))
+	rec := httptest.NewRecorder()
+	c.HandleLogin(rec, req)
+	return rec.Code
+}
+
+func TestLoginBackoffUnderConcurrency(t *testing.T) {
+	c := testConfig(t)
+	createTestUser(t, c, "ann@example.com")
+
+	var mu sync.Mutex
+	codes := map[int]int{}
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code := login(c, "ann@example.com", "wrong password")
+			mu.Lock()
+			codes[code]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if codes[401] != accountLoginPolicy.FreeAttempts || codes[429] != 30-accountLoginPolicy.FreeAttempts {
+		t.Fatalf("expected %d guesses to be checked and the rest refused, got %v", accountLoginPolicy.FreeAttempts, codes)
+	}
+
+	if code := login(c, "ann@example.com", testPassword); code != 429 {
+		t.Fatalf("expected the account to be backing off, got %d", code)
+	}
+}
+
+func TestLoginSuccessReleasesAttempts(t *testing.T) {
+	c := testConfig(t)
+	createTestUser(t, c, "ann@example.com")
+
+	// more than the IP is allowed to fail
+	for i := 0; i < ipLoginPolicy.FreeAttempts+5; i++ {
+		if code := login(c, "ann@example.com", testPassword); code != 200 {
+			t.Fatalf("login %d: expected 200, got %d", i+1, code)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/LahcenHaouch/goserver/internal/auth"
+	"github.com/LahcenHaouch/goserver/internal/database"
+	"github.com/LahcenHaouch/goserver/internal/mail"
+)
+
+const magicLinkTTL = time.Minute * 15
+
+// HandleMagicLink mails a single-use login link to the given address. Like
+// HandlePasswordReset it answers 202 whether or not the account exists.
+func (c *ApiConfig) HandleMagicLink(w http.ResponseWriter, r *http.Request) {
+	type request struct {
+		Email string `json:"email"`
+	}
+
+	defer r.Body.Close()
+
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "error parsing request", 400)
+		return
+	}
+
+	user, err := c.Database.GetUser(r.Context(), sql.NullString{String: req.Email, Valid: true})
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(202)
+		return
+	}
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	token, err := auth.MakeToken()
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	if _, err := c.Database.CreateMagicLink(r.Context(), database.CreateMagicLinkParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		Email:     user.Email.String,
+		ExpiresAt: time.Now().Add(magicLinkTTL),
+	}); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	link := fmt.Sprintf("%s/api/login/magic/callback?token=%s", c.BaseURL, url.QueryEscape(token))
+
+	if err := c.Mailer.Send(r.Context(), mail.Message{
+		To:      user.Email.String,
+		Subject: "Log in to Chirpy",
+		Body: fmt.Sprintf("Open this link within the next 15 minutes to log in to Chirpy:\n\n%s\n\n"+
+			"It only works once. If you didn't ask for it, you can ignore this email.", link),
+	}); err != nil {
+		log.Printf("error sending magic link mail: %q", err)
+	}
+
+	w.WriteHeader(202)
+}
+
+var magicLinkPage = template.Must(template.New("magic_link").Parse(`<!DOCTYPE html>
+<html>
+	<head>
+		<title>Log in to Chirpy</title>
+	</head>
+	<body>
+		<h1>Log in to Chirpy</h1>
+		<form method="post" action="/api/login/magic/callback">
+			<input type="hidden" name="token" value="{{.Token}}">
+			<button type="submit">Log in</button>
+		</form>
+	</body>
+</html>
+`))
+
+// HandleMagicLinkPage asks the user to confirm the login of a magic link.
+// Mail scanners and link previews follow links with GET, so opening one
+// must not use it up.
+func (c *ApiConfig) HandleMagicLinkPage(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "missing token", 400)
+		return
+	}
+
+	// the token is in the URL, so it must not leak to other sites
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+
+	if err := magicLinkPage.Execute(w, map[string]any{"Token": token}); err != nil {
+		log.Printf("error rendering magic link page: %q", err)
+	}
+}
+
+// HandleMagicLinkCallback logs the user in from the form of
+// HandleMagicLinkPage, answering like HandleLogin. The link only stands in
+// for the password, so users with two-factor authentication still have to
+// enter their code.
+func (c *ApiConfig) HandleMagicLinkCallback(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "error parsing form", 400)
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		http.Error(w, "missing token", 400)
+		return
+	}
+
+	link, err := c.Database.UseMagicLink(r.Context(), auth.HashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "invalid or expired link", 401)
+		return
+	}
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	user, err := c.Database.GetUserByID(r.Context(), link.UserID)
+	if err != nil {
+		http.Error(w, "invalid or expired link", 401)
+		return
+	}
+
+	// the email changed after this link was sent
+	if user.Email.String != link.Email {
+		http.Error(w, "invalid or expired link", 401)
+		return
+	}
+
+	// using the link proves the user owns the address
+	if !user.VerifiedAt.Valid {
+		verified, err := c.Database.MarkUserVerified(r.Context(), database.MarkUserVerifiedParams{
+			ID:    user.ID,
+			Email: user.Email,
+		})
+		if err != nil {
+			log.Printf("error verifying email of user %s: %q", user.ID, err)
+		} else if verified > 0 {
+			user.VerifiedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		}
+	}
+
+	hasTOTP, err := c.hasTOTP(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+	if hasTOTP {
+		c.respondWithMFAPending(w, user.ID)
+		return
+	}
+
+	c.respondWithLogin(w, r, user)
+}
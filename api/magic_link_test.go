@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LahcenHaouch/goserver/internal/auth"
+	"github.com/LahcenHaouch/goserver/internal/database"
+)
+
+func TestMagicLinkPageOnlyAsks(t *testing.T) {
+	c := &ApiConfig{}
+
+	rec := httptest.NewRecorder()
+	c.HandleMagicLinkPage(rec, httptest.NewRequest(http.MethodGet, "/api/login/magic/callback?token=abc%22def", nil))
+	if rec.Code != 200 {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `<form method="post"`) {
+		t.Fatalf("expected a confirmation form, got %s", rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), `value="abc&#34;def"`) {
+		t.Fatalf("expected the escaped token in the form, got %s", rec.Body)
+	}
+	if rec.Header().Get("Referrer-Policy") != "no-referrer" {
+		t.Fatalf("expected the token to be kept out of referrers")
+	}
+}
+
+func TestMagicLinkUsedOnlyByPost(t *testing.T) {
+	c := testConfig(t)
+	user := createTestUser(t, c, "magic@example.com")
+
+	token, err := auth.MakeToken()
+	if err != nil {
+		t.Fatalf("error making token: %q", err)
+	}
+	if _, err := c.Database.CreateMagicLink(context.Background(), database.CreateMagicLinkParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		Email:     user.Email.String,
+		ExpiresAt: time.Now().Add(magicLinkTTL),
+	}); err != nil {
+		t.Fatalf("error creating magic link: %q", err)
+	}
+
+	rec := httptest.NewRecorder()
+	c.HandleMagicLinkPage(rec, httptest.NewRequest(http.MethodGet, "/api/login/magic/callback?token="+url.QueryEscape(token), nil))
+	if rec.Code != 200 {
+		t.Fatalf("expected 200 for the page, got %d", rec.Code)
+	}
+
+	verified, err := c.Database.GetUserByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("error getting user: %q", err)
+	}
+	if verified.VerifiedAt.Valid {
+		t.Fatalf("expected the email to stay unverified until the form is sent")
+	}
+
+	post := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/api/login/magic/callback", strings.NewReader(url.Values{"token": {token}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		c.HandleMagicLinkCallback(rec, req)
+		return rec.Code
+	}
+
+	if code := post(); code != 200 {
+		t.Fatalf("expected 200 for the first login, got %d", code)
+	}
+	if code := post(); code != 401 {
+		t.Fatalf("expected 401 for a used link, got %d", code)
+	}
+
+	verified, err = c.Database.GetUserByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("error getting user: %q", err)
+	}
+	if !verified.VerifiedAt.Valid {
+		t.Fatalf("expected the email to be verified by the login")
+	}
+}
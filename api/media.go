@@ -0,0 +1,298 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/LahcenHaouch/goserver/internal/auth"
+	"github.com/LahcenHaouch/goserver/internal/database"
+	"github.com/LahcenHaouch/goserver/internal/media"
+	"github.com/LahcenHaouch/goserver/utils"
+	"github.com/google/uuid"
+)
+
+const (
+	maxMediaBytes = 5 << 20
+	maxChirpMedia = 4
+)
+
+var errInvalidMedia = errors.New("media_ids must be distinct media you uploaded")
+
+// Media is an image uploaded to be attached to chirps.
+type Media struct {
+	ID           uuid.UUID `json:"id"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	Width        int32     `json:"width"`
+	Height       int32     `json:"height"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (c *ApiConfig) parseDbMedia(m database.MediaFile) Media {
+	url := c.BaseURL + "/media/" + m.ID.String()
+	return Media{
+		ID:           m.ID,
+		ContentType:  m.ContentType,
+		Size:         m.SizeBytes,
+		Width:        m.Width,
+		Height:       m.Height,
+		URL:          url,
+		ThumbnailURL: url + "/thumbnail",
+		CreatedAt:    m.CreatedAt,
+	}
+}
+
+// attachMedia attaches media to a new chirp in the order given. Only the
+// chirp's author's own uploads can be attached.
+func attachMedia(ctx context.Context, q *database.Queries, userId, chirpId uuid.UUID, ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	files, err := q.GetMediaFilesByIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	owned := make(map[uuid.UUID]bool, len(files))
+	for _, f := range files {
+		owned[f.ID] = f.UserID == userId
+	}
+
+	seen := make(map[uuid.UUID]bool, len(ids))
+	for i, id := range ids {
+		if !owned[id] || seen[id] {
+			return errInvalidMedia
+		}
+		seen[id] = true
+
+		if err := q.CreateChirpMediaFile(ctx, database.CreateChirpMediaFileParams{
+			ChirpID:  chirpId,
+			MediaID:  id,
+			Position: int32(i),
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadMedia fills in the media of chirps.
+func (c *ApiConfig) loadMedia(ctx context.Context, chirps []Chirp) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(chirps))
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.ID)
+	}
+
+	rows, err := c.Database.ListChirpMediaFiles(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	byChirp := make(map[uuid.UUID][]Media)
+	for _, row := range rows {
+		byChirp[row.ChirpID] = append(byChirp[row.ChirpID], c.parseDbMedia(database.MediaFile{
+			ID:                   row.ID,
+			UserID:               row.UserID,
+			ContentType:          row.ContentType,
+			SizeBytes:            row.SizeBytes,
+			Width:                row.Width,
+			Height:               row.Height,
+			StorageKey:           row.StorageKey,
+			ThumbnailKey:         row.ThumbnailKey,
+			ThumbnailContentType: row.ThumbnailContentType,
+			CreatedAt:            row.CreatedAt,
+		}))
+	}
+
+	// a chirp may be listed twice, such as when it is also embedded
+	for i := range chirps {
+		chirps[i].Media = append(chirps[i].Media, byChirp[chirps[i].ID]...)
+	}
+
+	return nil
+}
+
+// readUpload returns the "file" part of a multipart upload. It answers the
+// request and returns false when there isn't one or it is too large.
+func readUpload(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	// room for the multipart headers around the file
+	r.Body = http.MaxBytesReader(w, r.Body, maxMediaBytes+64<<10)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		utils.RespondWithError(w, map[string]string{"error": "expected a multipart/form-data body"}, 400)
+		return nil, false
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			utils.RespondWithError(w, map[string]string{"error": "missing file"}, 400)
+			return nil, false
+		}
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			utils.RespondWithError(w, map[string]string{"error": "file larger than 5 MiB"}, 413)
+			return nil, false
+		}
+		if err != nil {
+			utils.RespondWithError(w, map[string]string{"error": "error reading upload"}, 400)
+			return nil, false
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(part, maxMediaBytes+1))
+		if errors.As(err, &maxBytesErr) || len(data) > maxMediaBytes {
+			utils.RespondWithError(w, map[string]string{"error": "file larger than 5 MiB"}, 413)
+			return nil, false
+		}
+		if err != nil {
+			utils.RespondWithError(w, map[string]string{"error": "error reading upload"}, 400)
+			return nil, false
+		}
+		return data, true
+	}
+}
+
+// HandleUploadMedia takes an image as the "file" field of a multipart form.
+// What the file is comes from its content, not from what the client says;
+// it is stored without its metadata, next to a thumbnail.
+func (c *ApiConfig) HandleUploadMedia(w http.ResponseWriter, r *http.Request) {
+	userId, err := c.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		http.Error(w, "unauthorized", authStatus(err))
+		return
+	}
+
+	if !c.checkCanPost(w, r, userId) {
+		return
+	}
+
+	defer r.Body.Close()
+
+	data, ok := readUpload(w, r)
+	if !ok {
+		return
+	}
+
+	img, err := media.Process(data)
+	if errors.Is(err, media.ErrUnsupportedType) {
+		utils.RespondWithError(w, map[string]string{"error": "only JPEG, PNG and GIF images are accepted"}, 415)
+		return
+	}
+	if errors.Is(err, media.ErrTooManyPixels) {
+		utils.RespondWithError(w, map[string]string{"error": "image dimensions too large"}, 413)
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, map[string]string{"error": "error decoding image"}, 400)
+		return
+	}
+
+	id := uuid.New()
+	params := database.CreateMediaFileParams{
+		ID:                   id,
+		UserID:               userId,
+		ContentType:          img.ContentType,
+		SizeBytes:            int64(len(img.Data)),
+		Width:                int32(img.Width),
+		Height:               int32(img.Height),
+		StorageKey:           "media/" + id.String() + media.Ext(img.ContentType),
+		ThumbnailKey:         "media/" + id.String() + "_thumb" + media.Ext(img.ThumbnailContentType),
+		ThumbnailContentType: img.ThumbnailContentType,
+	}
+
+	if err := c.Media.Put(r.Context(), params.StorageKey, img.Data, img.ContentType); err != nil {
+		log.Printf("error storing media %s: %q", id, err)
+		http.Error(w, "internal server error", 500)
+		return
+	}
+	if err := c.Media.Put(r.Context(), params.ThumbnailKey, img.Thumbnail, img.ThumbnailContentType); err != nil {
+		log.Printf("error storing media %s: %q", id, err)
+		c.deleteBlobs(r.Context(), params.StorageKey)
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	file, err := c.Database.CreateMediaFile(r.Context(), params)
+	if err != nil {
+		c.deleteBlobs(r.Context(), params.StorageKey, params.ThumbnailKey)
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	utils.RespondWithJSON(w, c.parseDbMedia(file), 201)
+}
+
+// deleteBlobs removes blobs whose rows are gone or were never written.
+// Failures are only logged: what's left is unreachable.
+func (c *ApiConfig) deleteBlobs(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		if err := c.Media.Delete(ctx, key); err != nil {
+			log.Printf("error deleting blob %s: %q", key, err)
+		}
+	}
+}
+
+func (c *ApiConfig) HandleGetMedia(w http.ResponseWriter, r *http.Request) {
+	c.serveMedia(w, r, false)
+}
+
+func (c *ApiConfig) HandleGetMediaThumbnail(w http.ResponseWriter, r *http.Request) {
+	c.serveMedia(w, r, true)
+}
+
+// serveMedia sends an upload, or its thumbnail. Their content never changes,
+// so they can be cached for good.
+func (c *ApiConfig) serveMedia(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	mediaId, err := uuid.Parse(r.PathValue("mediaId"))
+	if err != nil {
+		http.Error(w, "not found", 404)
+		return
+	}
+
+	file, err := c.Database.GetMediaFile(r.Context(), mediaId)
+	if err != nil {
+		http.Error(w, "not found", 404)
+		return
+	}
+
+	key, contentType := file.StorageKey, file.ContentType
+	if thumbnail {
+		key, contentType = file.ThumbnailKey, file.ThumbnailContentType
+	}
+
+	blob, err := c.Media.Get(r.Context(), key)
+	if errors.Is(err, media.ErrNotFound) {
+		http.Error(w, "not found", 404)
+		return
+	}
+	if err != nil {
+		log.Printf("error fetching media %s: %q", mediaId, err)
+		http.Error(w, "internal server error", 500)
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	if _, err := io.Copy(w, blob); err != nil {
+		log.Printf("error sending media %s: %q", mediaId, err)
+	}
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func uploadMedia(t *testing.T, c *ApiConfig, token string, data []byte) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "upload")
+	if err != nil {
+		t.Fatalf("error creating form: %q", err)
+	}
+	part.Write(data)
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/media", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	c.HandleUploadMedia(rec, req)
+	return rec
+}
+
+func TestUploadMediaRequiresToken(t *testing.T) {
+	c := &ApiConfig{}
+	if rec := uploadMedia(t, c, "", []byte("GIF89a")); rec.Code != 401 {
+		t.Fatalf("expected 401, got %d", rec.Code)
+	}
+}
+
+func TestUploadMediaRejectsTooManyGIFFrames(t *testing.T) {
+	c := testConfig(t)
+	user := createTestUser(t, c, "ann@example.com")
+	tokens := loginTestUser(t, c, user, uuid.NullUUID{}, nil)
+
+	bounds := image.Rect(0, 0, 1, 1)
+	g := &gif.GIF{Config: image.Config{Width: 1, Height: 1}}
+	// one frame more than media.Process takes
+	for i := 0; i < 501; i++ {
+		g.Image = append(g.Image, image.NewPaletted(bounds, palette.Plan9))
+		g.Delay = append(g.Delay, 1)
+	}
+	var data bytes.Buffer
+	if err := gif.EncodeAll(&data, g); err != nil {
+		t.Fatalf("error encoding gif: %q", err)
+	}
+
+	if rec := uploadMedia(t, c, tokens.AccessToken, data.Bytes()); rec.Code != 413 {
+		t.Fatalf("expected 413, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+// Uploads are served from our origin, so they must never be sniffed into
+// something a browser would run.
+func TestServeMediaHeaders(t *testing.T) {
+	c := testConfig(t)
+	user := createTestUser(t, c, "ann@example.com")
+	tokens := loginTestUser(t, c, user, uuid.NullUUID{}, nil)
+
+	var data bytes.Buffer
+	if err := png.Encode(&data, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatalf("error encoding png: %q", err)
+	}
+
+	rec := uploadMedia(t, c, tokens.AccessToken, data.Bytes())
+	if rec.Code != 201 {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+	var uploaded Media
+	if err := json.NewDecoder(rec.Body).Decode(&uploaded); err != nil {
+		t.Fatalf("error decoding media: %q", err)
+	}
+
+	for _, thumbnail := range []bool{false, true} {
+		req := httptest.NewRequest(http.MethodGet, "/media/"+uploaded.ID.String(), nil)
+		req.SetPathValue("mediaId", uploaded.ID.String())
+		rec := httptest.NewRecorder()
+		c.serveMedia(rec, req, thumbnail)
+		if rec.Code != 200 {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		if got := rec.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+			t.Fatalf("expected nosniff, got %q", got)
+		}
+		if got := rec.Header().Get("Content-Security-Policy"); got != "default-src 'none'" {
+			t.Fatalf("expected a CSP blocking everything, got %q", got)
+		}
+		if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "image/") {
+			t.Fatalf("expected an image content type, got %q", got)
+		}
+	}
+}
@@ -0,0 +1,675 @@
+package api
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/LahcenHaouch/goserver/internal/auth"
+	"github.com/LahcenHaouch/goserver/internal/database"
+	"github.com/LahcenHaouch/goserver/utils"
+	"github.com/google/uuid"
+)
+
+const authorizationCodeTTL = time.Minute * 10
+
+var scopeDescriptions = map[string]string{
+	auth.ScopeChirpsRead:   "Read your drafts and scheduled chirps",
+	auth.ScopeChirpsWrite:  "Post and delete chirps as you",
+	auth.ScopeAccountWrite: "Change your handle",
+}
+
+type OAuthClient struct {
+	ID           uuid.UUID `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Confidential bool      `json:"confidential"`
+	CreatedAt    time.Time `json:"created_at"`
+	// Secret is only set in the response to the creation of a confidential
+	// client.
+	Secret string `json:"client_secret,omitempty"`
+}
+
+func parseDbOAuthClient(client database.OauthClient) OAuthClient {
+	return OAuthClient{
+		ID:           client.ID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectUris,
+		Confidential: client.SecretHash.Valid,
+		CreatedAt:    client.CreatedAt,
+	}
+}
+
+// oauthError is an error response of RFC 6749 section 5.2, or the
+// parameters of an error redirect of section 4.1.2.1.
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *oauthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func respondWithOAuthError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Cache-Control", "no-store")
+	utils.RespondWithJSON(w, oauthError{Code: code, Description: description}, status)
+}
+
+// validRedirectURI only accepts absolute https URIs, or http ones on the
+// loopback interface for apps under development.
+func validRedirectURI(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.Fragment != "" {
+		return false
+	}
+
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	default:
+		return false
+	}
+}
+
+func (c *ApiConfig) HandleCreateOAuthClient(w http.ResponseWriter, r *http.Request) {
+	type request struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		// Confidential clients run on a server and get a secret; public
+		// ones, such as mobile apps, rely on PKCE alone.
+		Confidential bool `json:"confidential"`
+	}
+
+	userId, err := c.authenticateSession(r)
+	if err != nil {
+		http.Error(w, "unauthorized", 401)
+		return
+	}
+
+	defer r.Body.Close()
+
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "error parsing request", 400)
+		return
+	}
+
+	if req.Name == "" || len(req.RedirectURIs) == 0 {
+		http.Error(w, "name and redirect_uris are required", 400)
+		return
+	}
+	for _, uri := range req.RedirectURIs {
+		if !validRedirectURI(uri) {
+			http.Error(w, "redirect uris must be absolute https uris without a fragment", 400)
+			return
+		}
+	}
+
+	var secret string
+	var secretHash sql.NullString
+	if req.Confidential {
+		if secret, err = auth.MakeToken(); err != nil {
+			http.Error(w, "internal server error", 500)
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+
+	client, err := c.Database.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		OwnerID:      userId,
+		Name:         req.Name,
+		SecretHash:   secretHash,
+		RedirectUris: req.RedirectURIs,
+	})
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	resp := parseDbOAuthClient(client)
+	resp.Secret = secret
+
+	utils.RespondWithJSON(w, resp, 201)
+}
+
+func (c *ApiConfig) HandleListOAuthClients(w http.ResponseWriter, r *http.Request) {
+	userId, err := c.authenticateSession(r)
+	if err != nil {
+		http.Error(w, "unauthorized", 401)
+		return
+	}
+
+	clients, err := c.Database.ListOAuthClients(r.Context(), userId)
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	resp := make([]OAuthClient, 0, len(clients))
+	for _, client := range clients {
+		resp = append(resp, parseDbOAuthClient(client))
+	}
+
+	utils.RespondWithJSON(w, resp, 200)
+}
+
+// HandleDeleteOAuthClient deletes a client along with the sessions, and so
+// the tokens, granted to it.
+func (c *ApiConfig) HandleDeleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	userId, err := c.authenticateSession(r)
+	if err != nil {
+		http.Error(w, "unauthorized", 401)
+		return
+	}
+
+	clientId, err := uuid.Parse(r.PathValue("clientId"))
+	if err != nil {
+		http.Error(w, "bad request", 400)
+		return
+	}
+
+	deleted, err := c.Database.DeleteOAuthClient(r.Context(), database.DeleteOAuthClientParams{
+		ID:      clientId,
+		OwnerID: userId,
+	})
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+	if deleted == 0 {
+		http.Error(w, "not found", 404)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+type authorizationRequest struct {
+	Client      database.OauthClient
+	RedirectURI string
+	// RedirectURIProvided is false when the client left redirect_uri out
+	// and its only registered one is used
+	RedirectURIProvided bool
+	State               string
+	Scopes              []string
+	CodeChallenge       string
+}
+
+// params returns the query parameters the request was made with, to be
+// carried through the consent form.
+func (a authorizationRequest) params() map[string]string {
+	params := map[string]string{
+		"response_type":         "code",
+		"client_id":             a.Client.ID.String(),
+		"scope":                 strings.Join(a.Scopes, " "),
+		"state":                 a.State,
+		"code_challenge":        a.CodeChallenge,
+		"code_challenge_method": auth.PKCEMethodS256,
+	}
+	if a.RedirectURIProvided {
+		params["redirect_uri"] = a.RedirectURI
+	}
+	return params
+}
+
+// parseAuthorizationRequest reads the parameters of an authorization
+// request. Until the redirect URI is known to belong to the client errors
+// must be shown to the user rather than redirected, which the caller can
+// tell from RedirectURI being empty.
+func (c *ApiConfig) parseAuthorizationRequest(r *http.Request, params url.Values) (authorizationRequest, error) {
+	var req authorizationRequest
+
+	clientId, err := uuid.Parse(params.Get("client_id"))
+	if err != nil {
+		return req, &oauthError{Code: "invalid_request", Description: "missing or invalid client_id"}
+	}
+
+	req.Client, err = c.Database.GetOAuthClient(r.Context(), clientId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return req, &oauthError{Code: "invalid_request", Description: "unknown client"}
+	}
+	if err != nil {
+		return req, err
+	}
+
+	redirectURI := params.Get("redirect_uri")
+	req.RedirectURIProvided = redirectURI != ""
+	if redirectURI == "" && len(req.Client.RedirectUris) == 1 {
+		redirectURI = req.Client.RedirectUris[0]
+	}
+	for _, uri := range req.Client.RedirectUris {
+		if uri == redirectURI {
+			req.RedirectURI = uri
+		}
+	}
+	if req.RedirectURI == "" {
+		return req, &oauthError{Code: "invalid_request", Description: "redirect_uri is not registered for this client"}
+	}
+
+	req.State = params.Get("state")
+
+	if params.Get("response_type") != "code" {
+		return req, &oauthError{Code: "unsupported_response_type", Description: "only the code response type is supported"}
+	}
+
+	req.Scopes = strings.Fields(params.Get("scope"))
+	if len(req.Scopes) == 0 {
+		return req, &oauthError{Code: "invalid_scope", Description: "scope is required"}
+	}
+	for _, scope := range req.Scopes {
+		if !auth.ValidScope(scope) {
+			return req, &oauthError{Code: "invalid_scope", Description: "unknown scope " + scope}
+		}
+	}
+
+	req.CodeChallenge = params.Get("code_challenge")
+	if params.Get("code_challenge_method") != auth.PKCEMethodS256 || len(req.CodeChallenge) != 43 {
+		return req, &oauthError{Code: "invalid_request", Description: "PKCE with the S256 method is required"}
+	}
+
+	return req, nil
+}
+
+// redirectToClient sends the user agent back to the client with params
+// added to its redirect URI.
+func redirectToClient(w http.ResponseWriter, r *http.Request, req authorizationRequest, params url.Values, status int) {
+	u, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	query := u.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	u.RawQuery = query.Encode()
+
+	http.Redirect(w, r, u.String(), status)
+}
+
+// respondWithAuthorizationError shows err to the user, or redirects it to
+// the client once we know where to.
+func respondWithAuthorizationError(w http.ResponseWriter, r *http.Request, req authorizationRequest, err error, status int) {
+	var oauthErr *oauthError
+	if !errors.As(err, &oauthErr) {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	if req.RedirectURI == "" {
+		http.Error(w, oauthErr.Description, 400)
+		return
+	}
+
+	redirectToClient(w, r, req, url.Values{
+		"error":             {oauthErr.Code},
+		"error_description": {oauthErr.Description},
+	}, status)
+}
+
+var consentPage = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+	<head>
+		<title>Authorize {{.Client}}</title>
+	</head>
+	<body>
+		<h1>{{.Client}} wants to access your Chirpy account</h1>
+		<p>If you allow it, {{.Client}} will be able to:</p>
+		<ul>
+			{{range .Scopes}}<li>{{.}}</li>
+			{{end}}
+		</ul>
+		{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+		<form method="post" action="/oauth/authorize">
+			{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+			{{end}}
+			<label>Email <input type="email" name="email" value="{{.Email}}" autocomplete="username" required></label>
+			<label>Password <input type="password" name="password" autocomplete="current-password" required></label>
+			<label>Two-factor code, if enabled <input type="text" name="code" inputmode="numeric" autocomplete="one-time-code"></label>
+			<button type="submit" name="action" value="allow">Allow</button>
+			<button type="submit" name="action" value="deny" formnovalidate>Deny</button>
+		</form>
+	</body>
+</html>
+`))
+
+func renderConsentPage(w http.ResponseWriter, req authorizationRequest, email, errMessage string, status int) {
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		scopes = append(scopes, scopeDescriptions[scope])
+	}
+
+	// the page takes credentials, so it must not be framed by another site
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.WriteHeader(status)
+
+	if err := consentPage.Execute(w, map[string]any{
+		"Client": req.Client.Name,
+		"Scopes": scopes,
+		"Params": req.params(),
+		"Email":  email,
+		"Error":  errMessage,
+	}); err != nil {
+		log.Printf("error rendering consent page: %q", err)
+	}
+}
+
+// HandleAuthorize shows the consent page of an authorization request.
+func (c *ApiConfig) HandleAuthorize(w http.ResponseWriter, r *http.Request) {
+	req, err := c.parseAuthorizationRequest(r, r.URL.Query())
+	if err != nil {
+		respondWithAuthorizationError(w, r, req, err, http.StatusFound)
+		return
+	}
+
+	renderConsentPage(w, req, "", "", 200)
+}
+
+// HandleAuthorizeConsent logs the user in from the consent page and, if
+// they allowed it, redirects back to the client with an authorization code.
+func (c *ApiConfig) HandleAuthorizeConsent(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "error parsing form", 400)
+		return
+	}
+
+	req, err := c.parseAuthorizationRequest(r, r.PostForm)
+	if err != nil {
+		respondWithAuthorizationError(w, r, req, err, http.StatusSeeOther)
+		return
+	}
+
+	if r.PostForm.Get("action") != "allow" {
+		respondWithAuthorizationError(w, r, req, &oauthError{Code: "access_denied", Description: "the user denied the request"}, http.StatusSeeOther)
+		return
+	}
+
+	email := r.PostForm.Get("email")
+
+	limitKeys := c.passwordLoginKeys(r, email)
+	if !c.reserveLoginAttempt(w, r, limitKeys) {
+		return
+	}
+
+	user, err := c.checkPassword(r, email, r.PostForm.Get("password"), limitKeys)
+	if err != nil {
+		renderConsentPage(w, req, email, "Incorrect email or password.", 401)
+		return
+	}
+
+	hasTOTP, err := c.hasTOTP(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+	if hasTOTP {
+		mfaKeys := c.mfaLoginKeys(r, user.ID)
+		if !c.reserveLoginAttempt(w, r, mfaKeys) {
+			return
+		}
+
+		ok, err := c.checkSecondFactor(r.Context(), user.ID, secondFactor{Code: r.PostForm.Get("code")})
+		if err != nil {
+			http.Error(w, "internal server error", 500)
+			return
+		}
+		if !ok {
+			renderConsentPage(w, req, email, "Enter the code from your authenticator app.", 401)
+			return
+		}
+		c.resetLoginFailures(r.Context(), mfaKeys)
+	}
+
+	code, err := auth.MakeToken()
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	if err := c.Database.CreateAuthorizationCode(r.Context(), database.CreateAuthorizationCodeParams{
+		CodeHash:            auth.HashToken(code),
+		ClientID:            req.Client.ID,
+		UserID:              user.ID,
+		RedirectUri:         req.RedirectURI,
+		Scopes:              req.Scopes,
+		CodeChallenge:       req.CodeChallenge,
+		ExpiresAt:           time.Now().Add(authorizationCodeTTL),
+		RedirectUriProvided: req.RedirectURIProvided,
+	}); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	c.audit(r, auditEvent{
+		Actor:      user.ID,
+		Action:     auditOAuthAuthorized,
+		TargetType: auditTargetOAuthClient,
+		TargetID:   req.Client.ID,
+		Payload:    map[string]any{"scopes": req.Scopes},
+	})
+
+	redirectToClient(w, r, req, url.Values{"code": {code}}, http.StatusSeeOther)
+}
+
+// authenticateClient identifies the client calling the token endpoint from
+// HTTP basic auth or the client_id and client_secret form parameters.
+// Public clients have no secret and only send their id.
+func (c *ApiConfig) authenticateClient(r *http.Request) (database.OauthClient, error) {
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	clientId, err := uuid.Parse(id)
+	if err != nil {
+		return database.OauthClient{}, err
+	}
+
+	client, err := c.Database.GetOAuthClient(r.Context(), clientId)
+	if err != nil {
+		return database.OauthClient{}, err
+	}
+
+	if client.SecretHash.Valid && subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash.String)) != 1 {
+		return database.OauthClient{}, errors.New("invalid client secret")
+	}
+
+	return client, nil
+}
+
+// requireClient parses the form posted to an OAuth endpoint and
+// authenticates the client posting it, answering invalid_client and
+// returning false when that fails.
+func (c *ApiConfig) requireClient(w http.ResponseWriter, r *http.Request) (database.OauthClient, bool) {
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, 400, "invalid_request", "error parsing form")
+		return database.OauthClient{}, false
+	}
+
+	client, err := c.authenticateClient(r)
+	if err != nil {
+		if _, _, ok := r.BasicAuth(); ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+		}
+		respondWithOAuthError(w, 401, "invalid_client", "client authentication failed")
+		return database.OauthClient{}, false
+	}
+
+	return client, true
+}
+
+// HandleToken is the token endpoint of RFC 6749, trading authorization
+// codes and refresh tokens for access tokens.
+func (c *ApiConfig) HandleToken(w http.ResponseWriter, r *http.Request) {
+	client, ok := c.requireClient(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		c.exchangeAuthorizationCode(w, r, client)
+	case "refresh_token":
+		c.refreshClientToken(w, r, client)
+	default:
+		respondWithOAuthError(w, 400, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token")
+	}
+}
+
+func respondWithClientTokens(w http.ResponseWriter, accessToken, refreshToken string, scopes []string) {
+	type response struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+		Scope        string `json:"scope"`
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	utils.RespondWithJSON(w, response{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(scopes, " "),
+	}, 200)
+}
+
+// exchangeAuthorizationCode starts a session for the client from a code.
+// A code presented twice was intercepted, so the session started from its
+// first use is revoked as RFC 6749 section 4.1.2 recommends.
+func (c *ApiConfig) exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	codeHash := auth.HashToken(r.PostForm.Get("code"))
+
+	// a code presented by another client is left for its own
+	code, err := c.Database.UseAuthorizationCode(r.Context(), database.UseAuthorizationCodeParams{
+		CodeHash: codeHash,
+		ClientID: client.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		used, err := c.Database.GetAuthorizationCode(r.Context(), codeHash)
+		if err == nil && used.ClientID == client.ID && used.SessionID.Valid {
+			if err := revokeSession(r.Context(), c.Database, used.SessionID.UUID); err != nil {
+				log.Printf("error revoking session %s: %q", used.SessionID.UUID, err)
+			} else {
+				c.audit(r, auditEvent{
+					Action:     auditSessionRevoked,
+					TargetType: auditTargetSession,
+					TargetID:   used.SessionID.UUID,
+					Payload:    map[string]any{"reason": "authorization_code_reuse", "user_id": used.UserID},
+				})
+			}
+		}
+		respondWithOAuthError(w, 400, "invalid_grant", "invalid or expired code")
+		return
+	}
+	if err != nil {
+		respondWithOAuthError(w, 500, "server_error", "")
+		return
+	}
+
+	// redirect_uri is only required when the authorization request had it,
+	// as in RFC 6749 4.1.3, but must match whenever it is sent
+	redirectURI := r.PostForm.Get("redirect_uri")
+	if (code.RedirectUriProvided || redirectURI != "") && code.RedirectUri != redirectURI {
+		respondWithOAuthError(w, 400, "invalid_grant", "code was issued to another redirect_uri")
+		return
+	}
+
+	if !auth.VerifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+		respondWithOAuthError(w, 400, "invalid_grant", "code_verifier does not match the code_challenge")
+		return
+	}
+
+	user, err := c.Database.GetUserByID(r.Context(), code.UserID)
+	if err != nil {
+		respondWithOAuthError(w, 400, "invalid_grant", "user no longer exists")
+		return
+	}
+
+	tokens, err := c.startSession(r, user, uuid.NullUUID{UUID: client.ID, Valid: true}, code.Scopes)
+	if err != nil {
+		respondWithOAuthError(w, 500, "server_error", "")
+		return
+	}
+
+	if err := c.Database.SetAuthorizationCodeSession(r.Context(), database.SetAuthorizationCodeSessionParams{
+		CodeHash:  codeHash,
+		SessionID: uuid.NullUUID{UUID: tokens.SessionID, Valid: true},
+	}); err != nil {
+		log.Printf("error linking authorization code to session %s: %q", tokens.SessionID, err)
+	}
+
+	respondWithClientTokens(w, tokens.AccessToken, tokens.RefreshToken, code.Scopes)
+}
+
+// refreshClientToken rotates a refresh token of a session granted to
+// client, the same way HandleRefresh does for logins.
+func (c *ApiConfig) refreshClientToken(w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	token, err := c.Database.GetRefreshToken(r.Context(), r.PostForm.Get("refresh_token"))
+	if err != nil {
+		respondWithOAuthError(w, 400, "invalid_grant", "invalid refresh token")
+		return
+	}
+
+	session, err := c.Database.GetSession(r.Context(), token.FamilyID)
+	if err != nil || session.ClientID.UUID != client.ID {
+		respondWithOAuthError(w, 400, "invalid_grant", "invalid refresh token")
+		return
+	}
+
+	if token.RevokedAt.Valid {
+		c.revokeReusedSession(r, token)
+		respondWithOAuthError(w, 400, "invalid_grant", "invalid refresh token")
+		return
+	}
+
+	if !token.ExpiresAt.Valid || time.Now().After(token.ExpiresAt.Time) {
+		respondWithOAuthError(w, 400, "invalid_grant", "refresh token expired")
+		return
+	}
+
+	user, err := c.Database.GetUserByID(r.Context(), session.UserID)
+	if err != nil {
+		respondWithOAuthError(w, 400, "invalid_grant", "user no longer exists")
+		return
+	}
+
+	accessToken, err := c.issueAccessToken(user, session)
+	if err != nil {
+		respondWithOAuthError(w, 500, "server_error", "")
+		return
+	}
+
+	refreshToken, err := c.rotateRefreshToken(r, token)
+	if errors.Is(err, errRefreshTokenReused) {
+		c.revokeReusedSession(r, token)
+		respondWithOAuthError(w, 400, "invalid_grant", "invalid refresh token")
+		return
+	}
+	if err != nil {
+		respondWithOAuthError(w, 500, "server_error", "")
+		return
+	}
+
+	respondWithClientTokens(w, accessToken, refreshToken, session.Scopes)
+}
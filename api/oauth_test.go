@@ -0,0 +1,123 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/LahcenHaouch/goserver/internal/auth"
+	"github.com/LahcenHaouch/goserver/internal/database"
+	"github.com/google/uuid"
+)
+
+const testCodeVerifier = "dBjftJeZ4CVP-mJ92K9n1pKMq1CJqDQtSVbUfVeArGo"
+
+// authorizeTestClient goes through the consent form as user and returns
+// the authorization code. redirectURI is left out of the request when
+// empty.
+func authorizeTestClient(t *testing.T, c *ApiConfig, client database.OauthClient, user database.User, redirectURI string) string {
+	t.Helper()
+
+	form := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {client.ID.String()},
+		"scope":                 {auth.ScopeChirpsRead},
+		"code_challenge":        {auth.S256CodeChallenge(testCodeVerifier)},
+		"code_challenge_method": {auth.PKCEMethodS256},
+		"action":                {"allow"},
+		"email":                 {user.Email.String},
+		"password":              {testPassword},
+	}
+	if redirectURI != "" {
+		form.Set("redirect_uri", redirectURI)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/oauth/authorize", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	c.HandleAuthorizeConsent(rec, req)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("expected 303 from the consent form, got %d: %s", rec.Code, rec.Body)
+	}
+
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("error parsing redirect: %q", err)
+	}
+	code := location.Query().Get("code")
+	if code == "" {
+		t.Fatalf("expected a code in %s", location)
+	}
+	return code
+}
+
+func exchangeCode(c *ApiConfig, client database.OauthClient, secret, code, redirectURI string) int {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"code_verifier": {testCodeVerifier},
+	}
+	if redirectURI != "" {
+		form.Set("redirect_uri", redirectURI)
+	}
+	return postForm(c.HandleToken, "/oauth/token", form, client, secret).Code
+}
+
+func TestTokenRedirectURIOnlyRequiredWhenSent(t *testing.T) {
+	c := testConfig(t)
+	user := createTestUser(t, c, "owner@example.com")
+	client := createTestClient(t, c, user, "s3cret")
+	registered := client.RedirectUris[0]
+
+	code := authorizeTestClient(t, c, client, user, "")
+	if status := exchangeCode(c, client, "s3cret", code, ""); status != 200 {
+		t.Fatalf("expected 200 without redirect_uri when the request left it out, got %d", status)
+	}
+
+	code = authorizeTestClient(t, c, client, user, "")
+	if status := exchangeCode(c, client, "s3cret", code, "http://evil.test/callback"); status != 400 {
+		t.Fatalf("expected 400 for a different redirect_uri, got %d", status)
+	}
+
+	code = authorizeTestClient(t, c, client, user, registered)
+	if status := exchangeCode(c, client, "s3cret", code, ""); status != 400 {
+		t.Fatalf("expected 400 without the redirect_uri the request sent, got %d", status)
+	}
+
+	code = authorizeTestClient(t, c, client, user, registered)
+	if status := exchangeCode(c, client, "s3cret", code, registered); status != 200 {
+		t.Fatalf("expected 200 with the same redirect_uri, got %d", status)
+	}
+}
+
+func TestTokenLeavesOtherClientsCodes(t *testing.T) {
+	c := testConfig(t)
+	user := createTestUser(t, c, "owner@example.com")
+	client := createTestClient(t, c, user, "s3cret")
+	other := createTestClient(t, c, user, "0ther")
+
+	code := authorizeTestClient(t, c, client, user, "")
+	if status := exchangeCode(c, other, "0ther", code, ""); status != 400 {
+		t.Fatalf("expected 400 for another client's code, got %d", status)
+	}
+	if status := exchangeCode(c, client, "s3cret", code, ""); status != 200 {
+		t.Fatalf("expected the code to still work for its client, got %d", status)
+	}
+}
+
+func TestUpdateUserRefusesClientTokens(t *testing.T) {
+	c := testConfig(t)
+	user := createTestUser(t, c, "owner@example.com")
+	client := createTestClient(t, c, user, "s3cret")
+	tokens := loginTestUser(t, c, user, uuid.NullUUID{UUID: client.ID, Valid: true}, []string{auth.ScopeAccountWrite})
+
+	req := httptest.NewRequest(http.MethodPut, "/api/users", strings.NewReader(`{"email":"thief@example.com","password":"stolen passphrase"}`))
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	rec := httptest.NewRecorder()
+	c.HandleUpdateUser(rec, req)
+	if rec.Code != 401 {
+		t.Fatalf("expected 401 for a client token, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/LahcenHaouch/goserver/internal/auth"
+	"github.com/LahcenHaouch/goserver/internal/database"
+	"github.com/LahcenHaouch/goserver/internal/mail"
+	"github.com/google/uuid"
+)
+
+const passwordResetTTL = time.Hour
+
+// HandlePasswordReset mails a single-use reset token to the given address.
+// It answers 202 whether or not the account exists so it cannot be used to
+// find out which emails are registered.
+func (c *ApiConfig) HandlePasswordReset(w http.ResponseWriter, r *http.Request) {
+	type request struct {
+		Email string `json:"email"`
+	}
+
+	defer r.Body.Close()
+
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "error parsing request", 400)
+		return
+	}
+
+	user, err := c.Database.GetUser(r.Context(), sql.NullString{String: req.Email, Valid: true})
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(202)
+		return
+	}
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	token, err := auth.MakeToken()
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	if _, err := c.Database.CreatePasswordReset(r.Context(), database.CreatePasswordResetParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+	}); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	if err := c.Mailer.Send(r.Context(), mail.Message{
+		To:      user.Email.String,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your Chirpy account.\n\n"+
+			"Use this token within the next hour to choose a new password:\n\n%s\n\n"+
+			"If it wasn't you, you can ignore this email.", token),
+	}); err != nil {
+		log.Printf("error sending password reset mail: %q", err)
+	}
+
+	w.WriteHeader(202)
+}
+
+// HandlePasswordResetConfirm sets a new password from a reset token and
+// logs the user out everywhere.
+func (c *ApiConfig) HandlePasswordResetConfirm(w http.ResponseWriter, r *http.Request) {
+	type request struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	defer r.Body.Close()
+
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "error parsing request", 400)
+		return
+	}
+
+	tx, err := c.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+	defer tx.Rollback()
+	qtx := c.Database.WithTx(tx)
+
+	reset, err := qtx.UsePasswordReset(r.Context(), auth.HashToken(req.Token))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "invalid or expired token", 401)
+		return
+	}
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	user, err := qtx.GetUserByID(r.Context(), reset.UserID)
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	// returning rolls the transaction back, so the token can be used again
+	// with a better password
+	if errs := c.PasswordPolicy.Validate(req.Password, user.Email.String); len(errs) > 0 {
+		respondWithFieldErrors(w, errs)
+		return
+	}
+
+	hashedPassword, err := c.Passwords.Hash(req.Password)
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	if err := qtx.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+		ID:             reset.UserID,
+		HashedPassword: hashedPassword,
+	}); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	if err := qtx.InvalidatePasswordResets(r.Context(), reset.UserID); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	if err := qtx.RevokeUserRefreshTokens(r.Context(), uuid.NullUUID{UUID: reset.UserID, Valid: true}); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	if err := qtx.RevokeUserSessions(r.Context(), reset.UserID); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	c.audit(r, auditEvent{
+		Actor:      reset.UserID,
+		Action:     auditPasswordReset,
+		TargetType: auditTargetUser,
+		TargetID:   reset.UserID,
+	})
+
+	w.WriteHeader(204)
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/LahcenHaouch/goserver/internal/auth"
+	"github.com/LahcenHaouch/goserver/internal/database"
+)
+
+// Single-use tokens must last their TTL whatever time zone the database
+// session is in, neither expiring at once nor hours late.
+func TestSingleUseTokensExpireOnTime(t *testing.T) {
+	for _, tz := range []string{"UTC", "Asia/Tokyo", "America/New_York"} {
+		t.Run(tz, func(t *testing.T) {
+			c := testConfigWith(t, map[string]string{"timezone": tz})
+			user := createTestUser(t, c, "ann@example.com")
+			client := createTestClient(t, c, user, "s3cret")
+			ctx := context.Background()
+
+			kinds := []struct {
+				name   string
+				ttl    time.Duration
+				create func(hash string, expiresAt time.Time) error
+				use    func(hash string) error
+			}{
+				{
+					name: "password reset",
+					ttl:  passwordResetTTL,
+					create: func(hash string, expiresAt time.Time) error {
+						_, err := c.Database.CreatePasswordReset(ctx, database.CreatePasswordResetParams{TokenHash: hash, UserID: user.ID, ExpiresAt: expiresAt})
+						return err
+					},
+					use: func(hash string) error {
+						_, err := c.Database.UsePasswordReset(ctx, hash)
+						return err
+					},
+				},
+				{
+					name: "email verification",
+					ttl:  emailVerificationTTL,
+					create: func(hash string, expiresAt time.Time) error {
+						_, err := c.Database.CreateEmailVerification(ctx, database.CreateEmailVerificationParams{TokenHash: hash, UserID: user.ID, Email: user.Email.String, ExpiresAt: expiresAt})
+						return err
+					},
+					use: func(hash string) error {
+						_, err := c.Database.UseEmailVerification(ctx, hash)
+						return err
+					},
+				},
+				{
+					name: "magic link",
+					ttl:  magicLinkTTL,
+					create: func(hash string, expiresAt time.Time) error {
+						_, err := c.Database.CreateMagicLink(ctx, database.CreateMagicLinkParams{TokenHash: hash, UserID: user.ID, Email: user.Email.String, ExpiresAt: expiresAt})
+						return err
+					},
+					use: func(hash string) error {
+						_, err := c.Database.UseMagicLink(ctx, hash)
+						return err
+					},
+				},
+				{
+					name: "authorization code",
+					ttl:  authorizationCodeTTL,
+					create: func(hash string, expiresAt time.Time) error {
+						return c.Database.CreateAuthorizationCode(ctx, database.CreateAuthorizationCodeParams{
+							CodeHash:    hash,
+							ClientID:    client.ID,
+							UserID:      user.ID,
+							RedirectUri: client.RedirectUris[0],
+							Scopes:      []string{auth.ScopeChirpsRead},
+							ExpiresAt:   expiresAt,
+						})
+					},
+					use: func(hash string) error {
+						_, err := c.Database.UseAuthorizationCode(ctx, database.UseAuthorizationCodeParams{CodeHash: hash, ClientID: client.ID})
+						return err
+					},
+				},
+			}
+
+			for _, kind := range kinds {
+				fresh, expired := auth.HashToken(kind.name+" fresh"), auth.HashToken(kind.name+" expired")
+				if err := kind.create(fresh, time.Now().Add(kind.ttl)); err != nil {
+					t.Fatalf("error creating %s: %q", kind.name, err)
+				}
+				if err := kind.create(expired, time.Now().Add(-time.Minute)); err != nil {
+					t.Fatalf("error creating %s: %q", kind.name, err)
+				}
+
+				if err := kind.use(fresh); err != nil {
+					t.Fatalf("expected a new %s to be usable, got %v", kind.name, err)
+				}
+				if err := kind.use(expired); !errors.Is(err, sql.ErrNoRows) {
+					t.Fatalf("expected an expired %s to be refused, got %v", kind.name, err)
+				}
+			}
+		})
+	}
+}
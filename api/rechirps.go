@@ -0,0 +1,173 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/LahcenHaouch/goserver/internal/auth"
+	"github.com/LahcenHaouch/goserver/internal/database"
+	"github.com/LahcenHaouch/goserver/utils"
+	"github.com/google/uuid"
+)
+
+// checkCanPost answers the request and returns false when userId may not
+// publish anything yet.
+func (c *ApiConfig) checkCanPost(w http.ResponseWriter, r *http.Request, userId uuid.UUID) bool {
+	if !c.RequireVerifiedEmail {
+		return true
+	}
+
+	user, err := c.Database.GetUserByID(r.Context(), userId)
+	if err != nil {
+		http.Error(w, "401 Unauthorized", 401)
+		return false
+	}
+	if !user.VerifiedAt.Valid {
+		utils.RespondWithError(w, map[string]string{"error": "email not verified"}, 403)
+		return false
+	}
+
+	return true
+}
+
+// resolveRechirp returns the published chirp with id, or the chirp it
+// reshares when it is a rechirp, so rechirps never point at other rechirps.
+func resolveRechirp(ctx context.Context, q *database.Queries, id uuid.UUID) (database.Chirp, error) {
+	chirp, err := q.GetPublishedChirp(ctx, id)
+	if err != nil || !chirp.RechirpOfID.Valid {
+		return chirp, err
+	}
+	return q.GetPublishedChirp(ctx, chirp.RechirpOfID.UUID)
+}
+
+// loadOriginals fetches the chirps that chirps reshare or quote.
+func (c *ApiConfig) loadOriginals(ctx context.Context, chirps []Chirp) ([]Chirp, error) {
+	var ids []uuid.UUID
+	for _, chirp := range chirps {
+		if id := chirp.originalID(); id != nil {
+			ids = append(ids, *id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	originals, err := c.Database.GetChirpsByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	return parseDbChirps(originals), nil
+}
+
+// embedOriginals sets Original on chirps from originals. An original that
+// was deleted in the meantime is left out.
+func embedOriginals(chirps []Chirp, originals []Chirp) {
+	byId := make(map[uuid.UUID]Chirp, len(originals))
+	for _, original := range originals {
+		byId[original.ID] = original
+	}
+
+	for i := range chirps {
+		id := chirps[i].originalID()
+		if id == nil {
+			continue
+		}
+		if original, ok := byId[*id]; ok {
+			chirps[i].Original = &original
+		}
+	}
+}
+
+func (chirp Chirp) originalID() *uuid.UUID {
+	if chirp.RechirpOfID != nil {
+		return chirp.RechirpOfID
+	}
+	return chirp.QuoteOfID
+}
+
+// HandleRechirp reshares a chirp. Each user rechirps a chirp at most once:
+// doing it again answers with the existing rechirp.
+func (c *ApiConfig) HandleRechirp(w http.ResponseWriter, r *http.Request) {
+	userId, err := c.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		http.Error(w, "401 Unauthorized", authStatus(err))
+		return
+	}
+
+	chirpId, err := uuid.Parse(r.PathValue("chirpId"))
+	if err != nil {
+		utils.RespondWithError(w, map[string]string{"error": "error parsing chirp id"}, 400)
+		return
+	}
+
+	if !c.checkCanPost(w, r, userId) {
+		return
+	}
+
+	original, err := resolveRechirp(r.Context(), c.Database, chirpId)
+	if err != nil {
+		utils.RespondWithError(w, map[string]string{"error": "error fetching chirp"}, 404)
+		return
+	}
+
+	params := database.CreateRechirpParams{
+		UserID:      uuid.NullUUID{UUID: userId, Valid: true},
+		RechirpOfID: uuid.NullUUID{UUID: original.ID, Valid: true},
+	}
+
+	status := 201
+	rechirp, err := c.Database.CreateRechirp(r.Context(), params)
+	if errors.Is(err, sql.ErrNoRows) {
+		status = 200
+		rechirp, err = c.Database.GetRechirp(r.Context(), database.GetRechirpParams(params))
+	}
+	if err != nil {
+		utils.RespondWithError(w, map[string]string{"error": "error creating rechirp"}, 500)
+		return
+	}
+
+	chirps := []Chirp{parseDbChirp(rechirp)}
+	if err := c.loadChirpDetails(r.Context(), chirps, params.UserID); err != nil {
+		log.Printf("error loading details of chirp %s: %q", rechirp.ID, err)
+	}
+
+	utils.RespondWithJSON(w, chirps[0], status)
+}
+
+// HandleUndoRechirp removes the caller's rechirp of a chirp, if any.
+func (c *ApiConfig) HandleUndoRechirp(w http.ResponseWriter, r *http.Request) {
+	userId, err := c.authenticate(r, auth.ScopeChirpsWrite)
+	if err != nil {
+		http.Error(w, "unauthorized", authStatus(err))
+		return
+	}
+
+	chirpId, err := uuid.Parse(r.PathValue("chirpId"))
+	if err != nil {
+		http.Error(w, "bad request", 400)
+		return
+	}
+
+	original, err := resolveRechirp(r.Context(), c.Database, chirpId)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(204)
+		return
+	}
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	if _, err := c.Database.DeleteRechirp(r.Context(), database.DeleteRechirpParams{
+		UserID:      uuid.NullUUID{UUID: userId, Valid: true},
+		RechirpOfID: uuid.NullUUID{UUID: original.ID, Valid: true},
+	}); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	w.WriteHeader(204)
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/LahcenHaouch/goserver/internal/auth"
+	"github.com/google/uuid"
+)
+
+func rechirp(t *testing.T, c *ApiConfig, method, token string, id uuid.UUID) (int, Chirp) {
+	t.Helper()
+
+	req := httptest.NewRequest(method, "/api/chirps/"+id.String()+"/rechirps", nil)
+	req.SetPathValue("chirpId", id.String())
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	if method == http.MethodDelete {
+		c.HandleUndoRechirp(rec, req)
+	} else {
+		c.HandleRechirp(rec, req)
+	}
+
+	var chirp Chirp
+	if rec.Code == 200 || rec.Code == 201 {
+		if err := json.NewDecoder(rec.Body).Decode(&chirp); err != nil {
+			t.Fatalf("error decoding rechirp: %q", err)
+		}
+	}
+	return rec.Code, chirp
+}
+
+func TestRechirpOncePerUser(t *testing.T) {
+	c := testConfig(t)
+	author := createTestUser(t, c, "ann@example.com")
+	fan := createTestUser(t, c, "bob@example.com")
+	tokens := loginTestUser(t, c, fan, uuid.NullUUID{}, nil)
+	original := createTestChirp(t, c, author, "worth sharing")
+
+	code, first := rechirp(t, c, http.MethodPost, tokens.AccessToken, original.ID)
+	if code != 201 {
+		t.Fatalf("expected 201, got %d", code)
+	}
+	if first.RechirpOfID == nil || *first.RechirpOfID != original.ID || first.Original == nil {
+		t.Fatalf("expected a rechirp embedding the original, got %+v", first)
+	}
+
+	code, again := rechirp(t, c, http.MethodPost, tokens.AccessToken, original.ID)
+	if code != 200 || again.ID != first.ID {
+		t.Fatalf("expected 200 with the existing rechirp, got %d %s", code, again.ID)
+	}
+
+	// rechirping a rechirp reshares what it points at
+	code, viaRechirp := rechirp(t, c, http.MethodPost, tokens.AccessToken, first.ID)
+	if code != 200 || viaRechirp.ID != first.ID {
+		t.Fatalf("expected the rechirp of a rechirp to be the same rechirp, got %d %s", code, viaRechirp.ID)
+	}
+
+	if code, _ := rechirp(t, c, http.MethodDelete, tokens.AccessToken, original.ID); code != 204 {
+		t.Fatalf("expected 204 undoing the rechirp, got %d", code)
+	}
+	if chirps, err := c.Database.GetChirpsByIDs(context.Background(), []uuid.UUID{first.ID}); err != nil || len(chirps) != 0 {
+		t.Fatalf("expected the rechirp to be gone, got %v %v", chirps, err)
+	}
+	if code, _ := rechirp(t, c, http.MethodDelete, tokens.AccessToken, original.ID); code != 204 {
+		t.Fatalf("expected undoing twice to be a no-op, got %d", code)
+	}
+}
+
+func TestRechirpRequiresWriteScope(t *testing.T) {
+	c := testConfig(t)
+	user := createTestUser(t, c, "ann@example.com")
+	client := createTestClient(t, c, user, "s3cret")
+	tokens := loginTestUser(t, c, user, uuid.NullUUID{UUID: client.ID, Valid: true}, []string{auth.ScopeChirpsRead})
+	original := createTestChirp(t, c, user, "mine")
+
+	if code, _ := rechirp(t, c, http.MethodPost, tokens.AccessToken, original.ID); code != 403 {
+		t.Fatalf("expected 403 without chirps:write, got %d", code)
+	}
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/LahcenHaouch/goserver/internal/auth"
+	"github.com/LahcenHaouch/goserver/internal/database"
+	"github.com/google/uuid"
+)
+
+// MiddlewareRequireRole only lets through requests carrying an access token
+// from login whose role grants at least role. Personal access tokens and
+// OAuth client tokens have no role and are refused.
+func (c *ApiConfig) MiddlewareRequireRole(role string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := c.authenticateLogin(r)
+		if err != nil {
+			http.Error(w, "unauthorized", 401)
+			return
+		}
+
+		if !auth.HasRole(claims.Role, role) {
+			http.Error(w, "forbidden", 403)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// HandleSetUserRole changes the role of a user and logs them out everywhere,
+// as the access tokens they hold still carry the old role.
+func (c *ApiConfig) HandleSetUserRole(w http.ResponseWriter, r *http.Request) {
+	type request struct {
+		Role string `json:"role"`
+	}
+
+	adminId, err := c.authenticateSession(r)
+	if err != nil {
+		http.Error(w, "unauthorized", 401)
+		return
+	}
+
+	userId, err := uuid.Parse(r.PathValue("userId"))
+	if err != nil {
+		http.Error(w, "bad request", 400)
+		return
+	}
+
+	// an admin demoting themselves could leave nobody able to undo it
+	if userId == adminId {
+		http.Error(w, "cannot change your own role", 403)
+		return
+	}
+
+	defer r.Body.Close()
+
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !auth.ValidRole(req.Role) {
+		http.Error(w, "error parsing request", 400)
+		return
+	}
+
+	tx, err := c.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+	defer tx.Rollback()
+	qtx := c.Database.WithTx(tx)
+
+	updated, err := qtx.SetUserRole(r.Context(), database.SetUserRoleParams{
+		ID:   userId,
+		Role: req.Role,
+	})
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+	if updated == 0 {
+		http.Error(w, "not found", 404)
+		return
+	}
+
+	if err := qtx.RevokeUserSessions(r.Context(), userId); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	if err := qtx.RevokeUserRefreshTokens(r.Context(), uuid.NullUUID{UUID: userId, Valid: true}); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	c.audit(r, auditEvent{
+		Actor:      adminId,
+		Action:     auditRoleChanged,
+		TargetType: auditTargetUser,
+		TargetID:   userId,
+		Payload:    map[string]any{"role": req.Role},
+	})
+
+	w.WriteHeader(204)
+}
+
+// PromoteAdmins makes admins of the accounts with the given emails, so that
+// a new install has someone able to hand out roles. Only verified addresses
+// count; accounts that aren't yet are promoted on a later start.
+func (c *ApiConfig) PromoteAdmins(ctx context.Context, emails []string) error {
+	for _, email := range emails {
+		promoted, err := c.Database.SetUserRoleByEmail(ctx, database.SetUserRoleByEmailParams{
+			Email: sql.NullString{String: email, Valid: true},
+			Role:  auth.RoleAdmin,
+		})
+		if err != nil {
+			return err
+		}
+		if promoted > 0 {
+			log.Printf("promoted %s to admin", email)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/LahcenHaouch/goserver/internal/auth"
+	"github.com/LahcenHaouch/goserver/internal/database"
+)
+
+func TestPromoteAdminsOnlyVerified(t *testing.T) {
+	c := testConfig(t)
+	ctx := context.Background()
+	verified := createTestUser(t, c, "root@example.com")
+	unverified := createTestUser(t, c, "squatter@example.com")
+
+	if _, err := c.Database.MarkUserVerified(ctx, database.MarkUserVerifiedParams{ID: verified.ID, Email: verified.Email}); err != nil {
+		t.Fatalf("error verifying user: %q", err)
+	}
+
+	if err := c.PromoteAdmins(ctx, []string{"root@example.com", "squatter@example.com", "nobody@example.com"}); err != nil {
+		t.Fatalf("error promoting admins: %q", err)
+	}
+
+	for _, tc := range []struct {
+		user database.User
+		role string
+	}{
+		{verified, auth.RoleAdmin},
+		{unverified, auth.RoleUser},
+	} {
+		user, err := c.Database.GetUserByID(ctx, tc.user.ID)
+		if err != nil {
+			t.Fatalf("error getting user: %q", err)
+		}
+		if user.Role != tc.role {
+			t.Fatalf("expected %s to be %s, got %s", user.Email.String, tc.role, user.Role)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/LahcenHaouch/goserver/internal/database"
+	"github.com/LahcenHaouch/goserver/internal/search"
+	"github.com/LahcenHaouch/goserver/utils"
+	"github.com/google/uuid"
+)
+
+const maxSearchQueryLength = 256
+
+// SearchResult is a chirp matching a search, with its rank and an HTML
+// snippet of the body where matches are wrapped in <mark>.
+type SearchResult struct {
+	Chirp
+	Rank    float32 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+// HandleSearchChirps searches chirp bodies for q, best matches first. See
+// search.ParseQuery for the syntax. author_id, limit and cursor work as they
+// do for HandleGetChirps.
+func (c *ApiConfig) HandleSearchChirps(w http.ResponseWriter, r *http.Request) {
+	viewer := c.viewer(r)
+
+	query := r.URL.Query()
+
+	q := query.Get("q")
+	if len(q) > maxSearchQueryLength {
+		http.Error(w, "q is too long", 400)
+		return
+	}
+
+	tsquery := search.ParseQuery(q)
+	if tsquery == "" {
+		http.Error(w, "q must contain at least one word", 400)
+		return
+	}
+
+	params := database.SearchChirpsParams{
+		Query:           tsquery,
+		HeadlineOptions: search.HeadlineOptions,
+		Limit:           defaultChirpLimit,
+	}
+
+	if v := query.Get("author_id"); v != "" {
+		userId, err := uuid.Parse(v)
+		if err != nil {
+			http.Error(w, "invalid author_id", 400)
+			return
+		}
+		params.AuthorID = uuid.NullUUID{UUID: userId, Valid: true}
+	}
+
+	if v := query.Get("cursor"); v != "" {
+		cursor, err := parseSearchCursor(v)
+		if err != nil {
+			http.Error(w, "invalid cursor", 400)
+			return
+		}
+		params.BeforeRank = sql.NullFloat64{Float64: float64(cursor.Rank), Valid: true}
+		params.BeforeCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		params.BeforeID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxChirpLimit {
+			http.Error(w, "invalid limit", 400)
+			return
+		}
+		params.Limit = int32(limit)
+	}
+
+	// one more than asked tells us whether there is a next page
+	limit := params.Limit
+	params.Limit++
+
+	rows, err := c.Database.SearchChirps(r.Context(), params)
+	if err != nil {
+		utils.RespondWithError(w, map[string]string{"error": "error searching chirps"}, 500)
+		return
+	}
+
+	type response struct {
+		Results    []SearchResult `json:"results"`
+		NextCursor *string        `json:"next_cursor"`
+	}
+
+	resp := response{Results: make([]SearchResult, 0, len(rows))}
+	links := []string{c.chirpsLink(r, "", "first")}
+	if len(rows) > int(limit) {
+		rows = rows[:limit]
+		last := rows[len(rows)-1]
+		cursor := searchCursor{
+			Rank:        last.Rank,
+			chirpCursor: chirpCursor{CreatedAt: last.CreatedAt.Time, ID: last.ID},
+		}.String()
+		resp.NextCursor = &cursor
+		links = append(links, c.chirpsLink(r, cursor, "next"))
+	}
+
+	chirps := make([]Chirp, 0, len(rows))
+	for _, row := range rows {
+		chirps = append(chirps, parseDbChirp(database.Chirp{
+			ID:          row.ID,
+			CreatedAt:   row.CreatedAt,
+			UpdatedAt:   row.UpdatedAt,
+			Body:        row.Body,
+			UserID:      row.UserID,
+			InReplyToID: row.InReplyToID,
+			RechirpOfID: row.RechirpOfID,
+			QuoteOfID:   row.QuoteOfID,
+			Status:      row.Status,
+			PublishAt:   row.PublishAt,
+		}))
+	}
+
+	if err := c.loadChirpDetails(r.Context(), chirps, viewer); err != nil {
+		utils.RespondWithError(w, map[string]string{"error": "error searching chirps"}, 500)
+		return
+	}
+
+	for i, row := range rows {
+		resp.Results = append(resp.Results, SearchResult{
+			Chirp:   chirps[i],
+			Rank:    row.Rank,
+			Snippet: search.Highlight(row.Headline),
+		})
+	}
+
+	w.Header().Set("Link", strings.Join(links, ", "))
+	utils.RespondWithJSON(w, resp, 200)
+}
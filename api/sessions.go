@@ -0,0 +1,376 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/LahcenHaouch/goserver/internal/auth"
+	"github.com/LahcenHaouch/goserver/internal/database"
+	"github.com/google/uuid"
+)
+
+var (
+	errSessionRevoked = errors.New("session revoked")
+	errClientToken    = errors.New("token issued to an OAuth client")
+	// errRefreshTokenReused means the refresh token was rotated by another
+	// request, so it was presented twice.
+	errRefreshTokenReused = errors.New("refresh token reused")
+)
+
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"`
+	// ClientID and Scopes are set on sessions of OAuth clients.
+	ClientID *uuid.UUID `json:"client_id,omitempty"`
+	Scopes   []string   `json:"scopes,omitempty"`
+	// RevokedAt is only set on sessions in a data export.
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// parseDbSession converts s, marking it current if it is the session the
+// request was made from.
+func parseDbSession(s database.Session, current uuid.UUID) Session {
+	session := Session{
+		ID:         s.ID,
+		UserAgent:  s.UserAgent,
+		IP:         s.Ip,
+		CreatedAt:  s.CreatedAt,
+		LastUsedAt: s.LastUsedAt,
+		Current:    s.ID == current,
+		Scopes:     s.Scopes,
+		RevokedAt:  nullTimePtr(s.RevokedAt),
+	}
+	if s.ClientID.Valid {
+		session.ClientID = &s.ClientID.UUID
+	}
+	return session
+}
+
+type sessionTokens struct {
+	SessionID    uuid.UUID
+	AccessToken  string
+	RefreshToken string
+}
+
+// clientIP returns the address of the client, taken from X-Forwarded-For
+// only when the server sits behind a proxy we trust to set it.
+func (c *ApiConfig) clientIP(r *http.Request) string {
+	if c.TrustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// parseAccessToken validates an access token and checks that the session
+// it was issued for hasn't been revoked since.
+func (c *ApiConfig) parseAccessToken(ctx context.Context, tokenStr string) (*auth.Claims, error) {
+	claims, err := c.Keys.ParseJWT(tokenStr)
+	if errors.Is(err, auth.ErrUnknownKey) && c.reloadForUnknownKey(ctx) {
+		claims, err = c.Keys.ParseJWT(tokenStr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if sessionId := claims.Session(); sessionId != uuid.Nil {
+		active, err := c.Database.IsSessionActive(ctx, sessionId)
+		if err != nil {
+			return nil, err
+		}
+		if !active {
+			return nil, errSessionRevoked
+		}
+	}
+
+	return claims, nil
+}
+
+// startSession records a new session for user and returns its access and
+// refresh tokens. Sessions from login leave clientId null; those granted to
+// an OAuth client are limited to scopes.
+func (c *ApiConfig) startSession(r *http.Request, user database.User, clientId uuid.NullUUID, scopes []string) (sessionTokens, error) {
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return sessionTokens{}, err
+	}
+
+	tx, err := c.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		return sessionTokens{}, err
+	}
+	defer tx.Rollback()
+	qtx := c.Database.WithTx(tx)
+
+	session, err := qtx.CreateSession(r.Context(), database.CreateSessionParams{
+		UserID:    user.ID,
+		UserAgent: r.UserAgent(),
+		Ip:        c.clientIP(r),
+		ClientID:  clientId,
+		Scopes:    scopes,
+	})
+	if err != nil {
+		return sessionTokens{}, err
+	}
+
+	if _, err := qtx.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		Token:     refreshToken,
+		UserID:    uuid.NullUUID{UUID: user.ID, Valid: true},
+		ExpiresAt: sql.NullTime{Time: time.Now().Add(refreshTokenTTL), Valid: true},
+		FamilyID:  session.ID,
+	}); err != nil {
+		return sessionTokens{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return sessionTokens{}, err
+	}
+
+	accessToken, err := c.issueAccessToken(user, session)
+	if err != nil {
+		return sessionTokens{}, err
+	}
+
+	return sessionTokens{
+		SessionID:    session.ID,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// issueAccessToken returns an access token for session: a client token
+// limited to the session's scopes, or one carrying the user's role.
+func (c *ApiConfig) issueAccessToken(user database.User, session database.Session) (string, error) {
+	if session.ClientID.Valid {
+		return c.Keys.MakeClientJWT(user.ID, session.ID, session.ClientID.UUID, session.Scopes, accessTokenTTL)
+	}
+
+	return c.Keys.MakeJWT(user.ID, session.ID, user.Role, accessTokenTTL)
+}
+
+// rotateRefreshToken replaces token with a new refresh token of the same
+// session and returns it.
+func (c *ApiConfig) rotateRefreshToken(r *http.Request, token database.RefreshToken) (string, error) {
+	newToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := c.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	qtx := c.Database.WithTx(tx)
+
+	rotated, err := qtx.RotateRefreshToken(r.Context(), database.RotateRefreshTokenParams{
+		Token:      token.Token,
+		ReplacedBy: sql.NullString{String: newToken, Valid: true},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// another request rotated this token between our read and our update
+	if rotated == 0 {
+		return "", errRefreshTokenReused
+	}
+
+	if _, err := qtx.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		Token:     newToken,
+		UserID:    token.UserID,
+		ExpiresAt: sql.NullTime{Time: time.Now().Add(refreshTokenTTL), Valid: true},
+		FamilyID:  token.FamilyID,
+	}); err != nil {
+		return "", err
+	}
+
+	if err := qtx.TouchSession(r.Context(), database.TouchSessionParams{
+		ID:        token.FamilyID,
+		UserAgent: r.UserAgent(),
+		Ip:        c.clientIP(r),
+	}); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	return newToken, nil
+}
+
+// revokeSession logs a session out: its refresh tokens stop working and so
+// do the access tokens issued for it.
+func revokeSession(ctx context.Context, q *database.Queries, sessionId uuid.UUID) error {
+	if err := q.RevokeSession(ctx, sessionId); err != nil {
+		return err
+	}
+
+	return q.RevokeRefreshTokenFamily(ctx, sessionId)
+}
+
+// endSession revokes a session on behalf of actor and records it.
+func (c *ApiConfig) endSession(r *http.Request, actor, sessionId uuid.UUID) error {
+	tx, err := c.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := revokeSession(r.Context(), c.Database.WithTx(tx), sessionId); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	c.audit(r, auditEvent{
+		Actor:      actor,
+		Action:     auditSessionRevoked,
+		TargetType: auditTargetSession,
+		TargetID:   sessionId,
+	})
+
+	return nil
+}
+
+// revokeReusedSession revokes the session of a refresh token presented
+// after it was already rotated or revoked, as it must have leaked.
+func (c *ApiConfig) revokeReusedSession(r *http.Request, token database.RefreshToken) {
+	if err := revokeSession(r.Context(), c.Database, token.FamilyID); err != nil {
+		log.Printf("error revoking session %s: %q", token.FamilyID, err)
+		return
+	}
+
+	c.audit(r, auditEvent{
+		Action:     auditSessionRevoked,
+		TargetType: auditTargetSession,
+		TargetID:   token.FamilyID,
+		Payload:    map[string]any{"reason": "refresh_token_reuse", "user_id": token.UserID.UUID},
+	})
+}
+
+func (c *ApiConfig) HandleListSessions(w http.ResponseWriter, r *http.Request) {
+	claims, err := c.authenticateLogin(r)
+	if err != nil {
+		http.Error(w, "unauthorized", 401)
+		return
+	}
+
+	userId, err := claims.UserID()
+	if err != nil {
+		http.Error(w, "unauthorized", 401)
+		return
+	}
+
+	sessions, err := c.Database.ListActiveSessions(r.Context(), database.ListActiveSessionsParams{
+		UserID:     userId,
+		LastUsedAt: time.Now().Add(-refreshTokenTTL),
+	})
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	resp := make([]Session, 0, len(sessions))
+	for _, s := range sessions {
+		resp = append(resp, parseDbSession(s, claims.Session()))
+	}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+func (c *ApiConfig) HandleDeleteSession(w http.ResponseWriter, r *http.Request) {
+	userId, err := c.authenticateSession(r)
+	if err != nil {
+		http.Error(w, "unauthorized", 401)
+		return
+	}
+
+	sessionId, err := uuid.Parse(r.PathValue("sessionId"))
+	if err != nil {
+		http.Error(w, "bad request", 400)
+		return
+	}
+
+	session, err := c.Database.GetSession(r.Context(), sessionId)
+	if err != nil || session.UserID != userId {
+		http.Error(w, "not found", 404)
+		return
+	}
+
+	if err := c.endSession(r, userId, sessionId); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// HandleLogoutAll revokes every session of the user, including the one
+// making the request.
+func (c *ApiConfig) HandleLogoutAll(w http.ResponseWriter, r *http.Request) {
+	userId, err := c.authenticateSession(r)
+	if err != nil {
+		http.Error(w, "unauthorized", 401)
+		return
+	}
+
+	tx, err := c.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+	defer tx.Rollback()
+	qtx := c.Database.WithTx(tx)
+
+	if err := qtx.RevokeUserSessions(r.Context(), userId); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	if err := qtx.RevokeUserRefreshTokens(r.Context(), uuid.NullUUID{UUID: userId, Valid: true}); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	c.audit(r, auditEvent{
+		Actor:      userId,
+		Action:     auditSessionsRevoked,
+		TargetType: auditTargetUser,
+		TargetID:   userId,
+	})
+
+	w.WriteHeader(204)
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LahcenHaouch/goserver/internal/auth"
+	"github.com/google/uuid"
+)
+
+// refresh trades refreshToken for new tokens, which are empty unless the
+// answer is 200.
+func refresh(t *testing.T, c *ApiConfig, refreshToken string) (int, sessionTokens) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/refresh", nil)
+	req.Header.Set("Authorization", "Bearer "+refreshToken)
+	rec := httptest.NewRecorder()
+	c.HandleRefresh(rec, req)
+
+	var tokens sessionTokens
+	if rec.Code == 200 {
+		var resp struct {
+			Token        string `json:"token"`
+			RefreshToken string `json:"refresh_token"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("error decoding response: %q", err)
+		}
+		tokens.AccessToken, tokens.RefreshToken = resp.Token, resp.RefreshToken
+	}
+	return rec.Code, tokens
+}
+
+// authenticated reports whether accessToken is still accepted.
+func authenticated(c *ApiConfig, accessToken string) bool {
+	req := httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	_, err := c.authenticate(req, auth.ScopeChirpsRead)
+	return err == nil
+}
+
+func TestRefreshRotates(t *testing.T) {
+	c := testConfig(t)
+	user := createTestUser(t, c, "ann@example.com")
+	tokens := loginTestUser(t, c, user, uuid.NullUUID{}, nil)
+
+	code, rotated := refresh(t, c, tokens.RefreshToken)
+	if code != 200 {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if rotated.RefreshToken == tokens.RefreshToken {
+		t.Fatalf("expected a new refresh token")
+	}
+	if !authenticated(c, rotated.AccessToken) {
+		t.Fatalf("expected the new access token to work")
+	}
+
+	if code, _ := refresh(t, c, rotated.RefreshToken); code != 200 {
+		t.Fatalf("expected the new refresh token to work, got %d", code)
+	}
+}
+
+func TestRefreshReuseRevokesSession(t *testing.T) {
+	c := testConfig(t)
+	user := createTestUser(t, c, "ann@example.com")
+	tokens := loginTestUser(t, c, user, uuid.NullUUID{}, nil)
+
+	_, rotated := refresh(t, c, tokens.RefreshToken)
+
+	if code, _ := refresh(t, c, tokens.RefreshToken); code != 401 {
+		t.Fatalf("expected 401 for a rotated token, got %d", code)
+	}
+	if code, _ := refresh(t, c, rotated.RefreshToken); code != 401 {
+		t.Fatalf("expected the reuse to revoke the rest of the family, got %d", code)
+	}
+	if authenticated(c, rotated.AccessToken) {
+		t.Fatalf("expected the reuse to revoke the session's access tokens")
+	}
+}
+
+func TestRefreshExpired(t *testing.T) {
+	c := testConfig(t)
+	user := createTestUser(t, c, "ann@example.com")
+	tokens := loginTestUser(t, c, user, uuid.NullUUID{}, nil)
+
+	// written the way startSession writes it
+	if _, err := c.DB.Exec("UPDATE refresh_tokens SET expires_at = $2 WHERE token = $1", tokens.RefreshToken, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("error expiring token: %q", err)
+	}
+
+	if code, _ := refresh(t, c, tokens.RefreshToken); code != 401 {
+		t.Fatalf("expected 401 for an expired token, got %d", code)
+	}
+}
+
+// Two requests refreshing the same token can't both get a new one: the
+// loser is treated as a reuse, which ends the session.
+func TestRefreshConcurrent(t *testing.T) {
+	c := testConfig(t)
+	user := createTestUser(t, c, "ann@example.com")
+	tokens := loginTestUser(t, c, user, uuid.NullUUID{}, nil)
+
+	var mu sync.Mutex
+	var winners []sessionTokens
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code, rotated := refresh(t, c, tokens.RefreshToken)
+			if code == 200 {
+				mu.Lock()
+				winners = append(winners, rotated)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(winners) != 1 {
+		t.Fatalf("expected exactly one refresh to succeed, got %d", len(winners))
+	}
+	if code, _ := refresh(t, c, winners[0].RefreshToken); code != 401 {
+		t.Fatalf("expected the session to be revoked, got %d", code)
+	}
+}
+
+func listSessions(t *testing.T, c *ApiConfig, accessToken string) []Session {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	rec := httptest.NewRecorder()
+	c.HandleListSessions(rec, req)
+	if rec.Code != 200 {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var sessions []Session
+	if err := json.NewDecoder(rec.Body).Decode(&sessions); err != nil {
+		t.Fatalf("error decoding sessions: %q", err)
+	}
+	return sessions
+}
+
+func deleteSession(c *ApiConfig, accessToken string, sessionId uuid.UUID) int {
+	req := httptest.NewRequest(http.MethodDelete, "/api/sessions/"+sessionId.String(), nil)
+	req.SetPathValue("sessionId", sessionId.String())
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	rec := httptest.NewRecorder()
+	c.HandleDeleteSession(rec, req)
+	return rec.Code
+}
+
+func TestListAndRevokeSessions(t *testing.T) {
+	c := testConfig(t)
+	user := createTestUser(t, c, "ann@example.com")
+	laptop := loginTestUser(t, c, user, uuid.NullUUID{}, nil)
+	phone := loginTestUser(t, c, user, uuid.NullUUID{}, nil)
+
+	sessions := listSessions(t, c, laptop.AccessToken)
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+	for _, s := range sessions {
+		if s.Current != (s.ID == laptop.SessionID) {
+			t.Fatalf("expected only the laptop session to be current, got %+v", s)
+		}
+	}
+
+	other := createTestUser(t, c, "bob@example.com")
+	otherTokens := loginTestUser(t, c, other, uuid.NullUUID{}, nil)
+	if code := deleteSession(c, otherTokens.AccessToken, phone.SessionID); code != 404 {
+		t.Fatalf("expected 404 for another user's session, got %d", code)
+	}
+
+	if code := deleteSession(c, laptop.AccessToken, phone.SessionID); code != 204 {
+		t.Fatalf("expected 204, got %d", code)
+	}
+	if authenticated(c, phone.AccessToken) {
+		t.Fatalf("expected the revoked session's access token to stop working")
+	}
+	if code, _ := refresh(t, c, phone.RefreshToken); code != 401 {
+		t.Fatalf("expected the revoked session's refresh token to stop working, got %d", code)
+	}
+	if !authenticated(c, laptop.AccessToken) {
+		t.Fatalf("expected the other session to keep working")
+	}
+	if n := len(listSessions(t, c, laptop.AccessToken)); n != 1 {
+		t.Fatalf("expected 1 session left, got %d", n)
+	}
+}
+
+func TestLogoutAll(t *testing.T) {
+	c := testConfig(t)
+	user := createTestUser(t, c, "ann@example.com")
+	laptop := loginTestUser(t, c, user, uuid.NullUUID{}, nil)
+	phone := loginTestUser(t, c, user, uuid.NullUUID{}, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/logout-all", nil)
+	req.Header.Set("Authorization", "Bearer "+laptop.AccessToken)
+	rec := httptest.NewRecorder()
+	c.HandleLogoutAll(rec, req)
+	if rec.Code != 204 {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+
+	for _, tokens := range []sessionTokens{laptop, phone} {
+		if authenticated(c, tokens.AccessToken) {
+			t.Fatalf("expected every access token to stop working")
+		}
+		if code, _ := refresh(t, c, tokens.RefreshToken); code != 401 {
+			t.Fatalf("expected every refresh token to stop working, got %d", code)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/LahcenHaouch/goserver/internal/database"
+	"github.com/LahcenHaouch/goserver/utils"
+	"github.com/google/uuid"
+)
+
+// maxThreadDepth bounds how far a thread is walked up and down from a
+// chirp. Deeper chirps are reached by asking for the thread of one closer.
+const maxThreadDepth = 50
+
+// ThreadReply is a reply in a thread, Depth levels below the chirp the
+// thread was asked for.
+type ThreadReply struct {
+	Chirp
+	Depth int32 `json:"depth"`
+}
+
+// loadReplyCounts fills in how many direct replies chirps have.
+func (c *ApiConfig) loadReplyCounts(ctx context.Context, chirps []Chirp) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(chirps))
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.ID)
+	}
+
+	counts, err := c.Database.CountChirpReplies(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	byId := make(map[uuid.UUID]int64, len(counts))
+	for _, count := range counts {
+		byId[count.InReplyToID.UUID] = count.Replies
+	}
+	for i := range chirps {
+		chirps[i].ReplyCount = byId[chirps[i].ID]
+	}
+
+	return nil
+}
+
+// threadPathElementLength is the width of each element of a reply's path:
+// its creation time to the microsecond, then its id.
+const threadPathElementLength = len("20060102150405000000") + 36
+
+// threadCursor is the cursor of the page of replies after the one at path.
+// Carrying the path instead of the reply's id keeps the cursor working once
+// that reply is deleted.
+func threadCursor(path []string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.Join(path, "/")))
+}
+
+func parseThreadCursor(cursor string) ([]string, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, false
+	}
+
+	path := strings.Split(string(raw), "/")
+	if len(path) > maxThreadDepth {
+		return nil, false
+	}
+	for _, element := range path {
+		if len(element) != threadPathElementLength {
+			return nil, false
+		}
+		if _, err := uuid.Parse(element[threadPathElementLength-36:]); err != nil {
+			return nil, false
+		}
+	}
+	return path, true
+}
+
+// HandleGetChirpThread responds with a chirp, its ancestors from the root
+// down, and its replies depth first. Replies are paginated with limit and
+// cursor like HandleGetChirps; ancestors are not, and the first one has an
+// in_reply_to_id when there are more than maxThreadDepth of them.
+func (c *ApiConfig) HandleGetChirpThread(w http.ResponseWriter, r *http.Request) {
+	chirpId, err := uuid.Parse(r.PathValue("chirpId"))
+	if err != nil {
+		utils.RespondWithError(w, map[string]string{"error": "error parsing chirp id"}, 400)
+		return
+	}
+
+	viewer := c.viewer(r)
+
+	query := r.URL.Query()
+	params := database.ListChirpRepliesParams{
+		ChirpID:  uuid.NullUUID{UUID: chirpId, Valid: true},
+		MaxDepth: maxThreadDepth,
+		Limit:    defaultChirpLimit,
+	}
+
+	if v := query.Get("cursor"); v != "" {
+		path, ok := parseThreadCursor(v)
+		if !ok {
+			http.Error(w, "invalid cursor", 400)
+			return
+		}
+		params.AfterPath = path
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxChirpLimit {
+			http.Error(w, "invalid limit", 400)
+			return
+		}
+		params.Limit = int32(limit)
+	}
+
+	dbChirp, err := c.Database.GetPublishedChirp(r.Context(), chirpId)
+	if err != nil {
+		utils.RespondWithError(w, map[string]string{"error": "error fetching chirp"}, 404)
+		return
+	}
+
+	ancestors, err := c.Database.ListChirpAncestors(r.Context(), database.ListChirpAncestorsParams{
+		ChirpID:  chirpId,
+		MaxDepth: maxThreadDepth,
+	})
+	if err != nil {
+		utils.RespondWithError(w, map[string]string{"error": "error fetching thread"}, 500)
+		return
+	}
+
+	// one more than asked tells us whether there is a next page
+	limit := params.Limit
+	params.Limit++
+
+	replies, err := c.Database.ListChirpReplies(r.Context(), params)
+	if err != nil {
+		utils.RespondWithError(w, map[string]string{"error": "error fetching thread"}, 500)
+		return
+	}
+
+	links := []string{c.chirpsLink(r, "", "first")}
+	var nextCursor *string
+	if len(replies) > int(limit) {
+		replies = replies[:limit]
+		cursor := threadCursor(replies[len(replies)-1].Path)
+		nextCursor = &cursor
+		links = append(links, c.chirpsLink(r, cursor, "next"))
+	}
+
+	// details are loaded in one go for the whole thread
+	chirps := append(parseDbChirps(ancestors), parseDbChirp(dbChirp))
+	for _, reply := range replies {
+		chirps = append(chirps, parseDbChirp(database.Chirp{
+			ID:          reply.ID,
+			CreatedAt:   reply.CreatedAt,
+			UpdatedAt:   reply.UpdatedAt,
+			Body:        reply.Body,
+			UserID:      reply.UserID,
+			InReplyToID: reply.InReplyToID,
+			RechirpOfID: reply.RechirpOfID,
+			QuoteOfID:   reply.QuoteOfID,
+			Status:      reply.Status,
+			PublishAt:   reply.PublishAt,
+		}))
+	}
+
+	if err := c.loadChirpDetails(r.Context(), chirps, viewer); err != nil {
+		utils.RespondWithError(w, map[string]string{"error": "error fetching thread"}, 500)
+		return
+	}
+
+	type response struct {
+		Ancestors  []Chirp       `json:"ancestors"`
+		Chirp      Chirp         `json:"chirp"`
+		Replies    []ThreadReply `json:"replies"`
+		NextCursor *string       `json:"next_cursor"`
+	}
+
+	resp := response{
+		Ancestors:  chirps[:len(ancestors)],
+		Chirp:      chirps[len(ancestors)],
+		Replies:    make([]ThreadReply, 0, len(replies)),
+		NextCursor: nextCursor,
+	}
+	for i, reply := range replies {
+		resp.Replies = append(resp.Replies, ThreadReply{
+			Chirp: chirps[len(ancestors)+1+i],
+			Depth: reply.Depth,
+		})
+	}
+
+	w.Header().Set("Link", strings.Join(links, ", "))
+	utils.RespondWithJSON(w, resp, 200)
+}
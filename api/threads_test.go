@@ -0,0 +1,134 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/LahcenHaouch/goserver/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestParseThreadCursor(t *testing.T) {
+	path := []string{
+		"20261018094027123456" + uuid.NewString(),
+		"20261018094028000001" + uuid.NewString(),
+	}
+	got, ok := parseThreadCursor(threadCursor(path))
+	if !ok || strings.Join(got, "/") != strings.Join(path, "/") {
+		t.Fatalf("expected %v back, got %v", path, got)
+	}
+
+	for _, cursor := range []string{
+		"not base64!",
+		threadCursor([]string{uuid.NewString()}),
+		threadCursor([]string{"20261018094027123456not-a-uuid-but-thirty-six-chars-long"}),
+	} {
+		if _, ok := parseThreadCursor(cursor); ok {
+			t.Fatalf("expected cursor %q to be refused", cursor)
+		}
+	}
+}
+
+func createTestReply(t *testing.T, c *ApiConfig, user database.User, parent uuid.UUID, body string) database.Chirp {
+	t.Helper()
+
+	chirp, err := c.Database.CreateChirp(context.Background(), database.CreateChirpParams{
+		Body:        sql.NullString{String: body, Valid: true},
+		UserID:      uuid.NullUUID{UUID: user.ID, Valid: true},
+		InReplyToID: uuid.NullUUID{UUID: parent, Valid: true},
+		Status:      chirpStatusPublished,
+	})
+	if err != nil {
+		t.Fatalf("error creating reply: %q", err)
+	}
+	return chirp
+}
+
+type threadResponse struct {
+	Ancestors  []Chirp       `json:"ancestors"`
+	Chirp      Chirp         `json:"chirp"`
+	Replies    []ThreadReply `json:"replies"`
+	NextCursor *string       `json:"next_cursor"`
+}
+
+func getThread(t *testing.T, c *ApiConfig, id uuid.UUID, query string) (int, threadResponse) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/chirps/"+id.String()+"/thread?"+query, nil)
+	req.SetPathValue("chirpId", id.String())
+	rec := httptest.NewRecorder()
+	c.HandleGetChirpThread(rec, req)
+
+	var resp threadResponse
+	if rec.Code == 200 {
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("error decoding thread: %q", err)
+		}
+	}
+	return rec.Code, resp
+}
+
+func TestThreadWalksRepliesDepthFirst(t *testing.T) {
+	c := testConfig(t)
+	user := createTestUser(t, c, "ann@example.com")
+
+	root := createTestChirp(t, c, user, "root")
+	first := createTestReply(t, c, user, root.ID, "first")
+	second := createTestReply(t, c, user, root.ID, "second")
+	nested := createTestReply(t, c, user, first.ID, "nested")
+
+	code, thread := getThread(t, c, root.ID, "")
+	if code != 200 {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	var order []uuid.UUID
+	for _, reply := range thread.Replies {
+		order = append(order, reply.ID)
+	}
+	want := []uuid.UUID{first.ID, nested.ID, second.ID}
+	if len(order) != len(want) || order[0] != want[0] || order[1] != want[1] || order[2] != want[2] {
+		t.Fatalf("expected replies %v, got %v", want, order)
+	}
+	if thread.Replies[1].Depth != 2 {
+		t.Fatalf("expected the nested reply at depth 2, got %d", thread.Replies[1].Depth)
+	}
+
+	code, thread = getThread(t, c, nested.ID, "")
+	if code != 200 || len(thread.Ancestors) != 2 || thread.Ancestors[0].ID != root.ID || thread.Ancestors[1].ID != first.ID {
+		t.Fatalf("expected ancestors root and first, got %d %+v", code, thread.Ancestors)
+	}
+}
+
+// A page must carry on after the last reply of the previous one even when
+// that reply has been deleted since.
+func TestThreadCursorSurvivesDeletedReply(t *testing.T) {
+	c := testConfig(t)
+	user := createTestUser(t, c, "ann@example.com")
+
+	root := createTestChirp(t, c, user, "root")
+	first := createTestReply(t, c, user, root.ID, "first")
+	second := createTestReply(t, c, user, root.ID, "second")
+
+	code, page := getThread(t, c, root.ID, "limit=1")
+	if code != 200 || len(page.Replies) != 1 || page.Replies[0].ID != first.ID || page.NextCursor == nil {
+		t.Fatalf("expected the first reply and a cursor, got %d %+v", code, page)
+	}
+
+	if err := c.Database.DeleteChirp(context.Background(), first.ID); err != nil {
+		t.Fatalf("error deleting reply: %q", err)
+	}
+
+	code, page = getThread(t, c, root.ID, "limit=1&cursor="+*page.NextCursor)
+	if code != 200 || len(page.Replies) != 1 || page.Replies[0].ID != second.ID {
+		t.Fatalf("expected the second reply after the deleted one, got %d %+v", code, page)
+	}
+
+	if code, _ := getThread(t, c, root.ID, "cursor="+threadCursor([]string{first.ID.String()})); code != 400 {
+		t.Fatalf("expected 400 for a malformed cursor, got %d", code)
+	}
+}
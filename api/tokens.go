@@ -0,0 +1,175 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/LahcenHaouch/goserver/internal/auth"
+	"github.com/LahcenHaouch/goserver/internal/database"
+	"github.com/google/uuid"
+)
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	// Token is only set in the response to its creation.
+	Token string `json:"token,omitempty"`
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func parseDbPersonalAccessToken(pat database.PersonalAccessToken) PersonalAccessToken {
+	return PersonalAccessToken{
+		ID:         pat.ID,
+		Name:       pat.Name,
+		Scopes:     pat.Scopes,
+		CreatedAt:  pat.CreatedAt,
+		LastUsedAt: nullTimePtr(pat.LastUsedAt),
+		ExpiresAt:  nullTimePtr(pat.ExpiresAt),
+	}
+}
+
+func (c *ApiConfig) HandleCreateToken(w http.ResponseWriter, r *http.Request) {
+	type request struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+
+	userId, err := c.authenticateSession(r)
+	if err != nil {
+		http.Error(w, "unauthorized", 401)
+		return
+	}
+
+	defer r.Body.Close()
+
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "error parsing request", 400)
+		return
+	}
+
+	if req.Name == "" || len(req.Scopes) == 0 || req.ExpiresInDays < 0 {
+		http.Error(w, "name and scopes are required", 400)
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !auth.ValidScope(scope) {
+			http.Error(w, fmt.Sprintf("unknown scope %q", scope), 400)
+			return
+		}
+	}
+
+	token, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	var expiresAt sql.NullTime
+	if req.ExpiresInDays > 0 {
+		expiresAt = sql.NullTime{Time: time.Now().AddDate(0, 0, req.ExpiresInDays), Valid: true}
+	}
+
+	pat, err := c.Database.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+		UserID:    userId,
+		Name:      req.Name,
+		TokenHash: auth.HashToken(token),
+		Scopes:    req.Scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	resp := parseDbPersonalAccessToken(pat)
+	resp.Token = token
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(201)
+	w.Write(body)
+}
+
+func (c *ApiConfig) HandleListTokens(w http.ResponseWriter, r *http.Request) {
+	userId, err := c.authenticateSession(r)
+	if err != nil {
+		http.Error(w, "unauthorized", 401)
+		return
+	}
+
+	pats, err := c.Database.ListPersonalAccessTokens(r.Context(), userId)
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	resp := make([]PersonalAccessToken, 0, len(pats))
+	for _, pat := range pats {
+		resp = append(resp, parseDbPersonalAccessToken(pat))
+	}
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+func (c *ApiConfig) HandleRevokeToken(w http.ResponseWriter, r *http.Request) {
+	userId, err := c.authenticateSession(r)
+	if err != nil {
+		http.Error(w, "unauthorized", 401)
+		return
+	}
+
+	tokenId, err := uuid.Parse(r.PathValue("tokenId"))
+	if err != nil {
+		http.Error(w, "bad request", 400)
+		return
+	}
+
+	revoked, err := c.Database.RevokePersonalAccessToken(r.Context(), database.RevokePersonalAccessTokenParams{
+		ID:     tokenId,
+		UserID: userId,
+	})
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+	if revoked == 0 {
+		http.Error(w, "not found", 404)
+		return
+	}
+
+	c.audit(r, auditEvent{
+		Actor:      userId,
+		Action:     auditTokenRevoked,
+		TargetType: auditTargetToken,
+		TargetID:   tokenId,
+	})
+
+	w.WriteHeader(204)
+}
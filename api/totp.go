@@ -0,0 +1,341 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/LahcenHaouch/goserver/internal/auth"
+	"github.com/LahcenHaouch/goserver/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	mfaPendingTTL     = time.Minute * 5
+	recoveryCodeCount = 10
+	totpIssuer        = "Chirpy"
+)
+
+type secondFactor struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+func (c *ApiConfig) respondWithMFAPending(w http.ResponseWriter, userId uuid.UUID) {
+	token, err := c.Keys.MakeMFAPendingJWT(userId, mfaPendingTTL)
+	if err != nil {
+		http.Error(w, "Error generating jwt token", 500)
+		return
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"mfa_required": true,
+		"mfa_token":    token,
+	})
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(body)
+}
+
+// checkSecondFactor consumes either a TOTP code or a recovery code. A TOTP
+// code is only accepted once, even inside its validity window.
+func (c *ApiConfig) checkSecondFactor(ctx context.Context, userId uuid.UUID, factor secondFactor) (bool, error) {
+	if factor.RecoveryCode != "" {
+		used, err := c.Database.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			UserID:   userId,
+			CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(factor.RecoveryCode)),
+		})
+		return used == 1, err
+	}
+
+	totp, err := c.Database.GetUserTOTP(ctx, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := auth.ValidateTOTP(totp.Secret, factor.Code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	used, err := c.Database.UseTOTPStep(ctx, database.UseTOTPStepParams{
+		UserID:       userId,
+		LastUsedStep: step,
+	})
+	return used == 1, err
+}
+
+// hasTOTP reports whether the user must enter a second factor to log in.
+func (c *ApiConfig) hasTOTP(ctx context.Context, userId uuid.UUID) (bool, error) {
+	totp, err := c.Database.GetUserTOTP(ctx, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return totp.ConfirmedAt.Valid, nil
+}
+
+func (c *ApiConfig) HandleEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	userId, err := c.authenticateSession(r)
+	if err != nil {
+		http.Error(w, "unauthorized", 401)
+		return
+	}
+
+	user, err := c.Database.GetUserByID(r.Context(), userId)
+	if err != nil {
+		http.Error(w, "unauthorized", 401)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	if _, err := c.Database.UpsertUserTOTP(r.Context(), database.UpsertUserTOTPParams{
+		UserID: userId,
+		Secret: secret,
+	}); errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "two-factor authentication already enabled", 409)
+		return
+	} else if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"secret":      secret,
+		"otpauth_uri": auth.TOTPProvisioningURI(totpIssuer, user.Email.String, secret),
+	})
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(201)
+	w.Write(body)
+}
+
+// HandleConfirmTOTP turns two-factor authentication on once the user proves
+// their authenticator works, and hands out the recovery codes.
+func (c *ApiConfig) HandleConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	userId, err := c.authenticateSession(r)
+	if err != nil {
+		http.Error(w, "unauthorized", 401)
+		return
+	}
+
+	defer r.Body.Close()
+
+	var factor secondFactor
+	if err := json.NewDecoder(r.Body).Decode(&factor); err != nil {
+		http.Error(w, "error parsing request", 400)
+		return
+	}
+
+	totp, err := c.Database.GetUserTOTP(r.Context(), userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "two-factor authentication not enrolled", 404)
+		return
+	}
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+	if totp.ConfirmedAt.Valid {
+		http.Error(w, "two-factor authentication already enabled", 409)
+		return
+	}
+
+	ok, err := c.checkSecondFactor(r.Context(), userId, secondFactor{Code: factor.Code})
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+	if !ok {
+		http.Error(w, "invalid code", 401)
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	tx, err := c.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+	defer tx.Rollback()
+	qtx := c.Database.WithTx(tx)
+
+	if err := qtx.ConfirmUserTOTP(r.Context(), userId); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	if err := qtx.DeleteRecoveryCodes(r.Context(), userId); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	for _, code := range codes {
+		if err := qtx.CreateRecoveryCode(r.Context(), database.CreateRecoveryCodeParams{
+			UserID:   userId,
+			CodeHash: auth.HashToken(code),
+		}); err != nil {
+			http.Error(w, "internal server error", 500)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	c.audit(r, auditEvent{
+		Actor:      userId,
+		Action:     auditTOTPEnabled,
+		TargetType: auditTargetUser,
+		TargetID:   userId,
+	})
+
+	body, err := json.Marshal(map[string][]string{"recovery_codes": codes})
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(body)
+}
+
+func (c *ApiConfig) HandleDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	userId, err := c.authenticateSession(r)
+	if err != nil {
+		http.Error(w, "unauthorized", 401)
+		return
+	}
+
+	defer r.Body.Close()
+
+	var factor secondFactor
+	if err := json.NewDecoder(r.Body).Decode(&factor); err != nil {
+		http.Error(w, "error parsing request", 400)
+		return
+	}
+
+	ok, err := c.checkSecondFactor(r.Context(), userId, factor)
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+	if !ok {
+		http.Error(w, "invalid code", 401)
+		return
+	}
+
+	tx, err := c.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+	defer tx.Rollback()
+	qtx := c.Database.WithTx(tx)
+
+	if err := qtx.DeleteUserTOTP(r.Context(), userId); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	if err := qtx.DeleteRecoveryCodes(r.Context(), userId); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	c.audit(r, auditEvent{
+		Actor:      userId,
+		Action:     auditTOTPDisabled,
+		TargetType: auditTargetUser,
+		TargetID:   userId,
+	})
+
+	w.WriteHeader(204)
+}
+
+// HandleLoginMFA finishes a two-factor login started by HandleLogin.
+func (c *ApiConfig) HandleLoginMFA(w http.ResponseWriter, r *http.Request) {
+	type request struct {
+		MFAToken string `json:"mfa_token"`
+		secondFactor
+	}
+
+	defer r.Body.Close()
+
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "error parsing request", 400)
+		return
+	}
+
+	userId, err := c.Keys.ValidateMFAPendingJWT(req.MFAToken)
+	if err != nil {
+		http.Error(w, "unauthorized", 401)
+		return
+	}
+
+	limitKeys := c.mfaLoginKeys(r, userId)
+	if !c.reserveLoginAttempt(w, r, limitKeys) {
+		return
+	}
+
+	ok, err := c.checkSecondFactor(r.Context(), userId, req.secondFactor)
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+	if !ok {
+		c.audit(r, auditEvent{
+			Action:     auditLoginFailed,
+			TargetType: auditTargetUser,
+			TargetID:   userId,
+			Payload:    map[string]any{"reason": "invalid_second_factor"},
+		})
+		http.Error(w, "invalid code", 401)
+		return
+	}
+	c.resetLoginFailures(r.Context(), limitKeys)
+
+	user, err := c.Database.GetUserByID(r.Context(), userId)
+	if err != nil {
+		http.Error(w, "unauthorized", 401)
+		return
+	}
+
+	c.respondWithLogin(w, r, user)
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/LahcenHaouch/goserver/internal/database"
+	"github.com/google/uuid"
+)
+
+func auditActions(t *testing.T, c *ApiConfig, actor uuid.UUID, action string) int {
+	t.Helper()
+
+	events, err := c.Database.ListAuditEvents(context.Background(), database.ListAuditEventsParams{
+		ActorID: uuid.NullUUID{UUID: actor, Valid: true},
+		Action:  sql.NullString{String: action, Valid: true},
+		Limit:   100,
+	})
+	if err != nil {
+		t.Fatalf("error listing audit events: %q", err)
+	}
+	return len(events)
+}
+
+func TestUpdateUserAuditsWhatChanged(t *testing.T) {
+	c := testConfig(t)
+	user := createTestUser(t, c, "before@example.com")
+	tokens := loginTestUser(t, c, user, uuid.NullUUID{}, nil)
+
+	update := func(body string) {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodPut, "/api/users", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+		rec := httptest.NewRecorder()
+		c.HandleUpdateUser(rec, req)
+		if rec.Code != 200 {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+	}
+
+	update(`{"email": "after@example.com", "password": "` + testPassword + `"}`)
+	if n := auditActions(t, c, user.ID, auditPasswordChanged); n != 0 {
+		t.Fatalf("expected no password change event for the same password, got %d", n)
+	}
+	if n := auditActions(t, c, user.ID, auditEmailChanged); n != 1 {
+		t.Fatalf("expected 1 email change event, got %d", n)
+	}
+
+	update(`{"email": "after@example.com", "password": "a different passphrase"}`)
+	if n := auditActions(t, c, user.ID, auditPasswordChanged); n != 1 {
+		t.Fatalf("expected 1 password change event, got %d", n)
+	}
+	if n := auditActions(t, c, user.ID, auditEmailChanged); n != 1 {
+		t.Fatalf("expected no email change event for the same email, got %d", n)
+	}
+}
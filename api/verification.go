@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"time"
+
+	"github.com/LahcenHaouch/goserver/internal/auth"
+	"github.com/LahcenHaouch/goserver/internal/database"
+	mailer "github.com/LahcenHaouch/goserver/internal/mail"
+	"github.com/google/uuid"
+)
+
+const emailVerificationTTL = time.Hour * 24
+
+// validEmail accepts a bare address such as "user@example.com", without a
+// display name.
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
+// sendVerificationEmail mails a link confirming that userID owns email. The
+// token is bound to the address, so it stops working if the email changes.
+func (c *ApiConfig) sendVerificationEmail(ctx context.Context, userID uuid.UUID, email string) error {
+	token, err := auth.MakeToken()
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.Database.CreateEmailVerification(ctx, database.CreateEmailVerificationParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    userID,
+		Email:     email,
+		ExpiresAt: time.Now().Add(emailVerificationTTL),
+	}); err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/api/users/verify?token=%s", c.BaseURL, url.QueryEscape(token))
+
+	return c.Mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Verify your Chirpy email",
+		Body:    fmt.Sprintf("Welcome to Chirpy!\n\nOpen this link within 24 hours to verify your email:\n\n%s", link),
+	})
+}
+
+func (c *ApiConfig) HandleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "missing token", 400)
+		return
+	}
+
+	verification, err := c.Database.UseEmailVerification(r.Context(), auth.HashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "invalid or expired token", 400)
+		return
+	}
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	verified, err := c.Database.MarkUserVerified(r.Context(), database.MarkUserVerifiedParams{
+		ID:    verification.UserID,
+		Email: sql.NullString{String: verification.Email, Valid: true},
+	})
+	if err != nil {
+		http.Error(w, "internal server error", 500)
+		return
+	}
+
+	// the email changed after this token was sent
+	if verified == 0 {
+		http.Error(w, "invalid or expired token", 400)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(200)
+	w.Write([]byte("Email verified"))
+}
@@ -2,56 +2,13 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
-	"fmt"
 	"net/http"
 	"strings"
-	"time"
-
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
-func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 10)
-	return string(hashedPassword), err
-}
-
-func CheckPasswordHash(password, hash string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-}
-
-func MakeJWT(userId uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	now := time.Now().UTC()
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(now),
-		ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
-		Subject:   userId.String(),
-	})
-
-	return token.SignedString([]byte(tokenSecret))
-}
-
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	var claims jwt.RegisteredClaims
-
-	if _, err := jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-		}
-
-		return []byte(tokenSecret), nil
-	}); err != nil {
-		return uuid.Nil, err
-	}
-
-	return uuid.Parse(claims.Subject)
-}
-
 func GetBearerToken(headers http.Header) (string, error) {
 	auth := headers.Get("Authorization")
 	headerArr := strings.Split(auth, " ")
@@ -64,6 +21,12 @@ func GetBearerToken(headers http.Header) (string, error) {
 }
 
 func MakeRefreshToken() (string, error) {
+	return MakeToken()
+}
+
+// MakeToken returns a random opaque token, used for refresh, reset and
+// similar single-purpose tokens.
+func MakeToken() (string, error) {
 	b := make([]byte, 32)
 	if _, err := rand.Read(b); err != nil {
 		return "", err
@@ -71,6 +34,13 @@ func MakeRefreshToken() (string, error) {
 	return hex.EncodeToString(b), nil
 }
 
+// HashToken returns the digest under which an opaque token is stored, so a
+// database leak does not leak usable tokens.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
 	header := headers.Get("Authorization")
 	headerArr := strings.Split(header, " ")
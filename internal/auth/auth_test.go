@@ -7,29 +7,43 @@ import (
 	"github.com/google/uuid"
 )
 
-func TestMakeJWT(t *testing.T) {
-	if _, err := MakeJWT(uuid.New(), "Lahcen", time.Hour); err != nil {
-		t.Fatalf("error creating jwt token: %q", err)
+func TestHashToken(t *testing.T) {
+	token, err := MakeToken()
+	if err != nil {
+		t.Fatalf("error creating token: %q", err)
+	}
+
+	if HashToken(token) != HashToken(token) {
+		t.Fatalf("hash is not deterministic")
+	}
+	if HashToken(token) == token {
+		t.Fatalf("hash should differ from token")
 	}
 }
 
-func TestValidateJWT(t *testing.T) {
-	id := uuid.New()
-	secret := "Lahcen"
-	token, err := MakeJWT(id, secret, time.Hour)
+func TestPersonalAccessToken(t *testing.T) {
+	token, err := MakePersonalAccessToken()
 	if err != nil {
-		t.Fatalf("error creating jwt token: %q", err)
+		t.Fatalf("error creating token: %q", err)
 	}
 
-	if _, err := ValidateJWT(token, secret); err != nil {
-		t.Fatalf("token not valid")
+	if !IsPersonalAccessToken(token) {
+		t.Fatalf("expected %q to be a personal access token", token)
 	}
-}
 
-func TestValidateJWTExpiredToken(t *testing.T) {
-	// [todo]: write test
-}
+	ring, _ := newTestKeyRing(t, AlgRS256)
+	jwt, err := ring.MakeJWT(uuid.New(), uuid.Nil, RoleUser, time.Hour)
+	if err != nil {
+		t.Fatalf("error creating jwt token: %q", err)
+	}
+	if IsPersonalAccessToken(jwt) {
+		t.Fatalf("jwt should not be a personal access token")
+	}
 
-func TestValidateJWTWrongSecret(t *testing.T) {
-	// [todo]: write test
+	if !HasScope([]string{ScopeChirpsRead, ScopeChirpsWrite}, ScopeChirpsWrite) {
+		t.Fatalf("expected scope to be granted")
+	}
+	if HasScope([]string{ScopeChirpsRead}, ScopeAccountWrite) {
+		t.Fatalf("expected scope not to be granted")
+	}
 }
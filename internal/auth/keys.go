@@ -0,0 +1,421 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// SigningKey is an asymmetric key used to sign access tokens. Retired keys
+// no longer sign anything but still verify tokens issued before retirement.
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	CreatedAt time.Time
+	// ActiveAt is when the key starts signing, zero for right away. Until
+	// then it only validates tokens, which leaves every server time to
+	// load it.
+	ActiveAt  time.Time
+	RetiredAt time.Time
+	private   crypto.Signer
+}
+
+func GenerateSigningKey(alg string) (*SigningKey, error) {
+	var private crypto.Signer
+
+	switch alg {
+	case AlgRS256:
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		private = key
+	case AlgEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		private = key
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %q", alg)
+	}
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		ID:        hex.EncodeToString(b),
+		Algorithm: alg,
+		CreatedAt: time.Now().UTC(),
+		private:   private,
+	}, nil
+}
+
+// ParseSigningKey restores a key stored with MarshalPrivateKey.
+func ParseSigningKey(id, alg string, pemBytes []byte, createdAt, activeAt, retiredAt time.Time) (*SigningKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		if alg != AlgRS256 {
+			return nil, fmt.Errorf("key %s: RSA key stored as %q", id, alg)
+		}
+	case ed25519.PrivateKey:
+		if alg != AlgEdDSA {
+			return nil, fmt.Errorf("key %s: Ed25519 key stored as %q", id, alg)
+		}
+	default:
+		return nil, fmt.Errorf("key %s: unsupported key type %T", id, key)
+	}
+
+	return &SigningKey{
+		ID:        id,
+		Algorithm: alg,
+		CreatedAt: createdAt,
+		ActiveAt:  activeAt,
+		RetiredAt: retiredAt,
+		private:   key.(crypto.Signer),
+	}, nil
+}
+
+// SignsAt reports whether the key signs tokens at now: it is active and not
+// retired yet.
+func (k *SigningKey) SignsAt(now time.Time) bool {
+	return !now.Before(k.ActiveAt) && (k.RetiredAt.IsZero() || now.Before(k.RetiredAt))
+}
+
+func (k *SigningKey) MarshalPrivateKey() ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(k.private)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+func (k *SigningKey) method() jwt.SigningMethod {
+	if k.Algorithm == AlgEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+// JWK is the public half of a signing key as published in a JWKS document.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (k *SigningKey) JWK() JWK {
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Algorithm}
+
+	switch pub := k.private.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	}
+
+	return jwk
+}
+
+// KeyRing signs access tokens with its active key and validates them with
+// any key it holds, picked by the kid header. During a migration window it
+// also accepts HS256 tokens signed with the legacy shared secret.
+type KeyRing struct {
+	mu sync.RWMutex
+	// sorted holds the keys newest first
+	sorted       []*SigningKey
+	keys         map[string]*SigningKey
+	legacySecret []byte
+	legacyUntil  time.Time
+	lastReload   time.Time
+}
+
+func NewKeyRing() *KeyRing {
+	return &KeyRing{keys: map[string]*SigningKey{}}
+}
+
+// Load replaces the keys held by the ring. The newest key that signs at a
+// given time is the active one then, so a key loaded ahead of its ActiveAt
+// takes over without another load.
+func (k *KeyRing) Load(keys []*SigningKey) error {
+	sorted := make([]*SigningKey, len(keys))
+	copy(sorted, keys)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].CreatedAt.After(sorted[j].CreatedAt)
+	})
+
+	if activeKey(sorted, time.Now()) == nil {
+		return errors.New("no active signing key")
+	}
+
+	byID := make(map[string]*SigningKey, len(sorted))
+	for _, key := range sorted {
+		byID[key.ID] = key
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.sorted = sorted
+	k.keys = byID
+
+	return nil
+}
+
+func activeKey(sorted []*SigningKey, now time.Time) *SigningKey {
+	for _, key := range sorted {
+		if key.SignsAt(now) {
+			return key
+		}
+	}
+	return nil
+}
+
+// ReloadDue reports whether a reload asked for at now, such as for a token
+// signed with a kid the ring doesn't hold, should go ahead. One is allowed
+// per interval, so tokens with made up kids can't cause one per request.
+func (k *KeyRing) ReloadDue(now time.Time, interval time.Duration) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if now.Sub(k.lastReload) < interval {
+		return false
+	}
+	k.lastReload = now
+	return true
+}
+
+// AllowLegacyHS256 keeps HS256 tokens signed with secret valid until the
+// given time so tokens issued before the switch keep working.
+func (k *KeyRing) AllowLegacyHS256(secret string, until time.Time) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.legacySecret = []byte(secret)
+	k.legacyUntil = until
+}
+
+func (k *KeyRing) Active() *SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return activeKey(k.sorted, time.Now())
+}
+
+func (k *KeyRing) JWKS() JWKS {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	set := JWKS{Keys: make([]JWK, 0, len(k.keys))}
+	for _, key := range k.keys {
+		set.Keys = append(set.Keys, key.JWK())
+	}
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].Kid < set.Keys[j].Kid
+	})
+
+	return set
+}
+
+// mfaPendingAudience marks tokens that only prove the password step of a
+// two-factor login. They are never accepted as access tokens.
+const mfaPendingAudience = "mfa_pending"
+
+// Claims are the claims of the tokens signed by a KeyRing.
+type Claims struct {
+	jwt.RegisteredClaims
+	// SessionID ties an access token to the login session it was issued
+	// for, so revoking the session invalidates the token.
+	SessionID string `json:"sid,omitempty"`
+	Role      string `json:"role,omitempty"`
+	// ClientID and Scope are only set on tokens issued to OAuth clients,
+	// which may only do what Scope, space separated as in RFC 9068, allows.
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+}
+
+func (c *Claims) UserID() (uuid.UUID, error) {
+	return uuid.Parse(c.Subject)
+}
+
+// Session returns the session the token was issued for, or uuid.Nil for
+// tokens issued outside of a session.
+func (c *Claims) Session() uuid.UUID {
+	id, err := uuid.Parse(c.SessionID)
+	if err != nil {
+		return uuid.Nil
+	}
+	return id
+}
+
+// IsClientToken reports whether the token was issued to an OAuth client
+// rather than to the user at login.
+func (c *Claims) IsClientToken() bool {
+	return c.ClientID != ""
+}
+
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// MakeJWT returns an access token for userId acting with role. sessionId
+// may be uuid.Nil.
+func (k *KeyRing) MakeJWT(userId, sessionId uuid.UUID, role string, expiresIn time.Duration) (string, error) {
+	claims := Claims{Role: role}
+	if sessionId != uuid.Nil {
+		claims.SessionID = sessionId.String()
+	}
+
+	return k.sign(userId, &claims, expiresIn)
+}
+
+// MakeClientJWT returns an access token letting the OAuth client clientId
+// act for userId within scopes.
+func (k *KeyRing) MakeClientJWT(userId, sessionId, clientId uuid.UUID, scopes []string, expiresIn time.Duration) (string, error) {
+	claims := Claims{
+		SessionID: sessionId.String(),
+		ClientID:  clientId.String(),
+		Scope:     strings.Join(scopes, " "),
+	}
+
+	return k.sign(userId, &claims, expiresIn)
+}
+
+func (k *KeyRing) ValidateJWT(tokenString string) (uuid.UUID, error) {
+	claims, err := k.ParseJWT(tokenString)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return claims.UserID()
+}
+
+// ParseJWT validates an access token and returns its claims.
+func (k *KeyRing) ParseJWT(tokenString string) (*Claims, error) {
+	claims, err := k.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, aud := range claims.Audience {
+		if aud == mfaPendingAudience {
+			return nil, errors.New("mfa pending token used as access token")
+		}
+	}
+
+	return claims, nil
+}
+
+// MakeMFAPendingJWT returns a token proving userId passed the password
+// check, to be traded for an access token once the second factor is in.
+func (k *KeyRing) MakeMFAPendingJWT(userId uuid.UUID, expiresIn time.Duration) (string, error) {
+	claims := Claims{RegisteredClaims: jwt.RegisteredClaims{Audience: jwt.ClaimStrings{mfaPendingAudience}}}
+	return k.sign(userId, &claims, expiresIn)
+}
+
+func (k *KeyRing) ValidateMFAPendingJWT(tokenString string) (uuid.UUID, error) {
+	claims, err := k.parse(tokenString, jwt.WithAudience(mfaPendingAudience))
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return claims.UserID()
+}
+
+// sign fills in the registered claims common to every token and signs
+// claims with the active key.
+func (k *KeyRing) sign(userId uuid.UUID, claims *Claims, expiresIn time.Duration) (string, error) {
+	key := k.Active()
+	if key == nil {
+		return "", errors.New("no active signing key")
+	}
+
+	now := time.Now().UTC()
+	claims.Issuer = "chirpy"
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(expiresIn))
+	claims.Subject = userId.String()
+
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.private)
+}
+
+func (k *KeyRing) parse(tokenString string, opts ...jwt.ParserOption) (*Claims, error) {
+	var claims Claims
+
+	if _, err := jwt.ParseWithClaims(tokenString, &claims, k.keyFunc, opts...); err != nil {
+		return nil, err
+	}
+
+	return &claims, nil
+}
+
+func (k *KeyRing) keyFunc(t *jwt.Token) (interface{}, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if _, ok := t.Method.(*jwt.SigningMethodHMAC); ok {
+		if len(k.legacySecret) == 0 || time.Now().After(k.legacyUntil) {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return k.legacySecret, nil
+	}
+
+	kid, _ := t.Header["kid"].(string)
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	if t.Method.Alg() != key.method().Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+	}
+
+	return key.private.Public(), nil
+}
@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func newTestKeyRing(t *testing.T, alg string) (*KeyRing, *SigningKey) {
+	t.Helper()
+
+	key, err := GenerateSigningKey(alg)
+	if err != nil {
+		t.Fatalf("error generating key: %q", err)
+	}
+
+	ring := NewKeyRing()
+	if err := ring.Load([]*SigningKey{key}); err != nil {
+		t.Fatalf("error loading key ring: %q", err)
+	}
+
+	return ring, key
+}
+
+func TestKeyRingRoundTrip(t *testing.T) {
+	for _, alg := range []string{AlgRS256, AlgEdDSA} {
+		ring, _ := newTestKeyRing(t, alg)
+		id := uuid.New()
+
+		token, err := ring.MakeJWT(id, uuid.Nil, RoleUser, time.Hour)
+		if err != nil {
+			t.Fatalf("%s: error creating jwt token: %q", alg, err)
+		}
+
+		got, err := ring.ValidateJWT(token)
+		if err != nil {
+			t.Fatalf("%s: token not valid: %q", alg, err)
+		}
+		if got != id {
+			t.Fatalf("%s: expected subject %s, got %s", alg, id, got)
+		}
+	}
+}
+
+func TestKeyRingRetiredKeyStillValidates(t *testing.T) {
+	ring, oldKey := newTestKeyRing(t, AlgEdDSA)
+	token, err := ring.MakeJWT(uuid.New(), uuid.Nil, RoleUser, time.Hour)
+	if err != nil {
+		t.Fatalf("error creating jwt token: %q", err)
+	}
+
+	newKey, err := GenerateSigningKey(AlgEdDSA)
+	if err != nil {
+		t.Fatalf("error generating key: %q", err)
+	}
+	newKey.CreatedAt = oldKey.CreatedAt.Add(time.Second)
+	oldKey.RetiredAt = newKey.CreatedAt
+
+	if err := ring.Load([]*SigningKey{oldKey, newKey}); err != nil {
+		t.Fatalf("error loading key ring: %q", err)
+	}
+	if ring.Active().ID != newKey.ID {
+		t.Fatalf("expected %s to be active, got %s", newKey.ID, ring.Active().ID)
+	}
+	if _, err := ring.ValidateJWT(token); err != nil {
+		t.Fatalf("token signed by retired key not valid: %q", err)
+	}
+
+	if err := ring.Load([]*SigningKey{newKey}); err != nil {
+		t.Fatalf("error loading key ring: %q", err)
+	}
+	if _, err := ring.ValidateJWT(token); err == nil {
+		t.Fatalf("token signed by dropped key should not be valid")
+	}
+}
+
+func TestKeyRingPendingKey(t *testing.T) {
+	ring, oldKey := newTestKeyRing(t, AlgEdDSA)
+
+	newKey, err := GenerateSigningKey(AlgEdDSA)
+	if err != nil {
+		t.Fatalf("error generating key: %q", err)
+	}
+	newKey.ActiveAt = time.Now().Add(time.Minute)
+	oldKey.RetiredAt = newKey.ActiveAt
+
+	if err := ring.Load([]*SigningKey{oldKey, newKey}); err != nil {
+		t.Fatalf("error loading key ring: %q", err)
+	}
+	if ring.Active().ID != oldKey.ID {
+		t.Fatalf("expected %s to sign until the new key is active, got %s", oldKey.ID, ring.Active().ID)
+	}
+	if len(ring.JWKS().Keys) != 2 {
+		t.Fatalf("expected the pending key to be published")
+	}
+
+	// the pending key is published, so tokens another server signs with it
+	// once it is active are valid here already
+	other := NewKeyRing()
+	activeKey := *newKey
+	activeKey.ActiveAt = time.Time{}
+	if err := other.Load([]*SigningKey{&activeKey}); err != nil {
+		t.Fatalf("error loading key ring: %q", err)
+	}
+	token, err := other.MakeJWT(uuid.New(), uuid.Nil, RoleUser, time.Hour)
+	if err != nil {
+		t.Fatalf("error creating jwt token: %q", err)
+	}
+	if _, err := ring.ValidateJWT(token); err != nil {
+		t.Fatalf("token signed by the pending key not valid: %q", err)
+	}
+}
+
+func TestKeyRingReloadDue(t *testing.T) {
+	ring := NewKeyRing()
+	now := time.Now()
+
+	if !ring.ReloadDue(now, time.Second) {
+		t.Fatalf("expected the first reload to be due")
+	}
+	if ring.ReloadDue(now.Add(time.Millisecond), time.Second) {
+		t.Fatalf("expected a reload right after another not to be due")
+	}
+	if !ring.ReloadDue(now.Add(time.Second), time.Second) {
+		t.Fatalf("expected a reload to be due after the interval")
+	}
+}
+
+func TestKeyRingLegacyHS256(t *testing.T) {
+	ring, _ := newTestKeyRing(t, AlgRS256)
+	// the way tokens were signed before the key ring
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    "chirpy",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		Subject:   uuid.NewString(),
+	}).SignedString([]byte("Lahcen"))
+	if err != nil {
+		t.Fatalf("error creating jwt token: %q", err)
+	}
+
+	if _, err := ring.ValidateJWT(token); err == nil {
+		t.Fatalf("HS256 token should not be valid without a migration window")
+	}
+
+	ring.AllowLegacyHS256("Lahcen", time.Now().Add(time.Minute))
+	if _, err := ring.ValidateJWT(token); err != nil {
+		t.Fatalf("HS256 token not valid during migration window: %q", err)
+	}
+
+	ring.AllowLegacyHS256("Lahcen", time.Now().Add(-time.Minute))
+	if _, err := ring.ValidateJWT(token); err == nil {
+		t.Fatalf("HS256 token should not be valid after migration window")
+	}
+}
+
+func TestSigningKeyMarshalRoundTrip(t *testing.T) {
+	key, err := GenerateSigningKey(AlgRS256)
+	if err != nil {
+		t.Fatalf("error generating key: %q", err)
+	}
+
+	b, err := key.MarshalPrivateKey()
+	if err != nil {
+		t.Fatalf("error marshalling key: %q", err)
+	}
+
+	parsed, err := ParseSigningKey(key.ID, key.Algorithm, b, key.CreatedAt, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("error parsing key: %q", err)
+	}
+	if parsed.JWK() != key.JWK() {
+		t.Fatalf("parsed key does not match original")
+	}
+
+	if _, err := ParseSigningKey(key.ID, AlgEdDSA, b, key.CreatedAt, time.Time{}, time.Time{}); err == nil {
+		t.Fatalf("expected algorithm mismatch error")
+	}
+}
+
+func TestKeyRingMFAPendingToken(t *testing.T) {
+	ring, _ := newTestKeyRing(t, AlgEdDSA)
+	id := uuid.New()
+
+	pending, err := ring.MakeMFAPendingJWT(id, time.Minute)
+	if err != nil {
+		t.Fatalf("error creating mfa token: %q", err)
+	}
+	if _, err := ring.ValidateJWT(pending); err == nil {
+		t.Fatalf("mfa pending token should not be a valid access token")
+	}
+	if got, err := ring.ValidateMFAPendingJWT(pending); err != nil || got != id {
+		t.Fatalf("mfa pending token not valid: %q", err)
+	}
+
+	access, err := ring.MakeJWT(id, uuid.Nil, RoleUser, time.Minute)
+	if err != nil {
+		t.Fatalf("error creating jwt token: %q", err)
+	}
+	if _, err := ring.ValidateMFAPendingJWT(access); err == nil {
+		t.Fatalf("access token should not be a valid mfa pending token")
+	}
+}
+
+func TestKeyRingSessionAndRoleClaims(t *testing.T) {
+	ring, _ := newTestKeyRing(t, AlgEdDSA)
+	sessionId := uuid.New()
+
+	token, err := ring.MakeJWT(uuid.New(), sessionId, RoleModerator, time.Minute)
+	if err != nil {
+		t.Fatalf("error creating jwt token: %q", err)
+	}
+
+	claims, err := ring.ParseJWT(token)
+	if err != nil {
+		t.Fatalf("token not valid: %q", err)
+	}
+	if claims.Session() != sessionId {
+		t.Fatalf("expected session %s, got %s", sessionId, claims.Session())
+	}
+	if claims.Role != RoleModerator {
+		t.Fatalf("expected role %q, got %q", RoleModerator, claims.Role)
+	}
+}
+
+func TestKeyRingClientClaims(t *testing.T) {
+	ring, _ := newTestKeyRing(t, AlgEdDSA)
+	clientId := uuid.New()
+
+	token, err := ring.MakeClientJWT(uuid.New(), uuid.New(), clientId, []string{ScopeChirpsRead, ScopeChirpsWrite}, time.Minute)
+	if err != nil {
+		t.Fatalf("error creating jwt token: %q", err)
+	}
+
+	claims, err := ring.ParseJWT(token)
+	if err != nil {
+		t.Fatalf("token not valid: %q", err)
+	}
+	if !claims.IsClientToken() || claims.ClientID != clientId.String() {
+		t.Fatalf("expected a token for client %s, got %q", clientId, claims.ClientID)
+	}
+	if !HasScope(claims.Scopes(), ScopeChirpsWrite) || HasScope(claims.Scopes(), ScopeAccountWrite) {
+		t.Fatalf("unexpected scopes %q", claims.Scope)
+	}
+	if claims.Role != "" {
+		t.Fatalf("client tokens should carry no role, got %q", claims.Role)
+	}
+}
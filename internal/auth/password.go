@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgArgon2id = "argon2id"
+	AlgBcrypt   = "bcrypt"
+)
+
+var (
+	ErrPasswordMismatch = errors.New("password does not match")
+	ErrUnknownHash      = errors.New("unknown password hash format")
+)
+
+type Argon2Params struct {
+	// Memory is in KiB.
+	Memory      uint32
+	Time        uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// PasswordHasher hashes new passwords with Algorithm and verifies hashes
+// made by any supported algorithm, telling from the PHC string prefix.
+type PasswordHasher struct {
+	Algorithm  string
+	Argon2     Argon2Params
+	BcryptCost int
+}
+
+// DefaultPasswordHasher follows the second recommended option of RFC 9106.
+var DefaultPasswordHasher = &PasswordHasher{
+	Algorithm: AlgArgon2id,
+	Argon2: Argon2Params{
+		Memory:      64 * 1024,
+		Time:        3,
+		Parallelism: 4,
+		SaltLength:  16,
+		KeyLength:   32,
+	},
+	BcryptCost: 10,
+}
+
+var b64 = base64.RawStdEncoding
+
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	switch h.Algorithm {
+	case AlgArgon2id:
+		salt := make([]byte, h.Argon2.SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, h.Argon2.Time, h.Argon2.Memory, h.Argon2.Parallelism, h.Argon2.KeyLength)
+		return encodeArgon2id(h.Argon2, salt, key), nil
+	case AlgBcrypt:
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+		return string(hashedPassword), err
+	default:
+		return "", fmt.Errorf("unsupported password hash algorithm: %q", h.Algorithm)
+	}
+}
+
+// NeedsRehash reports whether hash was made with another algorithm or
+// weaker parameters than h would use today.
+func (h *PasswordHasher) NeedsRehash(hash string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		if h.Algorithm != AlgArgon2id {
+			return true
+		}
+		params, _, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return true
+		}
+		return params.Memory != h.Argon2.Memory ||
+			params.Time != h.Argon2.Time ||
+			params.Parallelism != h.Argon2.Parallelism ||
+			uint32(len(key)) != h.Argon2.KeyLength
+	case isBcrypt(hash):
+		if h.Algorithm != AlgBcrypt {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost < h.BcryptCost
+	default:
+		return true
+	}
+}
+
+func HashPassword(password string) (string, error) {
+	return DefaultPasswordHasher.Hash(password)
+}
+
+// CheckPasswordHash verifies password against an argon2id or bcrypt hash.
+func CheckPasswordHash(password, hash string) error {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return err
+		}
+		other := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(key, other) != 1 {
+			return ErrPasswordMismatch
+		}
+		return nil
+	case isBcrypt(hash):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	default:
+		return ErrUnknownHash
+	}
+}
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// encodeArgon2id formats a PHC string such as
+// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>.
+func encodeArgon2id(p Argon2Params, salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Time, p.Parallelism, b64.EncodeToString(salt), b64.EncodeToString(key))
+}
+
+func decodeArgon2id(hash string) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != AlgArgon2id {
+		return p, nil, nil, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2 version: %q", parts[2])
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Parallelism); err != nil {
+		return p, nil, nil, fmt.Errorf("invalid argon2 parameters: %q", parts[3])
+	}
+
+	salt, err := b64.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, err
+	}
+	key, err := b64.DecodeString(parts[5])
+	if err != nil {
+		return p, nil, nil, err
+	}
+
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+
+	return p, salt, key, nil
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"testing"
+)
+
+func testHasher(alg string) *PasswordHasher {
+	return &PasswordHasher{
+		Algorithm: alg,
+		Argon2: Argon2Params{
+			Memory:      1024,
+			Time:        1,
+			Parallelism: 1,
+			SaltLength:  16,
+			KeyLength:   32,
+		},
+		BcryptCost: 4,
+	}
+}
+
+func TestPasswordHashRoundTrip(t *testing.T) {
+	for _, alg := range []string{AlgArgon2id, AlgBcrypt} {
+		hash, err := testHasher(alg).Hash("hunter2")
+		if err != nil {
+			t.Fatalf("%s: error hashing password: %q", alg, err)
+		}
+
+		if err := CheckPasswordHash("hunter2", hash); err != nil {
+			t.Fatalf("%s: password should match: %q", alg, err)
+		}
+		if err := CheckPasswordHash("hunter3", hash); err == nil {
+			t.Fatalf("%s: wrong password should not match", alg)
+		}
+	}
+}
+
+func TestPasswordHashFormat(t *testing.T) {
+	hash, err := testHasher(AlgArgon2id).Hash("hunter2")
+	if err != nil {
+		t.Fatalf("error hashing password: %q", err)
+	}
+
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		t.Fatalf("error decoding %q: %q", hash, err)
+	}
+	if params.Memory != 1024 || params.Time != 1 || params.Parallelism != 1 || len(salt) != 16 || len(key) != 32 {
+		t.Fatalf("unexpected parameters decoded from %q", hash)
+	}
+
+	if err := CheckPasswordHash("hunter2", "unset"); err != ErrUnknownHash {
+		t.Fatalf("expected ErrUnknownHash, got %q", err)
+	}
+}
+
+func TestPasswordNeedsRehash(t *testing.T) {
+	argon := testHasher(AlgArgon2id)
+	bcryptHasher := testHasher(AlgBcrypt)
+
+	argonHash, _ := argon.Hash("hunter2")
+	bcryptHash, _ := bcryptHasher.Hash("hunter2")
+
+	if argon.NeedsRehash(argonHash) {
+		t.Fatalf("hash with current parameters should not need a rehash")
+	}
+	if !argon.NeedsRehash(bcryptHash) {
+		t.Fatalf("bcrypt hash should be rehashed to argon2id")
+	}
+	if !bcryptHasher.NeedsRehash(argonHash) {
+		t.Fatalf("argon2id hash should be rehashed to bcrypt")
+	}
+
+	stronger := testHasher(AlgArgon2id)
+	stronger.Argon2.Time = 2
+	if !stronger.NeedsRehash(argonHash) {
+		t.Fatalf("hash with outdated parameters should need a rehash")
+	}
+
+	costlier := testHasher(AlgBcrypt)
+	costlier.BcryptCost = 5
+	if !costlier.NeedsRehash(bcryptHash) {
+		t.Fatalf("hash with lower bcrypt cost should need a rehash")
+	}
+}
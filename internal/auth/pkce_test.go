@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+// the example of RFC 7636 appendix B
+const (
+	rfcVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	rfcChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestS256CodeChallenge(t *testing.T) {
+	if got := S256CodeChallenge(rfcVerifier); got != rfcChallenge {
+		t.Fatalf("expected challenge %q, got %q", rfcChallenge, got)
+	}
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	if !VerifyPKCE(rfcVerifier, rfcChallenge) {
+		t.Fatalf("expected verifier to match its challenge")
+	}
+
+	if VerifyPKCE(rfcVerifier[:len(rfcVerifier)-1]+"l", rfcChallenge) {
+		t.Fatalf("expected another verifier not to match")
+	}
+
+	// a client sending the challenge as verifier means it used "plain"
+	if VerifyPKCE(rfcChallenge, rfcChallenge) {
+		t.Fatalf("expected the challenge itself not to be accepted")
+	}
+}
+
+func TestValidCodeVerifier(t *testing.T) {
+	tests := []struct {
+		verifier string
+		want     bool
+	}{
+		{rfcVerifier, true},
+		{strings.Repeat("a", 42), false},
+		{strings.Repeat("a", 43), true},
+		{strings.Repeat("a", 128), true},
+		{strings.Repeat("a", 129), false},
+		{strings.Repeat("a", 42) + "+", false},
+		{strings.Repeat("a", 42) + "~", true},
+	}
+
+	for _, tt := range tests {
+		if got := ValidCodeVerifier(tt.verifier); got != tt.want {
+			t.Errorf("ValidCodeVerifier(%q) = %v, want %v", tt.verifier, got, tt.want)
+		}
+	}
+}
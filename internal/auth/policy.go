@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError describes why the value of a request field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type PasswordPolicy struct {
+	MinLength int
+	// MaxBytes defaults to 72 as bcrypt ignores anything past that.
+	MaxBytes int
+	Breached *BreachedPasswords
+}
+
+var DefaultPasswordPolicy = &PasswordPolicy{MinLength: 8, MaxBytes: 72}
+
+// Validate returns every rule password breaks, empty if it is acceptable
+// for the account with the given email.
+func (p *PasswordPolicy) Validate(password, email string) []FieldError {
+	var errs []FieldError
+	fail := func(code, message string) {
+		errs = append(errs, FieldError{Field: "password", Code: code, Message: message})
+	}
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		fail("too_short", fmt.Sprintf("password must be at least %d characters", p.MinLength))
+	}
+
+	if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		fail("too_long", fmt.Sprintf("password must be at most %d bytes", p.MaxBytes))
+	}
+
+	if containsEmail(password, email) {
+		fail("contains_email", "password must not contain your email")
+	}
+
+	if p.Breached != nil && p.Breached.Contains(password) {
+		fail("breached", "password appears in a list of breached passwords")
+	}
+
+	return errs
+}
+
+func containsEmail(password, email string) bool {
+	password = strings.ToLower(password)
+	email = strings.ToLower(email)
+	if email == "" {
+		return false
+	}
+
+	if strings.Contains(password, email) {
+		return true
+	}
+
+	// short local parts such as "jo" would reject too many passwords
+	local, _, _ := strings.Cut(email, "@")
+	return len(local) >= 4 && strings.Contains(password, local)
+}
+
+// BreachedPasswords is a set of SHA-1 password hashes, as published by Have
+// I Been Pwned, kept sorted so lookups are a binary search.
+type BreachedPasswords struct {
+	hashes [][sha1.Size]byte
+}
+
+// LoadBreachedPasswords reads a file of upper or lower case hex SHA-1
+// hashes, one per line, each optionally followed by ":<count>".
+func LoadBreachedPasswords(path string) (*BreachedPasswords, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadBreachedPasswords(f)
+}
+
+func ReadBreachedPasswords(r io.Reader) (*BreachedPasswords, error) {
+	var b BreachedPasswords
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		hash, _, _ := strings.Cut(text, ":")
+		var sum [sha1.Size]byte
+		if n, err := hex.Decode(sum[:], []byte(hash)); err != nil || n != sha1.Size {
+			return nil, fmt.Errorf("line %d: invalid SHA-1 hash %q", line, hash)
+		}
+		b.hashes = append(b.hashes, sum)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(b.hashes, func(i, j int) bool {
+		return bytes.Compare(b.hashes[i][:], b.hashes[j][:]) < 0
+	})
+
+	return &b, nil
+}
+
+func (b *BreachedPasswords) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+
+	i := sort.Search(len(b.hashes), func(i int) bool {
+		return bytes.Compare(b.hashes[i][:], sum[:]) >= 0
+	})
+
+	return i < len(b.hashes) && b.hashes[i] == sum
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func codes(errs []FieldError) []string {
+	var out []string
+	for _, e := range errs {
+		out = append(out, e.Code)
+	}
+	return out
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	// SHA-1 of "password1" and "letmein123"
+	breached, err := ReadBreachedPasswords(strings.NewReader(
+		"E38AD214943DAAD1D64C102FAEC29DE4AFE9DA3D:2413945\n" +
+			"e286977b13f1a89e20d0459207545d15fe1eba08\n"))
+	if err != nil {
+		t.Fatalf("error reading breached passwords: %q", err)
+	}
+
+	policy := &PasswordPolicy{MinLength: 8, MaxBytes: 72, Breached: breached}
+
+	cases := map[string]string{
+		"":                         "too_short",
+		"short":                    "too_short",
+		strings.Repeat("a", 73):    "too_long",
+		"xXlahcen@example.comXx":   "contains_email",
+		"LAHCEN-is-great":          "contains_email",
+		"password1":                "breached",
+		"letmein123":               "breached",
+		"correct horse battery 42": "",
+	}
+
+	for password, want := range cases {
+		got := codes(policy.Validate(password, "lahcen@example.com"))
+		if want == "" && len(got) != 0 {
+			t.Fatalf("%q: expected no errors, got %v", password, got)
+		}
+		if want != "" && (len(got) != 1 || got[0] != want) {
+			t.Fatalf("%q: expected [%s], got %v", password, want, got)
+		}
+	}
+}
+
+func TestReadBreachedPasswordsInvalidLine(t *testing.T) {
+	if _, err := ReadBreachedPasswords(strings.NewReader("not-a-hash\n")); err == nil {
+		t.Fatalf("expected error for invalid line")
+	}
+}
@@ -0,0 +1,32 @@
+package auth
+
+import "errors"
+
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var ErrInsufficientRole = errors.New("user lacks required role")
+
+// roles ranks each role above the ones it can act for.
+var roles = map[string]int{
+	RoleUser:      1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
+func ValidRole(role string) bool {
+	_, ok := roles[role]
+	return ok
+}
+
+// HasRole reports whether role grants at least the rights of required.
+// Tokens issued before roles existed carry none and count as RoleUser.
+func HasRole(role, required string) bool {
+	if role == "" {
+		role = RoleUser
+	}
+	return ValidRole(role) && roles[role] >= roles[required]
+}
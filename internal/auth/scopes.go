@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	ScopeChirpsRead   = "chirps:read"
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeAccountWrite = "account:write"
+)
+
+// PersonalAccessTokenPrefix tells personal access tokens apart from JWTs in
+// an Authorization header.
+const PersonalAccessTokenPrefix = "chirpy_pat_"
+
+var ErrInsufficientScope = errors.New("token lacks required scope")
+
+var scopes = map[string]bool{
+	ScopeChirpsRead:   true,
+	ScopeChirpsWrite:  true,
+	ScopeAccountWrite: true,
+}
+
+// AllScopes lists every scope. Access tokens from login carry them all.
+func AllScopes() []string {
+	return []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeAccountWrite}
+}
+
+func ValidScope(scope string) bool {
+	return scopes[scope]
+}
+
+func HasScope(granted []string, scope string) bool {
+	for _, s := range granted {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func MakePersonalAccessToken() (string, error) {
+	token, err := MakeToken()
+	if err != nil {
+		return "", err
+	}
+	return PersonalAccessTokenPrefix + token, nil
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// secret from the RFC 6238 test vectors
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// RFC 6238 lists 8-digit codes, we use the last 6
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for unix, want := range vectors {
+		got, err := TOTPCode(rfcSecret, TOTPStep(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatalf("error computing code: %q", err)
+		}
+		if got != want {
+			t.Fatalf("at %d: expected %s, got %s", unix, want, got)
+		}
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, _ := TOTPCode(rfcSecret, TOTPStep(now))
+
+	if step, ok := ValidateTOTP(rfcSecret, code, now); !ok || step != TOTPStep(now) {
+		t.Fatalf("expected code to be valid at step %d", TOTPStep(now))
+	}
+	if _, ok := ValidateTOTP(rfcSecret, code, now.Add(30*time.Second)); !ok {
+		t.Fatalf("expected code from previous step to be valid")
+	}
+	if _, ok := ValidateTOTP(rfcSecret, code, now.Add(90*time.Second)); ok {
+		t.Fatalf("expected code from three steps ago to be invalid")
+	}
+	if _, ok := ValidateTOTP(rfcSecret, "000000", now); ok {
+		t.Fatalf("expected wrong code to be invalid")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := TOTPProvisioningURI("Chirpy", "user@example.com", rfcSecret)
+
+	if !strings.HasPrefix(uri, "otpauth://totp/Chirpy:user@example.com?") {
+		t.Fatalf("unexpected uri: %s", uri)
+	}
+	if !strings.Contains(uri, "secret="+rfcSecret) {
+		t.Fatalf("uri missing secret: %s", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("error generating codes: %q", err)
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Fatalf("unexpected code format: %q", code)
+		}
+		if seen[code] {
+			t.Fatalf("duplicate code: %q", code)
+		}
+		seen[code] = true
+
+		if NormalizeRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(code, "-", ""))) != code {
+			t.Fatalf("normalized input does not match %q", code)
+		}
+	}
+}
@@ -10,22 +10,100 @@ import (
 	"database/sql"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const countChirpReplies = `-- name: CountChirpReplies :many
+SELECT in_reply_to_id, count(*) AS replies FROM chirps
+WHERE in_reply_to_id = ANY($1::uuid[]) AND status = 'published'
+GROUP BY in_reply_to_id
+`
+
+type CountChirpRepliesRow struct {
+	InReplyToID uuid.NullUUID
+	Replies     int64
+}
+
+func (q *Queries) CountChirpReplies(ctx context.Context, chirpIds []uuid.UUID) ([]CountChirpRepliesRow, error) {
+	rows, err := q.db.QueryContext(ctx, countChirpReplies, pq.Array(chirpIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountChirpRepliesRow
+	for rows.Next() {
+		var i CountChirpRepliesRow
+		if err := rows.Scan(&i.InReplyToID, &i.Replies); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps(id, created_at, updated_at, body, user_id) VALUES (
-    gen_random_uuid (), NOW(), NOW(), $1, $2
+INSERT INTO chirps(id, created_at, updated_at, body, user_id, in_reply_to_id, quote_of_id, status, publish_at) VALUES (
+    gen_random_uuid (), NOW(), NOW(), $1, $2, $3, $4, $5, $6
 )
-returning id, created_at, updated_at, body, user_id
+returning id, created_at, updated_at, body, user_id, in_reply_to_id, rechirp_of_id, quote_of_id, status, publish_at, search_vector
 `
 
 type CreateChirpParams struct {
-	Body   sql.NullString
-	UserID uuid.NullUUID
+	Body        sql.NullString
+	UserID      uuid.NullUUID
+	InReplyToID uuid.NullUUID
+	QuoteOfID   uuid.NullUUID
+	Status      string
+	PublishAt   sql.NullTime
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.InReplyToID,
+		arg.QuoteOfID,
+		arg.Status,
+		arg.PublishAt,
+	)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyToID,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
+		&i.Status,
+		&i.PublishAt,
+		&i.SearchVector,
+	)
+	return i, err
+}
+
+const createRechirp = `-- name: CreateRechirp :one
+INSERT INTO chirps(id, created_at, updated_at, user_id, rechirp_of_id) VALUES (
+    gen_random_uuid (), NOW(), NOW(), $1, $2
+)
+ON CONFLICT (user_id, rechirp_of_id) WHERE rechirp_of_id IS NOT NULL DO NOTHING
+returning id, created_at, updated_at, body, user_id, in_reply_to_id, rechirp_of_id, quote_of_id, status, publish_at, search_vector
+`
+
+type CreateRechirpParams struct {
+	UserID      uuid.NullUUID
+	RechirpOfID uuid.NullUUID
+}
+
+func (q *Queries) CreateRechirp(ctx context.Context, arg CreateRechirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, createRechirp, arg.UserID, arg.RechirpOfID)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -33,6 +111,12 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.InReplyToID,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
+		&i.Status,
+		&i.PublishAt,
+		&i.SearchVector,
 	)
 	return i, err
 }
@@ -46,8 +130,42 @@ func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const deleteDraft = `-- name: DeleteDraft :execrows
+DELETE FROM chirps WHERE id = $1 AND user_id = $2 AND status <> 'published'
+`
+
+type DeleteDraftParams struct {
+	ID     uuid.UUID
+	UserID uuid.NullUUID
+}
+
+func (q *Queries) DeleteDraft(ctx context.Context, arg DeleteDraftParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteDraft, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteRechirp = `-- name: DeleteRechirp :execrows
+DELETE FROM chirps WHERE user_id = $1 AND rechirp_of_id = $2
+`
+
+type DeleteRechirpParams struct {
+	UserID      uuid.NullUUID
+	RechirpOfID uuid.NullUUID
+}
+
+func (q *Queries) DeleteRechirp(ctx context.Context, arg DeleteRechirpParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteRechirp, arg.UserID, arg.RechirpOfID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id from chirps WHERE id = $1
+SELECT id, created_at, updated_at, body, user_id, in_reply_to_id, rechirp_of_id, quote_of_id, status, publish_at, search_vector from chirps WHERE id = $1
 `
 
 func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -59,16 +177,197 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.InReplyToID,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
+		&i.Status,
+		&i.PublishAt,
+		&i.SearchVector,
 	)
 	return i, err
 }
 
-const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id from chirps ORDER BY created_at ASC
+const getChirpForUpdate = `-- name: GetChirpForUpdate :one
+SELECT id, created_at, updated_at, body, user_id, in_reply_to_id, rechirp_of_id, quote_of_id, status, publish_at, search_vector from chirps WHERE id = $1 FOR UPDATE
+`
+
+func (q *Queries) GetChirpForUpdate(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpForUpdate, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyToID,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
+		&i.Status,
+		&i.PublishAt,
+		&i.SearchVector,
+	)
+	return i, err
+}
+
+const getChirpsByIDs = `-- name: GetChirpsByIDs :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to_id, rechirp_of_id, quote_of_id, status, publish_at, search_vector from chirps WHERE id = ANY($1::uuid[])
+`
+
+func (q *Queries) GetChirpsByIDs(ctx context.Context, ids []uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByIDs, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyToID,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+			&i.Status,
+			&i.PublishAt,
+			&i.SearchVector,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDraftForUpdate = `-- name: GetDraftForUpdate :one
+SELECT id, created_at, updated_at, body, user_id, in_reply_to_id, rechirp_of_id, quote_of_id, status, publish_at, search_vector from chirps WHERE id = $1 AND user_id = $2 AND status <> 'published'
+FOR UPDATE
+`
+
+type GetDraftForUpdateParams struct {
+	ID     uuid.UUID
+	UserID uuid.NullUUID
+}
+
+func (q *Queries) GetDraftForUpdate(ctx context.Context, arg GetDraftForUpdateParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getDraftForUpdate, arg.ID, arg.UserID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyToID,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
+		&i.Status,
+		&i.PublishAt,
+		&i.SearchVector,
+	)
+	return i, err
+}
+
+const getPublishedChirp = `-- name: GetPublishedChirp :one
+SELECT id, created_at, updated_at, body, user_id, in_reply_to_id, rechirp_of_id, quote_of_id, status, publish_at, search_vector from chirps WHERE id = $1 AND status = 'published'
+`
+
+func (q *Queries) GetPublishedChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getPublishedChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyToID,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
+		&i.Status,
+		&i.PublishAt,
+		&i.SearchVector,
+	)
+	return i, err
+}
+
+const getRechirp = `-- name: GetRechirp :one
+SELECT id, created_at, updated_at, body, user_id, in_reply_to_id, rechirp_of_id, quote_of_id, status, publish_at, search_vector from chirps WHERE user_id = $1 AND rechirp_of_id = $2
+`
+
+type GetRechirpParams struct {
+	UserID      uuid.NullUUID
+	RechirpOfID uuid.NullUUID
+}
+
+func (q *Queries) GetRechirp(ctx context.Context, arg GetRechirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getRechirp, arg.UserID, arg.RechirpOfID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyToID,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
+		&i.Status,
+		&i.PublishAt,
+		&i.SearchVector,
+	)
+	return i, err
+}
+
+const isChirpEditable = `-- name: IsChirpEditable :one
+SELECT COALESCE(created_at > NOW() - make_interval(secs => $1::float8), false) AS editable
+FROM chirps WHERE id = $2
+`
+
+type IsChirpEditableParams struct {
+	WindowSeconds float64
+	ID            uuid.UUID
+}
+
+// created_at has no time zone, so the edit window is measured with the
+// clock that wrote it
+func (q *Queries) IsChirpEditable(ctx context.Context, arg IsChirpEditableParams) (bool, error) {
+	row := q.db.QueryRowContext(ctx, isChirpEditable, arg.WindowSeconds, arg.ID)
+	var editable bool
+	err := row.Scan(&editable)
+	return editable, err
+}
+
+const listChirpAncestors = `-- name: ListChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to_id, chirps.rechirp_of_id, chirps.quote_of_id, chirps.status, chirps.publish_at, chirps.search_vector, 1 AS depth FROM chirps
+    WHERE id = (SELECT in_reply_to_id FROM chirps WHERE chirps.id = $1)
+    UNION ALL
+    SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to_id, chirps.rechirp_of_id, chirps.quote_of_id, chirps.status, chirps.publish_at, chirps.search_vector, ancestors.depth + 1 FROM chirps
+    JOIN ancestors ON chirps.id = ancestors.in_reply_to_id
+    WHERE ancestors.depth < $2::int
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to_id, rechirp_of_id, quote_of_id, status, publish_at, search_vector FROM ancestors
+ORDER BY depth DESC
 `
 
-func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps)
+type ListChirpAncestorsParams struct {
+	ChirpID  uuid.UUID
+	MaxDepth int32
+}
+
+func (q *Queries) ListChirpAncestors(ctx context.Context, arg ListChirpAncestorsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpAncestors, arg.ChirpID, arg.MaxDepth)
 	if err != nil {
 		return nil, err
 	}
@@ -82,6 +381,95 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.InReplyToID,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+			&i.Status,
+			&i.PublishAt,
+			&i.SearchVector,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpReplies = `-- name: ListChirpReplies :many
+WITH RECURSIVE tree AS (
+    SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to_id, chirps.rechirp_of_id, chirps.quote_of_id, chirps.status, chirps.publish_at, chirps.search_vector, 1 AS depth,
+        ARRAY[to_char(created_at, 'YYYYMMDDHH24MISSUS') || id::text] AS path
+    FROM chirps WHERE in_reply_to_id = $1 AND status = 'published'
+    UNION ALL
+    SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to_id, chirps.rechirp_of_id, chirps.quote_of_id, chirps.status, chirps.publish_at, chirps.search_vector, tree.depth + 1,
+        tree.path || (to_char(chirps.created_at, 'YYYYMMDDHH24MISSUS') || chirps.id::text)
+    FROM chirps JOIN tree ON chirps.in_reply_to_id = tree.id
+    WHERE tree.depth < $2::int AND chirps.status = 'published'
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to_id, rechirp_of_id, quote_of_id, status, publish_at, depth, path::text[] FROM tree
+WHERE $3::text[] IS NULL OR path > $3::text[]
+ORDER BY path
+LIMIT $4
+`
+
+type ListChirpRepliesParams struct {
+	ChirpID   uuid.NullUUID
+	MaxDepth  int32
+	AfterPath []string
+	Limit     int32
+}
+
+type ListChirpRepliesRow struct {
+	ID          uuid.UUID
+	CreatedAt   sql.NullTime
+	UpdatedAt   sql.NullTime
+	Body        sql.NullString
+	UserID      uuid.NullUUID
+	InReplyToID uuid.NullUUID
+	RechirpOfID uuid.NullUUID
+	QuoteOfID   uuid.NullUUID
+	Status      string
+	PublishAt   sql.NullTime
+	Depth       int32
+	Path        []string
+}
+
+// replies are walked depth first, each chirp's replies oldest first; path
+// sorts that way since every element has the same width. Pages start after
+// a path rather than a reply, which may have been deleted since.
+func (q *Queries) ListChirpReplies(ctx context.Context, arg ListChirpRepliesParams) ([]ListChirpRepliesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpReplies,
+		arg.ChirpID,
+		arg.MaxDepth,
+		pq.Array(arg.AfterPath),
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListChirpRepliesRow
+	for rows.Next() {
+		var i ListChirpRepliesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyToID,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+			&i.Status,
+			&i.PublishAt,
+			&i.Depth,
+			pq.Array(&i.Path),
 		); err != nil {
 			return nil, err
 		}
@@ -96,12 +484,38 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 	return items, nil
 }
 
-const getChirpsByAuthorId = `-- name: GetChirpsByAuthorId :many
-SELECT id, created_at, updated_at, body, user_id from chirps WHERE user_id = $1 ORDER BY created_at ASC
+const listChirps = `-- name: ListChirps :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to_id, rechirp_of_id, quote_of_id, status, publish_at, search_vector from chirps
+WHERE status = 'published'
+    AND ($1::uuid IS NULL OR user_id = $1)
+    AND ($2::text IS NULL
+        OR id IN (SELECT chirp_id FROM chirp_tags WHERE tag = $2))
+    AND ($3::uuid IS NULL
+        OR id IN (SELECT chirp_id FROM chirp_mentions WHERE user_id = $3))
+    AND ($4::timestamp IS NULL
+        OR (created_at, id) > ($4, $5::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT $6
 `
 
-func (q *Queries) GetChirpsByAuthorId(ctx context.Context, userID uuid.NullUUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsByAuthorId, userID)
+type ListChirpsParams struct {
+	AuthorID        uuid.NullUUID
+	Tag             sql.NullString
+	MentionedUserID uuid.NullUUID
+	AfterCreatedAt  sql.NullTime
+	AfterID         uuid.NullUUID
+	Limit           int32
+}
+
+func (q *Queries) ListChirps(ctx context.Context, arg ListChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirps,
+		arg.AuthorID,
+		arg.Tag,
+		arg.MentionedUserID,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -115,6 +529,12 @@ func (q *Queries) GetChirpsByAuthorId(ctx context.Context, userID uuid.NullUUID)
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.InReplyToID,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+			&i.Status,
+			&i.PublishAt,
+			&i.SearchVector,
 		); err != nil {
 			return nil, err
 		}
@@ -129,12 +549,38 @@ func (q *Queries) GetChirpsByAuthorId(ctx context.Context, userID uuid.NullUUID)
 	return items, nil
 }
 
-const getChirpsByAuthorIdDESC = `-- name: GetChirpsByAuthorIdDESC :many
-SELECT id, created_at, updated_at, body, user_id from chirps WHERE user_id = $1 ORDER BY created_at DESC
+const listChirpsDESC = `-- name: ListChirpsDESC :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to_id, rechirp_of_id, quote_of_id, status, publish_at, search_vector from chirps
+WHERE status = 'published'
+    AND ($1::uuid IS NULL OR user_id = $1)
+    AND ($2::text IS NULL
+        OR id IN (SELECT chirp_id FROM chirp_tags WHERE tag = $2))
+    AND ($3::uuid IS NULL
+        OR id IN (SELECT chirp_id FROM chirp_mentions WHERE user_id = $3))
+    AND ($4::timestamp IS NULL
+        OR (created_at, id) < ($4, $5::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT $6
 `
 
-func (q *Queries) GetChirpsByAuthorIdDESC(ctx context.Context, userID uuid.NullUUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsByAuthorIdDESC, userID)
+type ListChirpsDESCParams struct {
+	AuthorID        uuid.NullUUID
+	Tag             sql.NullString
+	MentionedUserID uuid.NullUUID
+	BeforeCreatedAt sql.NullTime
+	BeforeID        uuid.NullUUID
+	Limit           int32
+}
+
+func (q *Queries) ListChirpsDESC(ctx context.Context, arg ListChirpsDESCParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsDESC,
+		arg.AuthorID,
+		arg.Tag,
+		arg.MentionedUserID,
+		arg.BeforeCreatedAt,
+		arg.BeforeID,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -148,6 +594,12 @@ func (q *Queries) GetChirpsByAuthorIdDESC(ctx context.Context, userID uuid.NullU
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.InReplyToID,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+			&i.Status,
+			&i.PublishAt,
+			&i.SearchVector,
 		); err != nil {
 			return nil, err
 		}
@@ -162,12 +614,13 @@ func (q *Queries) GetChirpsByAuthorIdDESC(ctx context.Context, userID uuid.NullU
 	return items, nil
 }
 
-const getChirpsDESC = `-- name: GetChirpsDESC :many
-SELECT id, created_at, updated_at, body, user_id from chirps ORDER BY created_at DESC
+const listUserDrafts = `-- name: ListUserDrafts :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to_id, rechirp_of_id, quote_of_id, status, publish_at, search_vector from chirps WHERE user_id = $1 AND status <> 'published'
+ORDER BY publish_at NULLS LAST, created_at DESC
 `
 
-func (q *Queries) GetChirpsDESC(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsDESC)
+func (q *Queries) ListUserDrafts(ctx context.Context, userID uuid.NullUUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listUserDrafts, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -181,6 +634,12 @@ func (q *Queries) GetChirpsDESC(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.InReplyToID,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+			&i.Status,
+			&i.PublishAt,
+			&i.SearchVector,
 		); err != nil {
 			return nil, err
 		}
@@ -194,3 +653,232 @@ func (q *Queries) GetChirpsDESC(ctx context.Context) ([]Chirp, error) {
 	}
 	return items, nil
 }
+
+const publishDraft = `-- name: PublishDraft :one
+UPDATE chirps SET status = 'published', publish_at = NULL, created_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND user_id = $2 AND status <> 'published'
+returning id, created_at, updated_at, body, user_id, in_reply_to_id, rechirp_of_id, quote_of_id, status, publish_at, search_vector
+`
+
+type PublishDraftParams struct {
+	ID     uuid.UUID
+	UserID uuid.NullUUID
+}
+
+func (q *Queries) PublishDraft(ctx context.Context, arg PublishDraftParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, publishDraft, arg.ID, arg.UserID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyToID,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
+		&i.Status,
+		&i.PublishAt,
+		&i.SearchVector,
+	)
+	return i, err
+}
+
+const publishDueChirps = `-- name: PublishDueChirps :many
+UPDATE chirps SET status = 'published', created_at = NOW(), updated_at = NOW()
+WHERE status = 'scheduled' AND id IN (
+    SELECT id FROM chirps
+    WHERE status = 'scheduled' AND publish_at <= NOW()
+    ORDER BY publish_at
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+returning id, created_at, updated_at, body, user_id, in_reply_to_id, rechirp_of_id, quote_of_id, status, publish_at, search_vector
+`
+
+// SKIP LOCKED lets several servers share the work without publishing a
+// chirp twice: a row one of them locked is left to it
+func (q *Queries) PublishDueChirps(ctx context.Context, limit int32) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, publishDueChirps, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyToID,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+			&i.Status,
+			&i.PublishAt,
+			&i.SearchVector,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchChirps = `-- name: SearchChirps :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to_id, rechirp_of_id, quote_of_id, status, publish_at, rank,
+    ts_headline('english', body, to_tsquery('english', $1), $2::text) AS headline
+FROM (
+    SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to_id, chirps.rechirp_of_id, chirps.quote_of_id, chirps.status, chirps.publish_at, chirps.search_vector, ts_rank(search_vector, to_tsquery('english', $1))::real AS rank
+    FROM chirps
+    WHERE search_vector @@ to_tsquery('english', $1)
+        AND status = 'published'
+        AND ($3::uuid IS NULL OR user_id = $3)
+) AS matches
+WHERE $4::real IS NULL
+    OR (rank, created_at, id) < ($4, $5::timestamp, $6::uuid)
+ORDER BY rank DESC, created_at DESC, id DESC
+LIMIT $7
+`
+
+type SearchChirpsParams struct {
+	Query           string
+	HeadlineOptions string
+	AuthorID        uuid.NullUUID
+	BeforeRank      sql.NullFloat64
+	BeforeCreatedAt sql.NullTime
+	BeforeID        uuid.NullUUID
+	Limit           int32
+}
+
+type SearchChirpsRow struct {
+	ID          uuid.UUID
+	CreatedAt   sql.NullTime
+	UpdatedAt   sql.NullTime
+	Body        sql.NullString
+	UserID      uuid.NullUUID
+	InReplyToID uuid.NullUUID
+	RechirpOfID uuid.NullUUID
+	QuoteOfID   uuid.NullUUID
+	Status      string
+	PublishAt   sql.NullTime
+	Rank        float32
+	Headline    string
+}
+
+func (q *Queries) SearchChirps(ctx context.Context, arg SearchChirpsParams) ([]SearchChirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchChirps,
+		arg.Query,
+		arg.HeadlineOptions,
+		arg.AuthorID,
+		arg.BeforeRank,
+		arg.BeforeCreatedAt,
+		arg.BeforeID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchChirpsRow
+	for rows.Next() {
+		var i SearchChirpsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyToID,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+			&i.Status,
+			&i.PublishAt,
+			&i.Rank,
+			&i.Headline,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateChirpBody = `-- name: UpdateChirpBody :one
+UPDATE chirps SET body = $2, updated_at = NOW() WHERE id = $1
+returning id, created_at, updated_at, body, user_id, in_reply_to_id, rechirp_of_id, quote_of_id, status, publish_at, search_vector
+`
+
+type UpdateChirpBodyParams struct {
+	ID   uuid.UUID
+	Body sql.NullString
+}
+
+func (q *Queries) UpdateChirpBody(ctx context.Context, arg UpdateChirpBodyParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirpBody, arg.ID, arg.Body)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyToID,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
+		&i.Status,
+		&i.PublishAt,
+		&i.SearchVector,
+	)
+	return i, err
+}
+
+const updateDraft = `-- name: UpdateDraft :one
+UPDATE chirps SET body = $2, status = $3, publish_at = $4, updated_at = NOW() WHERE id = $1
+returning id, created_at, updated_at, body, user_id, in_reply_to_id, rechirp_of_id, quote_of_id, status, publish_at, search_vector
+`
+
+type UpdateDraftParams struct {
+	ID        uuid.UUID
+	Body      sql.NullString
+	Status    string
+	PublishAt sql.NullTime
+}
+
+func (q *Queries) UpdateDraft(ctx context.Context, arg UpdateDraftParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateDraft,
+		arg.ID,
+		arg.Body,
+		arg.Status,
+		arg.PublishAt,
+	)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyToID,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
+		&i.Status,
+		&i.PublishAt,
+		&i.SearchVector,
+	)
+	return i, err
+}
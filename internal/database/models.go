@@ -6,25 +6,194 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+type AuditEvent struct {
+	ID         int64
+	CreatedAt  time.Time
+	ActorID    uuid.NullUUID
+	Action     string
+	TargetType sql.NullString
+	TargetID   sql.NullString
+	Ip         string
+	UserAgent  string
+	Payload    json.RawMessage
+}
+
 type Chirp struct {
+	ID           uuid.UUID
+	CreatedAt    sql.NullTime
+	UpdatedAt    sql.NullTime
+	Body         sql.NullString
+	UserID       uuid.NullUUID
+	InReplyToID  uuid.NullUUID
+	RechirpOfID  uuid.NullUUID
+	QuoteOfID    uuid.NullUUID
+	Status       string
+	PublishAt    sql.NullTime
+	SearchVector interface{}
+}
+
+type ChirpLike struct {
+	ChirpID   uuid.UUID
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+type ChirpMediaFile struct {
+	ChirpID  uuid.UUID
+	MediaID  uuid.UUID
+	Position int32
+}
+
+type ChirpMention struct {
+	ChirpID     uuid.UUID
+	UserID      uuid.UUID
+	StartOffset int32
+	EndOffset   int32
+}
+
+type ChirpRevision struct {
+	ID         uuid.UUID
+	ChirpID    uuid.UUID
+	Body       string
+	CreatedAt  time.Time
+	ReplacedAt time.Time
+}
+
+type ChirpTag struct {
+	ChirpID     uuid.UUID
+	Tag         string
+	StartOffset int32
+	EndOffset   int32
+}
+
+type EmailVerification struct {
+	ID        uuid.UUID
+	TokenHash string
+	UserID    uuid.UUID
+	Email     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type LoginAttempt struct {
+	Key               string
+	Failures          int32
+	LastFailureAt     time.Time
+	PreviousFailureAt sql.NullTime
+}
+
+type MagicLink struct {
 	ID        uuid.UUID
-	CreatedAt sql.NullTime
-	UpdatedAt sql.NullTime
-	Body      sql.NullString
-	UserID    uuid.NullUUID
+	TokenHash string
+	UserID    uuid.UUID
+	Email     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type MediaFile struct {
+	ID                   uuid.UUID
+	UserID               uuid.UUID
+	ContentType          string
+	SizeBytes            int64
+	Width                int32
+	Height               int32
+	StorageKey           string
+	ThumbnailKey         string
+	ThumbnailContentType string
+	CreatedAt            time.Time
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash            string
+	ClientID            uuid.UUID
+	UserID              uuid.UUID
+	RedirectUri         string
+	Scopes              []string
+	CodeChallenge       string
+	CreatedAt           time.Time
+	ExpiresAt           time.Time
+	UsedAt              sql.NullTime
+	SessionID           uuid.NullUUID
+	RedirectUriProvided bool
+}
+
+type OauthClient struct {
+	ID           uuid.UUID
+	OwnerID      uuid.UUID
+	Name         string
+	SecretHash   sql.NullString
+	RedirectUris []string
+	CreatedAt    time.Time
+}
+
+type PasswordReset struct {
+	ID        uuid.UUID
+	TokenHash string
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Name       string
+	TokenHash  string
+	Scopes     []string
+	CreatedAt  time.Time
+	LastUsedAt sql.NullTime
+	ExpiresAt  sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+type RecoveryCode struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CodeHash  string
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
 }
 
 type RefreshToken struct {
-	Token     string
-	CreatedAt sql.NullTime
-	UpdatedAt sql.NullTime
-	UserID    uuid.NullUUID
-	ExpiresAt sql.NullTime
-	RevokedAt sql.NullTime
+	Token      string
+	CreatedAt  sql.NullTime
+	UpdatedAt  sql.NullTime
+	UserID     uuid.NullUUID
+	ExpiresAt  sql.NullTime
+	RevokedAt  sql.NullTime
+	FamilyID   uuid.UUID
+	ReplacedBy sql.NullString
+}
+
+type Session struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	UserAgent  string
+	Ip         string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	RevokedAt  sql.NullTime
+	ClientID   uuid.NullUUID
+	Scopes     []string
+}
+
+type SigningKey struct {
+	Kid        string
+	CreatedAt  time.Time
+	Algorithm  string
+	PrivateKey string
+	RetiredAt  sql.NullTime
+	ActiveAt   time.Time
 }
 
 type User struct {
@@ -34,4 +203,15 @@ type User struct {
 	Email          sql.NullString
 	HashedPassword string
 	IsChirpyRed    bool
+	VerifiedAt     sql.NullTime
+	Role           string
+	Handle         sql.NullString
+}
+
+type UserTotp struct {
+	UserID       uuid.UUID
+	Secret       string
+	CreatedAt    time.Time
+	ConfirmedAt  sql.NullTime
+	LastUsedStep int64
 }
@@ -10,13 +10,14 @@ import (
 	"database/sql"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, created_at, updated_at, email, hashed_password) VALUES (
     gen_random_uuid (), NOW(), NOW(), $1, $2
 )
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, verified_at, role, handle
 `
 
 type CreateUserParams struct {
@@ -34,12 +35,27 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.VerifiedAt,
+		&i.Role,
+		&i.Handle,
 	)
 	return i, err
 }
 
+const deleteUser = `-- name: DeleteUser :execrows
+DELETE FROM users WHERE id = $1
+`
+
+func (q *Queries) DeleteUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getUser = `-- name: GetUser :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red from users WHERE email=$1
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, verified_at, role, handle from users WHERE email=$1
 `
 
 func (q *Queries) GetUser(ctx context.Context, email sql.NullString) (User, error) {
@@ -52,13 +68,151 @@ func (q *Queries) GetUser(ctx context.Context, email sql.NullString) (User, erro
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.VerifiedAt,
+		&i.Role,
+		&i.Handle,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, verified_at, role, handle from users WHERE id=$1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.VerifiedAt,
+		&i.Role,
+		&i.Handle,
+	)
+	return i, err
+}
+
+const getUsersByHandles = `-- name: GetUsersByHandles :many
+SELECT id, handle from users WHERE lower(handle) = ANY($1::text[])
+`
+
+type GetUsersByHandlesRow struct {
+	ID     uuid.UUID
+	Handle sql.NullString
+}
+
+func (q *Queries) GetUsersByHandles(ctx context.Context, handles []string) ([]GetUsersByHandlesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersByHandles, pq.Array(handles))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUsersByHandlesRow
+	for rows.Next() {
+		var i GetUsersByHandlesRow
+		if err := rows.Scan(&i.ID, &i.Handle); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markUserVerified = `-- name: MarkUserVerified :execrows
+UPDATE users SET verified_at = NOW(), updated_at = NOW() WHERE id = $1 AND email = $2
+`
+
+type MarkUserVerifiedParams struct {
+	ID    uuid.UUID
+	Email sql.NullString
+}
+
+func (q *Queries) MarkUserVerified(ctx context.Context, arg MarkUserVerifiedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markUserVerified, arg.ID, arg.Email)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setUserHandle = `-- name: SetUserHandle :one
+UPDATE users SET handle = $2, updated_at = NOW() WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, verified_at, role, handle
+`
+
+type SetUserHandleParams struct {
+	ID     uuid.UUID
+	Handle sql.NullString
+}
+
+func (q *Queries) SetUserHandle(ctx context.Context, arg SetUserHandleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserHandle, arg.ID, arg.Handle)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.VerifiedAt,
+		&i.Role,
+		&i.Handle,
 	)
 	return i, err
 }
 
+const setUserRole = `-- name: SetUserRole :execrows
+UPDATE users SET role = $2, updated_at = NOW() WHERE id = $1
+`
+
+type SetUserRoleParams struct {
+	ID   uuid.UUID
+	Role string
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setUserRole, arg.ID, arg.Role)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setUserRoleByEmail = `-- name: SetUserRoleByEmail :execrows
+UPDATE users SET role = $2, updated_at = NOW()
+WHERE email = $1 AND verified_at IS NOT NULL AND role <> $2
+`
+
+type SetUserRoleByEmailParams struct {
+	Email sql.NullString
+	Role  string
+}
+
+// only verified addresses, or whoever signs up first with one would get it
+func (q *Queries) SetUserRoleByEmail(ctx context.Context, arg SetUserRoleByEmailParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setUserRoleByEmail, arg.Email, arg.Role)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const updateUser = `-- name: UpdateUser :one
-UPDATE users SET email = $2, hashed_password = $3, updated_at = NOW() WHERE id = $1
-RETURNING id, email, created_at, updated_at
+UPDATE users SET email = $2, hashed_password = $3, updated_at = NOW(),
+    verified_at = CASE WHEN email = $2 THEN verified_at ELSE NULL END
+WHERE id = $1
+RETURNING id, email, created_at, updated_at, is_chirpy_red, verified_at, role, handle
 `
 
 type UpdateUserParams struct {
@@ -68,10 +222,14 @@ type UpdateUserParams struct {
 }
 
 type UpdateUserRow struct {
-	ID        uuid.UUID
-	Email     sql.NullString
-	CreatedAt sql.NullTime
-	UpdatedAt sql.NullTime
+	ID          uuid.UUID
+	Email       sql.NullString
+	CreatedAt   sql.NullTime
+	UpdatedAt   sql.NullTime
+	IsChirpyRed bool
+	VerifiedAt  sql.NullTime
+	Role        string
+	Handle      sql.NullString
 }
 
 func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (UpdateUserRow, error) {
@@ -82,10 +240,28 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (UpdateU
 		&i.Email,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.IsChirpyRed,
+		&i.VerifiedAt,
+		&i.Role,
+		&i.Handle,
 	)
 	return i, err
 }
 
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users SET hashed_password = $2, updated_at = NOW() WHERE id = $1
+`
+
+type UpdateUserPasswordParams struct {
+	ID             uuid.UUID
+	HashedPassword string
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.ID, arg.HashedPassword)
+	return err
+}
+
 const upgradeUserMembership = `-- name: UpgradeUserMembership :exec
 UPDATE users SET is_chirpy_red = true, updated_at = NOW() WHERE id = $1
 `
@@ -0,0 +1,149 @@
+// Package entities finds hashtags and mentions in chirp bodies.
+package entities
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Hashtag is a #tag in a body. Start and End are byte offsets of the whole
+// "#tag", End excluded. Tag is lowercased and without the '#'.
+type Hashtag struct {
+	Tag   string
+	Start int
+	End   int
+}
+
+// MaxHandleLength is the longest a handle can be.
+const MaxHandleLength = 30
+
+// Mention is an @handle in a body. Emails are private, so users are only
+// mentioned by the handle they chose. Start and End are byte offsets of the
+// whole "@handle", End excluded. Handle is without the '@'.
+type Mention struct {
+	Handle string
+	Start  int
+	End    int
+}
+
+// Entities are the hashtags and mentions of a body, in order.
+type Entities struct {
+	Hashtags []Hashtag
+	Mentions []Mention
+}
+
+// Parse finds the entities of body. A '#' or '@' only starts one at the
+// beginning of a word, so "a#b" or "me@example.com" are left alone, and
+// "@me@example.com" is not a mention of "me".
+func Parse(body string) Entities {
+	var e Entities
+
+	prev := rune(-1)
+	for i := 0; i < len(body); {
+		r, size := utf8.DecodeRuneInString(body[i:])
+
+		end := 0
+		switch {
+		case r == '#' && !isWordRune(prev) && prev != '#':
+			if end = scanTag(body, i+size); end > 0 {
+				e.Hashtags = append(e.Hashtags, Hashtag{
+					Tag:   NormalizeTag(body[i+size : end]),
+					Start: i,
+					End:   end,
+				})
+			}
+		case r == '@' && !isWordRune(prev) && !isLocalRune(prev) && prev != '@':
+			if end = scanHandle(body, i+size); end > 0 {
+				e.Mentions = append(e.Mentions, Mention{
+					Handle: body[i+size : end],
+					Start:  i,
+					End:    end,
+				})
+			}
+		}
+
+		if end > 0 {
+			i = end
+			prev, _ = utf8.DecodeLastRuneInString(body[:end])
+			continue
+		}
+		i += size
+		prev = r
+	}
+
+	return e
+}
+
+// NormalizeTag is how a tag is stored and looked up: lowercased, without a
+// leading '#'.
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(tag, "#"))
+}
+
+// ValidTag reports whether tag, once normalized, is something Parse could
+// have found.
+func ValidTag(tag string) bool {
+	tag = NormalizeTag(tag)
+	return tag != "" && scanTag(tag, 0) == len(tag)
+}
+
+// ValidHandle reports whether handle is something users can be mentioned
+// by: ASCII letters, digits and '_', at most MaxHandleLength of them.
+func ValidHandle(handle string) bool {
+	return handle != "" && scanHandle(handle, 0) == len(handle)
+}
+
+// scanTag returns where a tag starting at start ends, or 0 if there is
+// none. Tags are word characters with at least one letter, so "#1" is not
+// one.
+func scanTag(s string, start int) int {
+	end, letter := start, false
+	for end < len(s) {
+		r, size := utf8.DecodeRuneInString(s[end:])
+		if !isWordRune(r) {
+			break
+		}
+		letter = letter || unicode.IsLetter(r)
+		end += size
+	}
+
+	if !letter {
+		return 0
+	}
+	return end
+}
+
+// scanHandle returns where a handle starting at start ends, or 0 if there
+// is none. A handle running into other word characters, an email or past
+// MaxHandleLength is not cut short, it isn't one.
+func scanHandle(s string, start int) int {
+	end := start
+	for end < len(s) && isHandleByte(s[end]) {
+		end++
+	}
+
+	if end == start || end-start > MaxHandleLength {
+		return 0
+	}
+	if end < len(s) {
+		if r, _ := utf8.DecodeRuneInString(s[end:]); isWordRune(r) || r == '@' {
+			return 0
+		}
+	}
+	return end
+}
+
+func isHandleByte(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' || b == '_'
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || r == '_'
+}
+
+// isLocalRune reports whether r may appear in the local part of an email
+// besides word characters.
+func isLocalRune(r rune) bool {
+	return r == '.' || r == '+' || r == '-' || r == '%'
+}
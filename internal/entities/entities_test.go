@@ -0,0 +1,102 @@
+package entities
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseHashtags(t *testing.T) {
+	tests := []struct {
+		body string
+		want []Hashtag
+	}{
+		{"no tags here", nil},
+		{"#Go", []Hashtag{{"go", 0, 3}}},
+		{"learning #golang, #SQL!", []Hashtag{{"golang", 9, 16}, {"sql", 18, 22}}},
+		{"#café time", []Hashtag{{"café", 0, 6}}},
+		{"日本 #東京", []Hashtag{{"東京", 7, 14}}},
+		{"#snake_case", []Hashtag{{"snake_case", 0, 11}}},
+		// numbers alone are not tags, but tags may contain them
+		{"#1 #go2", []Hashtag{{"go2", 3, 7}}},
+		// only at the start of a word
+		{"a#b c##d #e#f", []Hashtag{{"e", 9, 11}}},
+		{"#", nil},
+	}
+
+	for _, tt := range tests {
+		if got := Parse(tt.body).Hashtags; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q).Hashtags = %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		body string
+		want []Mention
+	}{
+		{"hi @ann", []Mention{{"ann", 3, 7}}},
+		{"@Ann_B, @c3po.", []Mention{{"Ann_B", 0, 6}, {"c3po", 8, 13}}},
+		{"(@bob)", []Mention{{"bob", 1, 5}}},
+		// emails are neither mentions nor handles
+		{"mail me@example.com", nil},
+		{"@ann@example.com", nil},
+		{"@zoë", nil},
+		{"@", nil},
+		{"@@ann", nil},
+		{"@abcdefghijklmnopqrstuvwxyz01234", nil},
+	}
+
+	for _, tt := range tests {
+		if got := Parse(tt.body).Mentions; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q).Mentions = %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestParseOffsets(t *testing.T) {
+	body := "über #Tag and @ann"
+	e := Parse(body)
+
+	if len(e.Hashtags) != 1 || body[e.Hashtags[0].Start:e.Hashtags[0].End] != "#Tag" {
+		t.Fatalf("expected the hashtag offsets to point at #Tag, got %v", e.Hashtags)
+	}
+	if len(e.Mentions) != 1 || body[e.Mentions[0].Start:e.Mentions[0].End] != "@ann" {
+		t.Fatalf("expected the mention offsets to point at the mention, got %v", e.Mentions)
+	}
+}
+
+func TestValidTag(t *testing.T) {
+	for tag, want := range map[string]bool{
+		"go":      true,
+		"#Go":     true,
+		"東京":      true,
+		"":        false,
+		"#":       false,
+		"123":     false,
+		"go lang": false,
+		"go-lang": false,
+	} {
+		if got := ValidTag(tag); got != want {
+			t.Errorf("ValidTag(%q) = %v, want %v", tag, got, want)
+		}
+	}
+}
+
+func TestValidHandle(t *testing.T) {
+	for handle, want := range map[string]bool{
+		"ann":                             true,
+		"Ann_B2":                          true,
+		"abcdefghijklmnopqrstuvwxyz0123":  true,
+		"":                                false,
+		"@ann":                            false,
+		"ann b":                           false,
+		"zoë":                             false,
+		"ann@example.com":                 false,
+		"abcdefghijklmnopqrstuvwxyz01234": false,
+	} {
+		if got := ValidHandle(handle); got != want {
+			t.Errorf("ValidHandle(%q) = %v, want %v", handle, got, want)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Attempts is the failure count of a key, such as an account or an IP.
+// PreviousFailure is when the failure before the last one happened, zero
+// when the last one is the first in the window.
+type Attempts struct {
+	Failures        int
+	LastFailure     time.Time
+	PreviousFailure time.Time
+}
+
+// Store keeps failure counters. Failures older than the window passed to
+// RecordFailure no longer count. RecordFailure must be atomic, as it is
+// what concurrent attempts are decided on. Withdraw takes back a failure
+// that was refused, moving the last failure back to previous.
+type Store interface {
+	RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (Attempts, error)
+	Withdraw(ctx context.Context, key string, previous time.Time) error
+	Release(ctx context.Context, key string) error
+	Reset(ctx context.Context, key string) error
+}
+
+// Policy decides how long a key has to wait after a number of failures:
+// nothing for the first FreeAttempts, then an exponential backoff from
+// BaseDelay up to MaxDelay, and a LockoutDuration lockout from LockoutAfter
+// failures on.
+type Policy struct {
+	FreeAttempts    int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutAfter    int
+	LockoutDuration time.Duration
+	Window          time.Duration
+}
+
+func (p Policy) delay(failures int) time.Duration {
+	if failures < p.FreeAttempts {
+		return 0
+	}
+	if p.LockoutAfter > 0 && failures >= p.LockoutAfter {
+		return p.LockoutDuration
+	}
+
+	d := p.BaseDelay
+	for i := p.FreeAttempts; i < failures && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+
+	return d
+}
+
+type Limiter struct {
+	Store Store
+	Now   func() time.Time
+}
+
+func NewLimiter(store Store) *Limiter {
+	return &Limiter{Store: store, Now: time.Now}
+}
+
+// Reserve counts an attempt of key as failed before it is made, so that
+// concurrent attempts can't all pass a check made before any of them
+// failed. It returns how long key must wait when the attempt isn't allowed,
+// zero when it may go on. Attempts made while waiting are taken back right
+// away, so they can't keep a key locked out forever. An attempt that
+// succeeds is taken back with Release or Reset.
+func (l *Limiter) Reserve(ctx context.Context, key string, policy Policy) (time.Duration, error) {
+	now := l.Now()
+	attempts, err := l.Store.RecordFailure(ctx, key, now, policy.Window)
+	if err != nil {
+		return 0, err
+	}
+
+	if attempts.PreviousFailure.IsZero() {
+		return 0, nil
+	}
+
+	wait := attempts.PreviousFailure.Add(policy.delay(attempts.Failures - 1)).Sub(now)
+	if wait <= 0 {
+		return 0, nil
+	}
+
+	if err := l.Store.Withdraw(ctx, key, attempts.PreviousFailure); err != nil {
+		return 0, err
+	}
+
+	return wait, nil
+}
+
+// Release takes back an attempt of key reserved with Reserve.
+func (l *Limiter) Release(ctx context.Context, key string) error {
+	return l.Store.Release(ctx, key)
+}
+
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	return l.Store.Reset(ctx, key)
+}
+
+// maxMemoryKeys bounds the memory store, past it expired keys are dropped
+// on the next failure.
+const maxMemoryKeys = 10000
+
+// MemoryStore keeps counters in process. It is only correct when a single
+// server instance handles logins.
+type MemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string]Attempts
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{attempts: map[string]Attempts{}}
+}
+
+func (s *MemoryStore) RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.attempts) >= maxMemoryKeys {
+		for k, a := range s.attempts {
+			if now.Sub(a.LastFailure) > window {
+				delete(s.attempts, k)
+			}
+		}
+	}
+
+	attempts := s.attempts[key]
+	if attempts.Failures == 0 || now.Sub(attempts.LastFailure) > window {
+		attempts = Attempts{}
+	}
+	attempts.Failures++
+	attempts.PreviousFailure = attempts.LastFailure
+	attempts.LastFailure = now
+	s.attempts[key] = attempts
+
+	return attempts, nil
+}
+
+func (s *MemoryStore) Withdraw(ctx context.Context, key string, previous time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if attempts, ok := s.attempts[key]; ok && attempts.Failures > 0 {
+		attempts.Failures--
+		if previous.Before(attempts.LastFailure) {
+			attempts.LastFailure = previous
+		}
+		s.attempts[key] = attempts
+	}
+	return nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if attempts, ok := s.attempts[key]; ok && attempts.Failures > 0 {
+		attempts.Failures--
+		s.attempts[key] = attempts
+	}
+	return nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
@@ -0,0 +1,186 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	FreeAttempts:    3,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	LockoutAfter:    10,
+	LockoutDuration: time.Hour,
+	Window:          2 * time.Hour,
+}
+
+func newTestLimiter() (*Limiter, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewLimiter(NewMemoryStore())
+	l.Now = func() time.Time { return now }
+	return l, &now
+}
+
+// failN makes n failed attempts on key, waiting out the backoff before each
+// one that isn't allowed yet.
+func failN(t *testing.T, l *Limiter, now *time.Time, key string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		d := reserve(t, l, key)
+		if d == 0 {
+			continue
+		}
+		*now = now.Add(d)
+		if d := reserve(t, l, key); d != 0 {
+			t.Fatalf("expected the attempt to be allowed after waiting, got %s", d)
+		}
+	}
+}
+
+func reserve(t *testing.T, l *Limiter, key string) time.Duration {
+	t.Helper()
+	d, err := l.Reserve(context.Background(), key, testPolicy)
+	if err != nil {
+		t.Fatalf("error reserving attempt: %q", err)
+	}
+	return d
+}
+
+func TestPolicyDelay(t *testing.T) {
+	want := map[int]time.Duration{
+		0:  0,
+		2:  0,
+		3:  time.Second,
+		4:  2 * time.Second,
+		5:  4 * time.Second,
+		9:  time.Minute,
+		10: time.Hour,
+	}
+
+	for failures, d := range want {
+		if got := testPolicy.delay(failures); got != d {
+			t.Fatalf("%d failures: expected %s, got %s", failures, d, got)
+		}
+	}
+}
+
+func TestLimiterBackoff(t *testing.T) {
+	l, now := newTestLimiter()
+
+	failN(t, l, now, "account:a", 3)
+	if d := reserve(t, l, "account:a"); d != time.Second {
+		t.Fatalf("expected 1s delay after free attempts, got %s", d)
+	}
+
+	*now = now.Add(time.Second)
+	if d := reserve(t, l, "account:a"); d != 0 {
+		t.Fatalf("expected delay to be over, got %s", d)
+	}
+	if d := reserve(t, l, "account:a"); d != 2*time.Second {
+		t.Fatalf("expected 2s delay, got %s", d)
+	}
+
+	if d := reserve(t, l, "account:b"); d != 0 {
+		t.Fatalf("other keys should not be affected, got %s", d)
+	}
+}
+
+func TestLimiterLockoutAndReset(t *testing.T) {
+	l, now := newTestLimiter()
+
+	failN(t, l, now, "ip:1.2.3.4", 10)
+	if d := reserve(t, l, "ip:1.2.3.4"); d != time.Hour {
+		t.Fatalf("expected lockout, got %s", d)
+	}
+
+	if err := l.Reset(context.Background(), "ip:1.2.3.4"); err != nil {
+		t.Fatalf("error resetting key: %q", err)
+	}
+	if d := reserve(t, l, "ip:1.2.3.4"); d != 0 {
+		t.Fatalf("expected no delay after reset, got %s", d)
+	}
+
+	failN(t, l, now, "ip:1.2.3.4", 9)
+	*now = now.Add(3 * time.Hour)
+	if d := reserve(t, l, "ip:1.2.3.4"); d != 0 {
+		t.Fatalf("failures outside the window should not count, got %s", d)
+	}
+}
+
+// Attempts refused during a lockout must not push its end further, or
+// anyone knowing the key could keep it locked out for good.
+func TestLimiterWaitingDoesNotExtendLockout(t *testing.T) {
+	l, now := newTestLimiter()
+
+	failN(t, l, now, "account:a", 10)
+	for waited := time.Duration(0); waited < time.Hour; waited += 10 * time.Minute {
+		if d := reserve(t, l, "account:a"); d != time.Hour-waited {
+			t.Fatalf("expected %s left after waiting %s, got %s", time.Hour-waited, waited, d)
+		}
+		*now = now.Add(10 * time.Minute)
+	}
+
+	if d := reserve(t, l, "account:a"); d != 0 {
+		t.Fatalf("expected the lockout to be over, got %s", d)
+	}
+}
+
+func TestLimiterReserveConcurrent(t *testing.T) {
+	l, _ := newTestLimiter()
+
+	var wg sync.WaitGroup
+	var allowed atomic.Int32
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d, err := l.Reserve(context.Background(), "account:a", testPolicy)
+			if err != nil {
+				t.Errorf("error reserving attempt: %q", err)
+			}
+			if d == 0 {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := allowed.Load(); n != int32(testPolicy.FreeAttempts) {
+		t.Fatalf("expected %d attempts allowed, got %d", testPolicy.FreeAttempts, n)
+	}
+}
+
+func TestLimiterReserveRelease(t *testing.T) {
+	l, now := newTestLimiter()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if d, _ := l.Reserve(ctx, "ip:1.2.3.4", testPolicy); d != 0 {
+			t.Fatalf("expected attempt %d to be allowed, got %s", i+1, d)
+		}
+		if err := l.Release(ctx, "ip:1.2.3.4"); err != nil {
+			t.Fatalf("error releasing attempt: %q", err)
+		}
+	}
+	if d := reserve(t, l, "ip:1.2.3.4"); d != 0 {
+		t.Fatalf("released attempts should not count, got %s", d)
+	}
+
+	failN(t, l, now, "ip:1.2.3.4", 2)
+	if d := reserve(t, l, "ip:1.2.3.4"); d != time.Second {
+		t.Fatalf("expected 1s wait, got %s", d)
+	}
+
+	// refused attempts are taken back, so the wait doesn't move
+	*now = now.Add(500 * time.Millisecond)
+	if d := reserve(t, l, "ip:1.2.3.4"); d != 500*time.Millisecond {
+		t.Fatalf("expected 500ms wait, got %s", d)
+	}
+	*now = now.Add(500 * time.Millisecond)
+	if d := reserve(t, l, "ip:1.2.3.4"); d != 0 {
+		t.Fatalf("expected the attempt to be allowed, got %s", d)
+	}
+}
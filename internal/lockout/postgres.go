@@ -0,0 +1,54 @@
+package lockout
+
+import (
+	"context"
+	"time"
+
+	"github.com/LahcenHaouch/goserver/internal/database"
+)
+
+// PostgresStore shares counters between server instances through the
+// login_attempts table.
+type PostgresStore struct {
+	q *database.Queries
+}
+
+func NewPostgresStore(q *database.Queries) *PostgresStore {
+	return &PostgresStore{q: q}
+}
+
+func (s *PostgresStore) RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (Attempts, error) {
+	row, err := s.q.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+		Key:           key,
+		LastFailureAt: now,
+		WindowStart:   now.Add(-window),
+	})
+	if err != nil {
+		return Attempts{}, err
+	}
+
+	return parseAttempts(row), nil
+}
+
+func (s *PostgresStore) Withdraw(ctx context.Context, key string, previous time.Time) error {
+	return s.q.WithdrawLoginAttempt(ctx, database.WithdrawLoginAttemptParams{
+		PreviousFailureAt: previous,
+		Key:               key,
+	})
+}
+
+func (s *PostgresStore) Release(ctx context.Context, key string) error {
+	return s.q.ReleaseLoginAttempt(ctx, key)
+}
+
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+	return s.q.ResetLoginAttempts(ctx, key)
+}
+
+func parseAttempts(row database.LoginAttempt) Attempts {
+	attempts := Attempts{Failures: int(row.Failures), LastFailure: row.LastFailureAt}
+	if row.PreviousFailureAt.Valid {
+		attempts.PreviousFailure = row.PreviousFailureAt.Time
+	}
+	return attempts
+}
@@ -0,0 +1,118 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers transactional emails such as password reset links.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+func (m Message) bytes(from string) ([]byte, error) {
+	for _, v := range []string{from, m.To, m.Subject} {
+		if strings.ContainsAny(v, "\r\n") {
+			return nil, errors.New("mail headers must not contain line breaks")
+		}
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", m.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+
+	return b.Bytes(), nil
+}
+
+type SMTPMailer struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+}
+
+func NewSMTPMailer(host, port, username, password, from string) *SMTPMailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTPMailer{Addr: host + ":" + port, From: from, Auth: auth}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	b, err := msg.bytes(m.From)
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(m.Addr, m.Auth, m.From, []string{msg.To}, b)
+}
+
+// FileMailer appends every message to a file instead of delivering it, for
+// local development and tests.
+type FileMailer struct {
+	mu   sync.Mutex
+	Path string
+	From string
+}
+
+func NewFileMailer(path, from string) *FileMailer {
+	return &FileMailer{Path: path, From: from}
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	b, err := msg.bytes(m.From)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(b, "\r\n"...)); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// LogMailer prints every message to the server log.
+type LogMailer struct {
+	From string
+}
+
+func (m LogMailer) Send(ctx context.Context, msg Message) error {
+	b, err := msg.bytes(m.From)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("mail:\n%s", b)
+	return nil
+}
@@ -0,0 +1,41 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailerAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.txt")
+	m := NewFileMailer(path, "chirpy@example.com")
+
+	for _, subject := range []string{"first", "second"} {
+		if err := m.Send(context.Background(), Message{To: "user@example.com", Subject: subject, Body: "hello"}); err != nil {
+			t.Fatalf("error sending mail: %q", err)
+		}
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("error reading mail file: %q", err)
+	}
+
+	out := string(b)
+	for _, want := range []string{"To: user@example.com", "Subject: first", "Subject: second", "hello"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("mail file missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestMessageRejectsHeaderInjection(t *testing.T) {
+	m := NewFileMailer(filepath.Join(t.TempDir(), "mail.txt"), "chirpy@example.com")
+
+	err := m.Send(context.Background(), Message{To: "user@example.com\r\nBcc: evil@example.com", Subject: "hi"})
+	if err == nil {
+		t.Fatalf("expected error for header with line break")
+	}
+}
@@ -0,0 +1,93 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const exifOrientationTag = 0x0112
+
+// jpegOrientation reads the EXIF orientation of a JPEG, 1 when it has none
+// or it can't be read.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF: // fill byte
+			i++
+			continue
+		case marker == 0xDA || marker == 0xD9: // image data, end of image
+			return 1
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7): // no length
+			i += 2
+			continue
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+
+		i += 2 + length
+	}
+
+	return 1
+}
+
+// tiffOrientation reads the orientation tag of the first IFD of the TIFF
+// structure EXIF data is stored in.
+func tiffOrientation(t []byte) int {
+	if len(t) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(t[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	if order.Uint16(t[2:]) != 42 {
+		return 1
+	}
+
+	offset := uint64(order.Uint32(t[4:]))
+	if offset+2 > uint64(len(t)) {
+		return 1
+	}
+	ifd := int(offset)
+
+	entries := int(order.Uint16(t[ifd:]))
+	for k := 0; k < entries; k++ {
+		e := ifd + 2 + 12*k
+		if e+12 > len(t) {
+			return 1
+		}
+
+		// a SHORT value sits in the first bytes of the value field
+		if order.Uint16(t[e:]) == exifOrientationTag && order.Uint16(t[e+2:]) == 3 {
+			if o := int(order.Uint16(t[e+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 1
+		}
+	}
+
+	return 1
+}
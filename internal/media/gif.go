@@ -0,0 +1,61 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var errMalformedGIF = errors.New("malformed gif")
+
+// gifPixels walks the blocks of a GIF without decoding them and returns
+// how many frames it has and how many pixels they add up to, which is what
+// decoding every frame allocates.
+func gifPixels(data []byte) (frames, pixels int, err error) {
+	// header and logical screen descriptor
+	if len(data) < 13 {
+		return 0, 0, errMalformedGIF
+	}
+	i := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		i += 3 << (flags&0x07 + 1)
+	}
+
+	for i < len(data) {
+		switch data[i] {
+		case 0x21: // extension: label, then sub-blocks
+			if i += 2; i > len(data) {
+				return 0, 0, errMalformedGIF
+			}
+		case 0x2C: // image descriptor, then LZW code size and sub-blocks
+			if i+10 > len(data) {
+				return 0, 0, errMalformedGIF
+			}
+			frames++
+			pixels += int(binary.LittleEndian.Uint16(data[i+5:])) * int(binary.LittleEndian.Uint16(data[i+7:]))
+			flags := data[i+9]
+			i += 10
+			if flags&0x80 != 0 {
+				i += 3 << (flags&0x07 + 1)
+			}
+			i++
+		case 0x3B: // trailer
+			return frames, pixels, nil
+		default:
+			return 0, 0, errMalformedGIF
+		}
+
+		for {
+			if i >= len(data) {
+				return 0, 0, errMalformedGIF
+			}
+			size := int(data[i])
+			i += size + 1
+			if size == 0 {
+				break
+			}
+		}
+	}
+
+	// a missing trailer is left to the decoder
+	return frames, pixels, nil
+}
@@ -0,0 +1,254 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const (
+	// maxPixels keeps a small file from decoding into gigabytes of pixels.
+	// It bounds the frames of a GIF taken together.
+	maxPixels     = 40_000_000
+	maxGIFFrames  = 500
+	ThumbnailSize = 320
+	jpegQuality   = 90
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported media type")
+	ErrTooManyPixels   = errors.New("image dimensions too large")
+)
+
+// Image is an upload made safe to serve: decoded and encoded again, which
+// leaves out EXIF and every other kind of metadata, GPS positions included.
+type Image struct {
+	ContentType string
+	Data        []byte
+	Width       int
+	Height      int
+	// Thumbnail fits in ThumbnailSize by ThumbnailSize, and is the image
+	// itself when it already does. It is a still of animated GIFs.
+	Thumbnail            []byte
+	ThumbnailContentType string
+}
+
+// Sniff returns the content type of data from its first bytes, whatever
+// the client said it was. Only JPEG, PNG and GIF are accepted.
+func Sniff(data []byte) (string, error) {
+	switch ct := http.DetectContentType(data); ct {
+	case "image/jpeg", "image/png", "image/gif":
+		return ct, nil
+	default:
+		return "", ErrUnsupportedType
+	}
+}
+
+// Ext is the file extension of the content types Sniff accepts.
+func Ext(contentType string) string {
+	switch contentType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	default:
+		return ""
+	}
+}
+
+// Process checks that data is an image we accept, strips its metadata and
+// makes its thumbnail. JPEGs are turned the way their EXIF orientation
+// says, since it goes with the rest of the metadata.
+func Process(data []byte) (*Image, error) {
+	contentType, err := Sniff(data)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, ErrTooManyPixels
+	}
+
+	var img image.Image
+	var out, thumb bytes.Buffer
+	result := &Image{ContentType: contentType}
+
+	switch contentType {
+	case "image/jpeg":
+		img, err = jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		img = orient(img, jpegOrientation(data))
+		if err := jpeg.Encode(&out, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, err
+		}
+		if err := jpeg.Encode(&thumb, thumbnail(img), &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, err
+		}
+		result.ThumbnailContentType = "image/jpeg"
+
+	case "image/png":
+		img, err = png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if err := png.Encode(&out, img); err != nil {
+			return nil, err
+		}
+		if err := png.Encode(&thumb, thumbnail(img)); err != nil {
+			return nil, err
+		}
+		result.ThumbnailContentType = "image/png"
+
+	case "image/gif":
+		// the canvas is small enough, but every frame gets decoded
+		frames, pixels, err := gifPixels(data)
+		if err != nil {
+			return nil, err
+		}
+		if frames > maxGIFFrames || pixels > maxPixels {
+			return nil, ErrTooManyPixels
+		}
+
+		// frames are kept as they are; comments and application
+		// extensions other than the loop count are dropped
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if len(g.Image) == 0 {
+			return nil, errors.New("gif has no frames")
+		}
+		if err := gif.EncodeAll(&out, g); err != nil {
+			return nil, err
+		}
+
+		// the first frame may only cover part of the canvas
+		canvas := image.NewRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+		draw.Draw(canvas, g.Image[0].Bounds(), g.Image[0], g.Image[0].Bounds().Min, draw.Over)
+		img = canvas
+		if err := png.Encode(&thumb, thumbnail(img)); err != nil {
+			return nil, err
+		}
+		result.ThumbnailContentType = "image/png"
+	}
+
+	result.Data = out.Bytes()
+	result.Width = img.Bounds().Dx()
+	result.Height = img.Bounds().Dy()
+	result.Thumbnail = thumb.Bytes()
+	return result, nil
+}
+
+// toRGBA returns img as an RGBA image with its origin at 0, 0.
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	if rgba, ok := img.(*image.RGBA); ok && b.Min == (image.Point{}) {
+		return rgba
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
+
+// orient turns img from EXIF orientation o, 1 to 8, to upright.
+func orient(img image.Image, o int) image.Image {
+	if o < 2 || o > 8 {
+		return img
+	}
+
+	src := toRGBA(img)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for sy := 0; sy < h; sy++ {
+		for sx := 0; sx < w; sx++ {
+			var dx, dy int
+			switch o {
+			case 2: // flip horizontally
+				dx, dy = w-1-sx, sy
+			case 3: // rotate 180
+				dx, dy = w-1-sx, h-1-sy
+			case 4: // flip vertically
+				dx, dy = sx, h-1-sy
+			case 5: // transpose
+				dx, dy = sy, sx
+			case 6: // rotate clockwise
+				dx, dy = h-1-sy, sx
+			case 7: // transverse
+				dx, dy = h-1-sy, w-1-sx
+			case 8: // rotate counterclockwise
+				dx, dy = sy, w-1-sx
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):][:4], src.Pix[src.PixOffset(sx, sy):][:4])
+		}
+	}
+
+	return dst
+}
+
+// thumbnail scales img down to fit in ThumbnailSize by ThumbnailSize.
+func thumbnail(img image.Image) image.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if w <= ThumbnailSize && h <= ThumbnailSize {
+		return img
+	}
+
+	tw, th := ThumbnailSize, ThumbnailSize
+	if w > h {
+		th = max(1, h*ThumbnailSize/w)
+	} else {
+		tw = max(1, w*ThumbnailSize/h)
+	}
+	return resize(toRGBA(img), tw, th)
+}
+
+// resize scales src down to w by h, each pixel the average of the ones it
+// covers.
+func resize(src *image.RGBA, w, h int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, max((y+1)*sh/h, y*sh/h+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, max((x+1)*sw/w, x*sw/w+1)
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[src.PixOffset(x0, sy):src.PixOffset(x1, sy)]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+
+			n := (x1 - x0) * (y1 - y0)
+			px := dst.Pix[dst.PixOffset(x, y):][:4]
+			for i := range px {
+				px[i] = uint8(sum[i] / n)
+			}
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,207 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// exifSegment is an APP1 segment with an orientation tag and a string
+// standing in for the GPS position a phone would record.
+func exifSegment(orientation uint16) []byte {
+	var tiff bytes.Buffer
+	tiff.WriteString("II")
+	binary.Write(&tiff, binary.LittleEndian, uint16(42))
+	binary.Write(&tiff, binary.LittleEndian, uint32(8))
+	binary.Write(&tiff, binary.LittleEndian, uint16(1))
+	binary.Write(&tiff, binary.LittleEndian, []uint16{exifOrientationTag, 3})
+	binary.Write(&tiff, binary.LittleEndian, uint32(1))
+	binary.Write(&tiff, binary.LittleEndian, []uint16{orientation, 0})
+	binary.Write(&tiff, binary.LittleEndian, uint32(0))
+	tiff.WriteString("GPS 48.8584N 2.2945E")
+
+	payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// halves is a w by h image, red on the left and blue on the right.
+func halves(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= w/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestProcessStripsExifAndOrients(t *testing.T) {
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, halves(32, 16), nil); err != nil {
+		t.Fatalf("error encoding jpeg: %q", err)
+	}
+	data := append(append([]byte{0xFF, 0xD8}, exifSegment(6)...), b.Bytes()[2:]...)
+
+	if o := jpegOrientation(data); o != 6 {
+		t.Fatalf("expected orientation 6, got %d", o)
+	}
+
+	img, err := Process(data)
+	if err != nil {
+		t.Fatalf("error processing image: %q", err)
+	}
+
+	if img.ContentType != "image/jpeg" {
+		t.Fatalf("expected image/jpeg, got %s", img.ContentType)
+	}
+	if bytes.Contains(img.Data, []byte("Exif")) || bytes.Contains(img.Data, []byte("GPS")) {
+		t.Fatalf("metadata left in processed image")
+	}
+
+	// turned clockwise, the red half ends up on top
+	if img.Width != 16 || img.Height != 32 {
+		t.Fatalf("expected 16x32, got %dx%d", img.Width, img.Height)
+	}
+	decoded, err := jpeg.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		t.Fatalf("error decoding processed image: %q", err)
+	}
+	r, _, bl, _ := decoded.At(8, 4).RGBA()
+	if r <= bl {
+		t.Fatalf("expected red at the top, got %v", decoded.At(8, 4))
+	}
+	r, _, bl, _ = decoded.At(8, 28).RGBA()
+	if bl <= r {
+		t.Fatalf("expected blue at the bottom, got %v", decoded.At(8, 28))
+	}
+}
+
+func TestProcessThumbnail(t *testing.T) {
+	var b bytes.Buffer
+	if err := png.Encode(&b, halves(1000, 500)); err != nil {
+		t.Fatalf("error encoding png: %q", err)
+	}
+
+	img, err := Process(b.Bytes())
+	if err != nil {
+		t.Fatalf("error processing image: %q", err)
+	}
+
+	cfg, err := png.DecodeConfig(bytes.NewReader(img.Thumbnail))
+	if err != nil {
+		t.Fatalf("error decoding thumbnail: %q", err)
+	}
+	if cfg.Width != ThumbnailSize || cfg.Height != ThumbnailSize/2 {
+		t.Fatalf("expected %dx%d thumbnail, got %dx%d", ThumbnailSize, ThumbnailSize/2, cfg.Width, cfg.Height)
+	}
+	if img.Width != 1000 || img.Height != 500 {
+		t.Fatalf("expected 1000x500, got %dx%d", img.Width, img.Height)
+	}
+}
+
+func TestProcessKeepsGIFFrames(t *testing.T) {
+	g := &gif.GIF{}
+	for i := 0; i < 3; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 8, 8), palette.Plan9)
+		frame.SetColorIndex(i, i, 1)
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, 10)
+	}
+
+	var b bytes.Buffer
+	if err := gif.EncodeAll(&b, g); err != nil {
+		t.Fatalf("error encoding gif: %q", err)
+	}
+
+	img, err := Process(b.Bytes())
+	if err != nil {
+		t.Fatalf("error processing image: %q", err)
+	}
+
+	out, err := gif.DecodeAll(bytes.NewReader(img.Data))
+	if err != nil {
+		t.Fatalf("error decoding processed gif: %q", err)
+	}
+	if len(out.Image) != 3 {
+		t.Fatalf("expected 3 frames, got %d", len(out.Image))
+	}
+	if img.ThumbnailContentType != "image/png" {
+		t.Fatalf("expected png thumbnail, got %s", img.ThumbnailContentType)
+	}
+}
+
+func encodeGIF(t *testing.T, frames int, bounds image.Rectangle) []byte {
+	t.Helper()
+
+	g := &gif.GIF{Config: image.Config{Width: bounds.Dx(), Height: bounds.Dy()}}
+	for i := 0; i < frames; i++ {
+		g.Image = append(g.Image, image.NewPaletted(bounds, palette.Plan9))
+		g.Delay = append(g.Delay, 10)
+	}
+
+	var b bytes.Buffer
+	if err := gif.EncodeAll(&b, g); err != nil {
+		t.Fatalf("error encoding gif: %q", err)
+	}
+	return b.Bytes()
+}
+
+func TestGIFPixels(t *testing.T) {
+	frames, pixels, err := gifPixels(encodeGIF(t, 3, image.Rect(0, 0, 20, 10)))
+	if err != nil {
+		t.Fatalf("error reading gif: %q", err)
+	}
+	if frames != 3 || pixels != 600 {
+		t.Fatalf("expected 3 frames of 600 pixels, got %d frames of %d", frames, pixels)
+	}
+
+	if _, _, err := gifPixels([]byte("GIF89a\x01\x00\x01\x00\x00\x00\x00\x2C\x00")); err == nil {
+		t.Fatalf("expected error for a truncated gif")
+	}
+}
+
+func TestProcessRejectsTooManyGIFFrames(t *testing.T) {
+	if _, err := Process(encodeGIF(t, maxGIFFrames+1, image.Rect(0, 0, 2, 2))); !errors.Is(err, ErrTooManyPixels) {
+		t.Fatalf("expected ErrTooManyPixels, got %v", err)
+	}
+}
+
+func TestProcessRejectsOtherTypes(t *testing.T) {
+	for _, data := range [][]byte{
+		[]byte("<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"),
+		[]byte("%PDF-1.4"),
+		[]byte("RIFF\x00\x00\x00\x00WEBPVP8 "),
+	} {
+		if _, err := Process(data); !errors.Is(err, ErrUnsupportedType) {
+			t.Fatalf("expected ErrUnsupportedType for %q, got %v", data, err)
+		}
+	}
+}
+
+func TestJPEGOrientationMalformed(t *testing.T) {
+	segment := exifSegment(6)
+	for _, data := range [][]byte{
+		nil,
+		{0xFF, 0xD8},
+		append([]byte{0xFF, 0xD8}, segment[:10]...),
+		append([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0xFF, 0xFF}, segment[4:]...),
+		append([]byte{0xFF, 0xD8}, exifSegment(9)...),
+	} {
+		if o := jpegOrientation(data); o != 1 {
+			t.Fatalf("expected orientation 1 for %x, got %d", data, o)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestLocalStoreRoundTrip(t *testing.T) {
+	store := NewLocalStore(t.TempDir())
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "media/a.png", []byte("image"), "image/png"); err != nil {
+		t.Fatalf("error putting blob: %q", err)
+	}
+
+	rc, err := store.Get(ctx, "media/a.png")
+	if err != nil {
+		t.Fatalf("error getting blob: %q", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "image" {
+		t.Fatalf("expected %q, got %q", "image", data)
+	}
+
+	if err := store.Delete(ctx, "media/a.png"); err != nil {
+		t.Fatalf("error deleting blob: %q", err)
+	}
+	if err := store.Delete(ctx, "media/a.png"); err != nil {
+		t.Fatalf("error deleting missing blob: %q", err)
+	}
+	if _, err := store.Get(ctx, "media/a.png"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestLocalStoreRejectsEscapingKeys(t *testing.T) {
+	store := NewLocalStore(t.TempDir())
+
+	for _, key := range []string{"", "../a.png", "media/../../a.png", "/etc/passwd", `media\a.png`, "media//a.png"} {
+		if err := store.Put(context.Background(), key, []byte("image"), "image/png"); err == nil {
+			t.Fatalf("expected error for key %q", key)
+		}
+	}
+}
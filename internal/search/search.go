@@ -0,0 +1,68 @@
+// Package search turns what users type in a search box into Postgres
+// full-text queries and search snippets into safe HTML.
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// The markers ts_headline puts around matches. html.EscapeString leaves
+// control characters alone, so Highlight still finds them after escaping.
+const (
+	startSel = "\x02"
+	stopSel  = "\x03"
+)
+
+// HeadlineOptions are the ts_headline options Highlight expects.
+const HeadlineOptions = "StartSel=" + startSel + ", StopSel=" + stopSel + ", MaxFragments=2, MaxWords=20, MinWords=5"
+
+// ParseQuery converts q into a to_tsquery expression matching chirps with
+// every term of q. "Quoted words" must appear next to each other and a
+// trailing * makes the last word a prefix. Only letters and digits are kept,
+// so q can't inject tsquery operators. It returns "" when q has no words.
+func ParseQuery(q string) string {
+	var terms []string
+	for i, part := range strings.Split(q, `"`) {
+		// odd parts are between quotes
+		if i%2 == 1 {
+			if term := parseTerm(part); term != "" {
+				terms = append(terms, term)
+			}
+			continue
+		}
+
+		for _, field := range strings.Fields(part) {
+			if term := parseTerm(field); term != "" {
+				terms = append(terms, term)
+			}
+		}
+	}
+
+	return strings.Join(terms, " & ")
+}
+
+// parseTerm turns a word or a quoted phrase into a phrase query. Words
+// glued by punctuation, like "don't", become a phrase too.
+func parseTerm(s string) string {
+	prefix := strings.HasSuffix(strings.TrimSpace(s), "*")
+
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return ""
+	}
+
+	if prefix {
+		words[len(words)-1] += ":*"
+	}
+	return strings.Join(words, " <-> ")
+}
+
+// Highlight escapes a ts_headline made with HeadlineOptions and wraps its
+// matches in <mark> elements.
+func Highlight(headline string) string {
+	return strings.NewReplacer(startSel, "<mark>", stopSel, "</mark>").Replace(html.EscapeString(headline))
+}
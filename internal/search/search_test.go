@@ -0,0 +1,41 @@
+package search
+
+import "testing"
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		q    string
+		want string
+	}{
+		{"", ""},
+		{"   ", ""},
+		{"hello", "hello"},
+		{"hello world", "hello & world"},
+		{`"hello world"`, "hello <-> world"},
+		{`go "hello world" chirpy`, "go & hello <-> world & chirpy"},
+		{"chirp*", "chirp:*"},
+		{`"hello wor*"`, "hello <-> wor:*"},
+		{"don't", "don <-> t"},
+		{"café 2024", "café & 2024"},
+		// an unbalanced quote runs to the end of q
+		{`hello "big world`, "hello & big <-> world"},
+		// tsquery operators are dropped
+		{"a & !b | (c:*)", "a & b & c"},
+		{"* & !", ""},
+	}
+
+	for _, tt := range tests {
+		if got := ParseQuery(tt.q); got != tt.want {
+			t.Errorf("ParseQuery(%q) = %q, want %q", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	headline := "say " + startSel + "hello" + stopSel + " to <script>"
+	want := "say <mark>hello</mark> to &lt;script&gt;"
+
+	if got := Highlight(headline); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
@@ -1,13 +1,22 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/LahcenHaouch/goserver/api"
+	"github.com/LahcenHaouch/goserver/internal/auth"
 	"github.com/LahcenHaouch/goserver/internal/database"
+	"github.com/LahcenHaouch/goserver/internal/lockout"
+	"github.com/LahcenHaouch/goserver/internal/mail"
+	"github.com/LahcenHaouch/goserver/internal/media"
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 
 	_ "github.com/lib/pq"
@@ -21,6 +30,138 @@ func main() {
 	dbURL := os.Getenv("DB_URL")
 	tokenSecret := os.Getenv("TOKEN_SECRET")
 	polkaKey := os.Getenv("POLKA_KEY")
+	keyAlgorithm := os.Getenv("JWT_ALGORITHM")
+	if keyAlgorithm == "" {
+		keyAlgorithm = auth.AlgRS256
+	}
+	keyRotation := 30 * 24 * time.Hour
+	if v := os.Getenv("JWT_KEY_ROTATION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Printf("error parsing JWT_KEY_ROTATION: %q", err)
+			return
+		}
+		keyRotation = d
+	}
+	// HS256 tokens signed with TOKEN_SECRET are accepted until they have all
+	// expired, or until JWT_HS256_UNTIL if set
+	hs256Until := time.Now().Add(time.Hour)
+	if v := os.Getenv("JWT_HS256_UNTIL"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			log.Printf("error parsing JWT_HS256_UNTIL: %q", err)
+			return
+		}
+		hs256Until = t
+	}
+	passwords := *auth.DefaultPasswordHasher
+	if v := os.Getenv("PASSWORD_HASH"); v != "" {
+		passwords.Algorithm = v
+	}
+	for env, param := range map[string]*uint32{
+		"ARGON2_MEMORY": &passwords.Argon2.Memory,
+		"ARGON2_TIME":   &passwords.Argon2.Time,
+	} {
+		if v := os.Getenv(env); v != "" {
+			n, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				log.Printf("error parsing %s: %q", env, err)
+				return
+			}
+			*param = uint32(n)
+		}
+	}
+	if v := os.Getenv("ARGON2_PARALLELISM"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 8)
+		if err != nil {
+			log.Printf("error parsing ARGON2_PARALLELISM: %q", err)
+			return
+		}
+		passwords.Argon2.Parallelism = uint8(n)
+	}
+	// argon2 panics on these rather than returning an error
+	if passwords.Argon2.Time < 1 || passwords.Argon2.Parallelism < 1 {
+		log.Printf("ARGON2_TIME and ARGON2_PARALLELISM must be at least 1")
+		return
+	}
+	if passwords.Argon2.Memory < 8*uint32(passwords.Argon2.Parallelism) {
+		log.Printf("ARGON2_MEMORY must be at least 8 KiB per thread of ARGON2_PARALLELISM")
+		return
+	}
+	if v := os.Getenv("BCRYPT_COST"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			log.Printf("error parsing BCRYPT_COST: %q", err)
+			return
+		}
+		passwords.BcryptCost = n
+	}
+
+	passwordPolicy := *auth.DefaultPasswordPolicy
+	for env, param := range map[string]*int{
+		"PASSWORD_MIN_LENGTH": &passwordPolicy.MinLength,
+		"PASSWORD_MAX_BYTES":  &passwordPolicy.MaxBytes,
+	} {
+		if v := os.Getenv(env); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				log.Printf("error parsing %s: %q", env, err)
+				return
+			}
+			*param = n
+		}
+	}
+	// BREACHED_PASSWORDS_FILE holds one hex SHA-1 hash per line, optionally
+	// followed by ":<count>", which is the format of the Have I Been Pwned
+	// downloads, so those can be used as they are.
+	if path := os.Getenv("BREACHED_PASSWORDS_FILE"); path != "" {
+		breached, err := auth.LoadBreachedPasswords(path)
+		if err != nil {
+			log.Printf("error loading breached passwords: %q", err)
+			return
+		}
+		passwordPolicy.Breached = breached
+	}
+
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	requireVerifiedEmail := os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true"
+	trustProxy := os.Getenv("TRUST_PROXY") == "true"
+	// chirps can be edited for this long after being posted; 0 turns edits off
+	chirpEditWindow := 15 * time.Minute
+	if v := os.Getenv("CHIRP_EDIT_WINDOW"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Printf("error parsing CHIRP_EDIT_WINDOW: %q", err)
+			return
+		}
+		chirpEditWindow = d
+	}
+	// resource servers that may introspect any token, as client ids
+	var introspectionClients []uuid.UUID
+	if v := os.Getenv("INTROSPECTION_CLIENTS"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			id, err := uuid.Parse(strings.TrimSpace(s))
+			if err != nil {
+				log.Printf("error parsing INTROSPECTION_CLIENTS: %q", err)
+				return
+			}
+			introspectionClients = append(introspectionClients, id)
+		}
+	}
+
+	// ADMIN_EMAILS lists the accounts, comma separated, made admins at
+	// startup once their email is verified. It is how the first admin is
+	// created; later ones can be appointed through /admin/users/{userId}/role.
+	var adminEmails []string
+	if v := os.Getenv("ADMIN_EMAILS"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			adminEmails = append(adminEmails, strings.TrimSpace(s))
+		}
+	}
+
 	db, err := sql.Open("postgres", dbURL)
 
 	if err != nil {
@@ -29,7 +170,71 @@ func main() {
 	}
 
 	dbQueries := database.New(db)
-	api := api.ApiConfig{FileServerHits: 0, Database: dbQueries, TokenSecret: tokenSecret, PolkaKey: polkaKey}
+	var mailer mail.Mailer
+	mailFrom := os.Getenv("MAIL_FROM")
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		mailer = mail.NewSMTPMailer(os.Getenv("SMTP_HOST"), os.Getenv("SMTP_PORT"), os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), mailFrom)
+	case "file":
+		mailer = mail.NewFileMailer(os.Getenv("MAIL_FILE"), mailFrom)
+	default:
+		mailer = mail.LogMailer{From: mailFrom}
+	}
+
+	var lockoutStore lockout.Store
+	if os.Getenv("LOCKOUT_STORE") == "memory" {
+		lockoutStore = lockout.NewMemoryStore()
+	} else {
+		lockoutStore = lockout.NewPostgresStore(dbQueries)
+	}
+
+	var blobs media.BlobStore
+	switch os.Getenv("MEDIA_STORE") {
+	case "s3":
+		blobs = media.NewS3Store(os.Getenv("S3_ENDPOINT"), os.Getenv("S3_REGION"), os.Getenv("S3_BUCKET"), os.Getenv("S3_ACCESS_KEY_ID"), os.Getenv("S3_SECRET_ACCESS_KEY"), os.Getenv("S3_PATH_STYLE") == "true")
+	default:
+		mediaDir := os.Getenv("MEDIA_DIR")
+		if mediaDir == "" {
+			mediaDir = "uploads"
+		}
+		blobs = media.NewLocalStore(mediaDir)
+	}
+
+	keys := auth.NewKeyRing()
+	if tokenSecret != "" {
+		keys.AllowLegacyHS256(tokenSecret, hs256Until)
+	}
+	api := api.ApiConfig{
+		FileServerHits:       0,
+		DB:                   db,
+		Database:             dbQueries,
+		Keys:                 keys,
+		KeyAlgorithm:         keyAlgorithm,
+		KeyRotation:          keyRotation,
+		Passwords:            &passwords,
+		PasswordPolicy:       &passwordPolicy,
+		Mailer:               mailer,
+		BaseURL:              baseURL,
+		RequireVerifiedEmail: requireVerifiedEmail,
+		TrustProxy:           trustProxy,
+		LoginLimiter:         lockout.NewLimiter(lockoutStore),
+		PolkaKey:             polkaKey,
+		ChirpEditWindow:      chirpEditWindow,
+		Media:                blobs,
+		IntrospectionClients: introspectionClients,
+	}
+
+	ctx := context.Background()
+	if err := api.RotateSigningKeys(ctx); err != nil {
+		log.Printf("error loading signing keys: %q", err)
+		return
+	}
+	if err := api.PromoteAdmins(ctx, adminEmails); err != nil {
+		log.Printf("error promoting admins: %q", err)
+		return
+	}
+	api.StartKeyRotation(ctx)
+	api.StartScheduler(ctx)
 
 	mux := http.NewServeMux()
 	serv := http.Server{
@@ -39,17 +244,66 @@ func main() {
 
 	mux.Handle("/app/", api.MiddlewareMetricsInc(http.StripPrefix("/app/", http.FileServer(http.Dir(".")))))
 	mux.HandleFunc("GET /api/healthz", api.HealthzHandler)
-	mux.HandleFunc("/admin/reset", api.ResetHandler)
+	mux.HandleFunc("GET /.well-known/jwks.json", api.HandleJWKS)
+	mux.Handle("/admin/reset", api.MiddlewareRequireRole(auth.RoleAdmin, http.HandlerFunc(api.ResetHandler)))
 	mux.HandleFunc("GET /api/chirps", api.HandleGetChirps)
+	mux.HandleFunc("GET /api/chirps/search", api.HandleSearchChirps)
 	mux.HandleFunc("GET /api/chirps/{chirpId}", api.HandleGetChirp)
+	mux.HandleFunc("GET /api/chirps/{chirpId}/thread", api.HandleGetChirpThread)
+	mux.HandleFunc("GET /api/chirps/{chirpId}/revisions", api.HandleListChirpRevisions)
+	mux.HandleFunc("GET /api/chirps/{chirpId}/likes", api.HandleListChirpLikes)
+	mux.HandleFunc("POST /api/chirps/{chirpId}/likes", api.HandleLikeChirp)
+	mux.HandleFunc("DELETE /api/chirps/{chirpId}/likes", api.HandleUnlikeChirp)
+	mux.HandleFunc("POST /api/chirps/{chirpId}/rechirps", api.HandleRechirp)
+	mux.HandleFunc("DELETE /api/chirps/{chirpId}/rechirps", api.HandleUndoRechirp)
+	mux.HandleFunc("GET /api/tags/{tag}/chirps", api.HandleGetTagChirps)
 	mux.HandleFunc("POST /api/chirps", api.HandleCreateChirp)
+	mux.HandleFunc("POST /api/media", api.HandleUploadMedia)
+	mux.HandleFunc("GET /media/{mediaId}", api.HandleGetMedia)
+	mux.HandleFunc("GET /media/{mediaId}/thumbnail", api.HandleGetMediaThumbnail)
+	mux.HandleFunc("POST /api/drafts", api.HandleCreateDraft)
+	mux.HandleFunc("GET /api/drafts", api.HandleListDrafts)
+	mux.HandleFunc("PUT /api/drafts/{draftId}", api.HandleUpdateDraft)
+	mux.HandleFunc("DELETE /api/drafts/{draftId}", api.HandleDeleteDraft)
+	mux.HandleFunc("POST /api/drafts/{draftId}/publish", api.HandlePublishDraft)
 	mux.HandleFunc("POST /api/users", api.HandleCreateUser)
 	mux.HandleFunc("PUT /api/users", api.HandleUpdateUser)
+	mux.HandleFunc("PUT /api/users/handle", api.HandleSetHandle)
+	mux.HandleFunc("DELETE /api/users", api.HandleDeleteUser)
+	mux.HandleFunc("GET /api/users/export", api.HandleExportUser)
+	mux.HandleFunc("GET /api/users/verify", api.HandleVerifyEmail)
+	mux.HandleFunc("GET /api/users/{userId}/mentions", api.HandleGetUserMentions)
 	mux.HandleFunc("POST /api/login", api.HandleLogin)
+	mux.HandleFunc("POST /api/login/mfa", api.HandleLoginMFA)
+	mux.HandleFunc("POST /api/login/magic", api.HandleMagicLink)
+	mux.HandleFunc("GET /api/login/magic/callback", api.HandleMagicLinkPage)
+	mux.HandleFunc("POST /api/login/magic/callback", api.HandleMagicLinkCallback)
+	mux.HandleFunc("POST /api/users/totp", api.HandleEnrollTOTP)
+	mux.HandleFunc("POST /api/users/totp/confirm", api.HandleConfirmTOTP)
+	mux.HandleFunc("DELETE /api/users/totp", api.HandleDisableTOTP)
 	mux.HandleFunc("POST /api/refresh", api.HandleRefresh)
 	mux.HandleFunc("POST /api/revoke", api.HandleRevoke)
+	mux.HandleFunc("POST /api/password-reset", api.HandlePasswordReset)
+	mux.HandleFunc("POST /api/password-reset/confirm", api.HandlePasswordResetConfirm)
 	mux.HandleFunc("POST /api/polka/webhooks", api.HandleWebHook)
-	mux.HandleFunc("GET /admin/metrics", api.CountHandler)
+	mux.HandleFunc("GET /api/sessions", api.HandleListSessions)
+	mux.HandleFunc("DELETE /api/sessions/{sessionId}", api.HandleDeleteSession)
+	mux.HandleFunc("POST /api/logout-all", api.HandleLogoutAll)
+	mux.HandleFunc("POST /api/tokens", api.HandleCreateToken)
+	mux.HandleFunc("GET /api/tokens", api.HandleListTokens)
+	mux.HandleFunc("DELETE /api/tokens/{tokenId}", api.HandleRevokeToken)
+	mux.HandleFunc("POST /api/oauth/clients", api.HandleCreateOAuthClient)
+	mux.HandleFunc("GET /api/oauth/clients", api.HandleListOAuthClients)
+	mux.HandleFunc("DELETE /api/oauth/clients/{clientId}", api.HandleDeleteOAuthClient)
+	mux.HandleFunc("GET /oauth/authorize", api.HandleAuthorize)
+	mux.HandleFunc("POST /oauth/authorize", api.HandleAuthorizeConsent)
+	mux.HandleFunc("POST /oauth/token", api.HandleToken)
+	mux.HandleFunc("POST /oauth/introspect", api.HandleIntrospect)
+	mux.HandleFunc("POST /oauth/revoke", api.HandleRevoke)
+	mux.Handle("GET /admin/metrics", api.MiddlewareRequireRole(auth.RoleAdmin, http.HandlerFunc(api.CountHandler)))
+	mux.Handle("GET /admin/audit-events", api.MiddlewareRequireRole(auth.RoleAdmin, http.HandlerFunc(api.HandleListAuditEvents)))
+	mux.Handle("PUT /admin/users/{userId}/role", api.MiddlewareRequireRole(auth.RoleAdmin, http.HandlerFunc(api.HandleSetUserRole)))
+	mux.HandleFunc("PUT /api/chirps/{chirpId}", api.HandleEditChirp)
 	mux.HandleFunc("DELETE /api/chirps/{chirpId}", api.HandleDeleteChirp)
 
 	log.Println("listening on port:", serv.Addr[1:])
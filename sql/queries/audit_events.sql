@@ -0,0 +1,16 @@
+-- name: CreateAuditEvent :exec
+INSERT INTO audit_events(actor_id, action, target_type, target_id, ip, user_agent, payload) VALUES (
+    $1, $2, $3, $4, $5, $6, $7
+);
+
+-- name: ListAuditEvents :many
+SELECT * from audit_events
+WHERE (sqlc.narg('actor_id')::uuid IS NULL OR actor_id = sqlc.narg('actor_id'))
+    AND (sqlc.narg('action')::text IS NULL OR action = sqlc.narg('action'))
+    AND (sqlc.narg('target_type')::text IS NULL OR target_type = sqlc.narg('target_type'))
+    AND (sqlc.narg('target_id')::text IS NULL OR target_id = sqlc.narg('target_id'))
+    AND (sqlc.narg('since')::timestamp IS NULL OR created_at >= sqlc.narg('since'))
+    AND (sqlc.narg('until')::timestamp IS NULL OR created_at < sqlc.narg('until'))
+    AND (sqlc.narg('before_id')::bigint IS NULL OR id < sqlc.narg('before_id'))
+ORDER BY id DESC
+LIMIT sqlc.arg('limit');
@@ -0,0 +1,19 @@
+-- name: CreateChirpTag :exec
+INSERT INTO chirp_tags (chirp_id, tag, start_offset, end_offset) VALUES ($1, $2, $3, $4);
+
+-- name: CreateChirpMention :exec
+INSERT INTO chirp_mentions (chirp_id, user_id, start_offset, end_offset) VALUES ($1, $2, $3, $4);
+
+-- name: DeleteChirpEntities :exec
+WITH deleted_tags AS (
+    DELETE FROM chirp_tags WHERE chirp_tags.chirp_id = $1
+)
+DELETE FROM chirp_mentions WHERE chirp_mentions.chirp_id = $1;
+
+-- name: ListChirpTags :many
+SELECT * FROM chirp_tags WHERE chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[])
+ORDER BY chirp_id, start_offset;
+
+-- name: ListChirpMentions :many
+SELECT * FROM chirp_mentions WHERE chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[])
+ORDER BY chirp_id, start_offset;
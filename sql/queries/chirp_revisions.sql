@@ -0,0 +1,8 @@
+-- name: CreateChirpRevision :exec
+INSERT INTO chirp_revisions (id, chirp_id, body, created_at, replaced_at) VALUES (
+    gen_random_uuid (), $1, $2, $3, NOW()
+);
+
+-- name: ListChirpRevisions :many
+SELECT * FROM chirp_revisions WHERE chirp_id = $1
+ORDER BY replaced_at DESC;
@@ -1,23 +1,153 @@
 -- name: CreateChirp :one
-INSERT INTO chirps(id, created_at, updated_at, body, user_id) VALUES (
+INSERT INTO chirps(id, created_at, updated_at, body, user_id, in_reply_to_id, quote_of_id, status, publish_at) VALUES (
+    gen_random_uuid (), NOW(), NOW(), $1, $2, $3, $4, $5, $6
+)
+returning *;
+
+-- name: ListChirps :many
+SELECT * from chirps
+WHERE status = 'published'
+    AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+    AND (sqlc.narg('tag')::text IS NULL
+        OR id IN (SELECT chirp_id FROM chirp_tags WHERE tag = sqlc.narg('tag')))
+    AND (sqlc.narg('mentioned_user_id')::uuid IS NULL
+        OR id IN (SELECT chirp_id FROM chirp_mentions WHERE user_id = sqlc.narg('mentioned_user_id')))
+    AND (sqlc.narg('after_created_at')::timestamp IS NULL
+        OR (created_at, id) > (sqlc.narg('after_created_at'), sqlc.narg('after_id')::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListChirpsDESC :many
+SELECT * from chirps
+WHERE status = 'published'
+    AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+    AND (sqlc.narg('tag')::text IS NULL
+        OR id IN (SELECT chirp_id FROM chirp_tags WHERE tag = sqlc.narg('tag')))
+    AND (sqlc.narg('mentioned_user_id')::uuid IS NULL
+        OR id IN (SELECT chirp_id FROM chirp_mentions WHERE user_id = sqlc.narg('mentioned_user_id')))
+    AND (sqlc.narg('before_created_at')::timestamp IS NULL
+        OR (created_at, id) < (sqlc.narg('before_created_at'), sqlc.narg('before_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: SearchChirps :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to_id, rechirp_of_id, quote_of_id, status, publish_at, rank,
+    ts_headline('english', body, to_tsquery('english', sqlc.arg('query')), sqlc.arg('headline_options')::text) AS headline
+FROM (
+    SELECT chirps.*, ts_rank(search_vector, to_tsquery('english', sqlc.arg('query')))::real AS rank
+    FROM chirps
+    WHERE search_vector @@ to_tsquery('english', sqlc.arg('query'))
+        AND status = 'published'
+        AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id'))
+) AS matches
+WHERE sqlc.narg('before_rank')::real IS NULL
+    OR (rank, created_at, id) < (sqlc.narg('before_rank'), sqlc.narg('before_created_at')::timestamp, sqlc.narg('before_id')::uuid)
+ORDER BY rank DESC, created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: ListChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT chirps.*, 1 AS depth FROM chirps
+    WHERE id = (SELECT in_reply_to_id FROM chirps WHERE chirps.id = sqlc.arg('chirp_id'))
+    UNION ALL
+    SELECT chirps.*, ancestors.depth + 1 FROM chirps
+    JOIN ancestors ON chirps.id = ancestors.in_reply_to_id
+    WHERE ancestors.depth < sqlc.arg('max_depth')::int
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to_id, rechirp_of_id, quote_of_id, status, publish_at, search_vector FROM ancestors
+ORDER BY depth DESC;
+
+-- name: ListChirpReplies :many
+-- replies are walked depth first, each chirp's replies oldest first; path
+-- sorts that way since every element has the same width. Pages start after
+-- a path rather than a reply, which may have been deleted since.
+WITH RECURSIVE tree AS (
+    SELECT chirps.*, 1 AS depth,
+        ARRAY[to_char(created_at, 'YYYYMMDDHH24MISSUS') || id::text] AS path
+    FROM chirps WHERE in_reply_to_id = sqlc.arg('chirp_id') AND status = 'published'
+    UNION ALL
+    SELECT chirps.*, tree.depth + 1,
+        tree.path || (to_char(chirps.created_at, 'YYYYMMDDHH24MISSUS') || chirps.id::text)
+    FROM chirps JOIN tree ON chirps.in_reply_to_id = tree.id
+    WHERE tree.depth < sqlc.arg('max_depth')::int AND chirps.status = 'published'
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to_id, rechirp_of_id, quote_of_id, status, publish_at, depth, path::text[] FROM tree
+WHERE sqlc.narg('after_path')::text[] IS NULL OR path > sqlc.narg('after_path')::text[]
+ORDER BY path
+LIMIT sqlc.arg('limit');
+
+-- name: CountChirpReplies :many
+SELECT in_reply_to_id, count(*) AS replies FROM chirps
+WHERE in_reply_to_id = ANY(sqlc.arg('chirp_ids')::uuid[]) AND status = 'published'
+GROUP BY in_reply_to_id;
+
+-- name: CreateRechirp :one
+INSERT INTO chirps(id, created_at, updated_at, user_id, rechirp_of_id) VALUES (
     gen_random_uuid (), NOW(), NOW(), $1, $2
 )
+ON CONFLICT (user_id, rechirp_of_id) WHERE rechirp_of_id IS NOT NULL DO NOTHING
 returning *;
 
--- name: GetChirps :many
-SELECT * from chirps ORDER BY created_at ASC;
+-- name: GetRechirp :one
+SELECT * from chirps WHERE user_id = $1 AND rechirp_of_id = $2;
+
+-- name: DeleteRechirp :execrows
+DELETE FROM chirps WHERE user_id = $1 AND rechirp_of_id = $2;
 
--- name: GetChirpsDESC :many
-SELECT * from chirps ORDER BY created_at DESC;
+-- name: GetChirpsByIDs :many
+SELECT * from chirps WHERE id = ANY(sqlc.arg('ids')::uuid[]);
 
 -- name: GetChirp :one
 SELECT * from chirps WHERE id = $1;
 
--- name: GetChirpsByAuthorId :many
-SELECT * from chirps WHERE user_id = $1 ORDER BY created_at ASC;
+-- name: GetPublishedChirp :one
+SELECT * from chirps WHERE id = $1 AND status = 'published';
+
+-- name: GetChirpForUpdate :one
+SELECT * from chirps WHERE id = $1 FOR UPDATE;
 
--- name: GetChirpsByAuthorIdDESC :many
-SELECT * from chirps WHERE user_id = $1 ORDER BY created_at DESC;
+-- name: IsChirpEditable :one
+-- created_at has no time zone, so the edit window is measured with the
+-- clock that wrote it
+SELECT COALESCE(created_at > NOW() - make_interval(secs => sqlc.arg('window_seconds')::float8), false) AS editable
+FROM chirps WHERE id = sqlc.arg('id');
+
+-- name: UpdateChirpBody :one
+UPDATE chirps SET body = $2, updated_at = NOW() WHERE id = $1
+returning *;
 
 -- name: DeleteChirp :exec
 DELETE FROM chirps WHERE id = $1;
+
+-- name: ListUserDrafts :many
+SELECT * from chirps WHERE user_id = $1 AND status <> 'published'
+ORDER BY publish_at NULLS LAST, created_at DESC;
+
+-- name: GetDraftForUpdate :one
+SELECT * from chirps WHERE id = $1 AND user_id = $2 AND status <> 'published'
+FOR UPDATE;
+
+-- name: UpdateDraft :one
+UPDATE chirps SET body = $2, status = $3, publish_at = $4, updated_at = NOW() WHERE id = $1
+returning *;
+
+-- name: DeleteDraft :execrows
+DELETE FROM chirps WHERE id = $1 AND user_id = $2 AND status <> 'published';
+
+-- name: PublishDraft :one
+UPDATE chirps SET status = 'published', publish_at = NULL, created_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND user_id = $2 AND status <> 'published'
+returning *;
+
+-- name: PublishDueChirps :many
+-- SKIP LOCKED lets several servers share the work without publishing a
+-- chirp twice: a row one of them locked is left to it
+UPDATE chirps SET status = 'published', created_at = NOW(), updated_at = NOW()
+WHERE status = 'scheduled' AND id IN (
+    SELECT id FROM chirps
+    WHERE status = 'scheduled' AND publish_at <= NOW()
+    ORDER BY publish_at
+    LIMIT sqlc.arg('limit')
+    FOR UPDATE SKIP LOCKED
+)
+returning *;
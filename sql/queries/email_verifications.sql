@@ -0,0 +1,10 @@
+-- name: CreateEmailVerification :one
+INSERT INTO email_verifications(id, token_hash, user_id, email, created_at, expires_at) VALUES (
+    gen_random_uuid (), $1, $2, $3, NOW(), $4
+)
+returning *;
+
+-- name: UseEmailVerification :one
+UPDATE email_verifications SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+returning *;
@@ -0,0 +1,21 @@
+-- name: RecordLoginFailure :one
+INSERT INTO login_attempts(key, failures, last_failure_at) VALUES (
+    $1, 1, $2
+)
+ON CONFLICT (key) DO UPDATE SET
+    failures = CASE WHEN login_attempts.failures = 0 OR login_attempts.last_failure_at < sqlc.arg(window_start) THEN 1 ELSE login_attempts.failures + 1 END,
+    previous_failure_at = CASE WHEN login_attempts.failures = 0 OR login_attempts.last_failure_at < sqlc.arg(window_start) THEN NULL ELSE login_attempts.last_failure_at END,
+    last_failure_at = EXCLUDED.last_failure_at
+returning *;
+
+-- name: ReleaseLoginAttempt :exec
+UPDATE login_attempts SET failures = failures - 1 WHERE key = $1 AND failures > 0;
+
+-- name: WithdrawLoginAttempt :exec
+UPDATE login_attempts SET
+    failures = failures - 1,
+    last_failure_at = LEAST(last_failure_at, sqlc.arg(previous_failure_at)::timestamptz)
+WHERE key = sqlc.arg(key) AND failures > 0;
+
+-- name: ResetLoginAttempts :exec
+DELETE FROM login_attempts WHERE key = $1;
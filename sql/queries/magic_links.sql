@@ -0,0 +1,10 @@
+-- name: CreateMagicLink :one
+INSERT INTO magic_links(id, token_hash, user_id, email, created_at, expires_at) VALUES (
+    gen_random_uuid (), $1, $2, $3, NOW(), $4
+)
+returning *;
+
+-- name: UseMagicLink :one
+UPDATE magic_links SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+returning *;
@@ -0,0 +1,22 @@
+-- name: CreateMediaFile :one
+INSERT INTO media_files (id, user_id, content_type, size_bytes, width, height, storage_key, thumbnail_key, thumbnail_content_type, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW())
+RETURNING *;
+
+-- name: GetMediaFile :one
+SELECT * FROM media_files WHERE id = $1;
+
+-- name: GetMediaFilesByIDs :many
+SELECT * FROM media_files WHERE id = ANY(sqlc.arg('ids')::uuid[]);
+
+-- name: ListUserMediaFiles :many
+SELECT * FROM media_files WHERE user_id = $1;
+
+-- name: CreateChirpMediaFile :exec
+INSERT INTO chirp_media_files (chirp_id, media_id, position) VALUES ($1, $2, $3);
+
+-- name: ListChirpMediaFiles :many
+SELECT chirp_media_files.chirp_id, media_files.* FROM chirp_media_files
+JOIN media_files ON media_files.id = chirp_media_files.media_id
+WHERE chirp_media_files.chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[])
+ORDER BY chirp_media_files.chirp_id, chirp_media_files.position;
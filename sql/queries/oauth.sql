@@ -0,0 +1,30 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients(id, owner_id, name, secret_hash, redirect_uris, created_at) VALUES (
+    gen_random_uuid (), $1, $2, $3, $4, NOW()
+)
+returning *;
+
+-- name: GetOAuthClient :one
+SELECT * from oauth_clients WHERE id = $1;
+
+-- name: ListOAuthClients :many
+SELECT * from oauth_clients WHERE owner_id = $1 ORDER BY created_at DESC;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients WHERE id = $1 AND owner_id = $2;
+
+-- name: CreateAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes(code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, created_at, expires_at, redirect_uri_provided) VALUES (
+    $1, $2, $3, $4, $5, $6, NOW(), $7, $8
+);
+
+-- name: GetAuthorizationCode :one
+SELECT * from oauth_authorization_codes WHERE code_hash = $1;
+
+-- name: UseAuthorizationCode :one
+UPDATE oauth_authorization_codes SET used_at = NOW()
+WHERE code_hash = $1 AND client_id = $2 AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: SetAuthorizationCodeSession :exec
+UPDATE oauth_authorization_codes SET session_id = $2 WHERE code_hash = $1;
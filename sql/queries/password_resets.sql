@@ -0,0 +1,13 @@
+-- name: CreatePasswordReset :one
+INSERT INTO password_resets(id, token_hash, user_id, created_at, expires_at) VALUES (
+    gen_random_uuid (), $1, $2, NOW(), $3
+)
+returning *;
+
+-- name: UsePasswordReset :one
+UPDATE password_resets SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+returning *;
+
+-- name: InvalidatePasswordResets :exec
+UPDATE password_resets SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL;
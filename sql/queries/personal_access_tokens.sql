@@ -0,0 +1,17 @@
+-- name: CreatePersonalAccessToken :one
+INSERT INTO personal_access_tokens(id, user_id, name, token_hash, scopes, created_at, expires_at) VALUES (
+    gen_random_uuid (), $1, $2, $3, $4, NOW(), $5
+)
+returning *;
+
+-- name: GetPersonalAccessTokenByHash :one
+SELECT * from personal_access_tokens WHERE token_hash = $1;
+
+-- name: ListPersonalAccessTokens :many
+SELECT * from personal_access_tokens WHERE user_id = $1 AND revoked_at IS NULL ORDER BY created_at DESC;
+
+-- name: RevokePersonalAccessToken :execrows
+UPDATE personal_access_tokens SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: TouchPersonalAccessToken :exec
+UPDATE personal_access_tokens SET last_used_at = NOW() WHERE id = $1;
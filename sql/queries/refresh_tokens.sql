@@ -1,6 +1,6 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens(token, created_at, updated_at, user_id, expires_at, revoked_at) VALUES (
-    $1, NOW(), NOW(), $2, $3, NULL
+INSERT INTO refresh_tokens(token, created_at, updated_at, user_id, expires_at, revoked_at, family_id) VALUES (
+    $1, NOW(), NOW(), $2, $3, NULL, $4
 )
 returning *;
 
@@ -10,3 +10,18 @@ SELECT * from refresh_tokens WHERE token = $1;
 
 -- name: UpdateRefreshToken :exec
 UPDATE refresh_tokens SET updated_at = $2, revoked_at = $3 WHERE token = $1;
+
+-- name: RotateRefreshToken :execrows
+UPDATE refresh_tokens SET updated_at = NOW(), revoked_at = NOW(), replaced_by = $2
+WHERE token = $1 AND revoked_at IS NULL;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens SET updated_at = NOW(), revoked_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens SET updated_at = NOW(), revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: DeleteUserRefreshTokens :exec
+DELETE FROM refresh_tokens WHERE user_id = $1;
@@ -0,0 +1,27 @@
+-- name: CreateSession :one
+INSERT INTO sessions(id, user_id, user_agent, ip, created_at, last_used_at, client_id, scopes) VALUES (
+    gen_random_uuid (), $1, $2, $3, NOW(), NOW(), $4, $5
+)
+returning *;
+
+-- name: GetSession :one
+SELECT * from sessions WHERE id = $1;
+
+-- name: ListActiveSessions :many
+SELECT * from sessions WHERE user_id = $1 AND revoked_at IS NULL AND last_used_at > $2
+ORDER BY last_used_at DESC;
+
+-- name: IsSessionActive :one
+SELECT EXISTS (SELECT 1 FROM sessions WHERE id = $1 AND revoked_at IS NULL);
+
+-- name: TouchSession :exec
+UPDATE sessions SET last_used_at = NOW(), user_agent = $2, ip = $3 WHERE id = $1;
+
+-- name: RevokeSession :exec
+UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeUserSessions :exec
+UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: ListSessions :many
+SELECT * from sessions WHERE user_id = $1 ORDER BY created_at DESC;
@@ -0,0 +1,17 @@
+-- name: CreateSigningKey :one
+INSERT INTO signing_keys(kid, created_at, algorithm, private_key, active_at) VALUES (
+    $1, $2, $3, $4, $5
+)
+returning *;
+
+-- name: GetSigningKeys :many
+SELECT * from signing_keys WHERE retired_at IS NULL OR retired_at > $1 ORDER BY created_at DESC;
+
+-- name: RetireSigningKeys :exec
+UPDATE signing_keys SET retired_at = $2 WHERE retired_at IS NULL AND kid <> $1;
+
+-- name: DeleteRetiredSigningKeys :exec
+DELETE FROM signing_keys WHERE retired_at < $1;
+
+-- name: LockSigningKeys :exec
+SELECT pg_advisory_xact_lock(hashtext('signing_keys'));
@@ -8,10 +8,40 @@ RETURNING *;
 -- name: GetUser :one
 SELECT * from users WHERE email=$1;
 
+-- name: GetUserByID :one
+SELECT * from users WHERE id=$1;
+
+-- name: GetUsersByHandles :many
+SELECT id, handle from users WHERE lower(handle) = ANY(sqlc.arg('handles')::text[]);
+
 -- name: UpdateUser :one
-UPDATE users SET email = $2, hashed_password = $3, updated_at = NOW() WHERE id = $1
-RETURNING id, email, created_at, updated_at;
+UPDATE users SET email = $2, hashed_password = $3, updated_at = NOW(),
+    verified_at = CASE WHEN email = $2 THEN verified_at ELSE NULL END
+WHERE id = $1
+RETURNING id, email, created_at, updated_at, is_chirpy_red, verified_at, role, handle;
+
+-- name: SetUserHandle :one
+UPDATE users SET handle = $2, updated_at = NOW() WHERE id = $1
+RETURNING *;
 
 
 -- name: UpgradeUserMembership :exec
 UPDATE users SET is_chirpy_red = true, updated_at = NOW() WHERE id = $1;
+
+-- name: UpdateUserPassword :exec
+UPDATE users SET hashed_password = $2, updated_at = NOW() WHERE id = $1;
+
+-- name: MarkUserVerified :execrows
+UPDATE users SET verified_at = NOW(), updated_at = NOW() WHERE id = $1 AND email = $2;
+
+
+-- name: SetUserRole :execrows
+UPDATE users SET role = $2, updated_at = NOW() WHERE id = $1;
+
+-- name: SetUserRoleByEmail :execrows
+-- only verified addresses, or whoever signs up first with one would get it
+UPDATE users SET role = $2, updated_at = NOW()
+WHERE email = $1 AND verified_at IS NOT NULL AND role <> $2;
+
+-- name: DeleteUser :execrows
+DELETE FROM users WHERE id = $1;
@@ -0,0 +1,19 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN verified_at TIMESTAMP;
+
+CREATE TABLE email_verifications (
+    id UUID PRIMARY KEY,
+    token_hash TEXT NOT NULL UNIQUE,
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE email_verifications;
+
+ALTER TABLE users
+DROP COLUMN verified_at;
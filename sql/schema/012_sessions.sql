@@ -0,0 +1,35 @@
+-- +goose Up
+CREATE TABLE sessions (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
+
+-- every refresh token family becomes a session
+INSERT INTO sessions (id, user_id, created_at, last_used_at, revoked_at)
+SELECT family_id, user_id,
+    COALESCE(MIN(created_at), NOW()),
+    COALESCE(MAX(updated_at), NOW()),
+    CASE WHEN bool_and(revoked_at IS NOT NULL) THEN MAX(revoked_at) END
+FROM refresh_tokens
+WHERE user_id IS NOT NULL
+GROUP BY family_id, user_id;
+
+DELETE FROM refresh_tokens WHERE user_id IS NULL;
+
+ALTER TABLE refresh_tokens
+ADD CONSTRAINT fk_sessions FOREIGN KEY (family_id) REFERENCES sessions (id) ON DELETE CASCADE,
+ALTER COLUMN family_id DROP DEFAULT;
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP CONSTRAINT fk_sessions,
+ALTER COLUMN family_id SET DEFAULT gen_random_uuid();
+
+DROP TABLE sessions;
@@ -0,0 +1,34 @@
+-- +goose Up
+-- actor_id and target_id are not foreign keys so events outlive what they
+-- refer to.
+CREATE TABLE audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    actor_id UUID,
+    action TEXT NOT NULL,
+    target_type TEXT,
+    target_id TEXT,
+    ip TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX audit_events_actor_id_idx ON audit_events (actor_id, id);
+CREATE INDEX audit_events_action_idx ON audit_events (action, id);
+CREATE INDEX audit_events_target_idx ON audit_events (target_type, target_id, id);
+
+-- +goose StatementBegin
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER audit_events_append_only
+BEFORE UPDATE OR DELETE ON audit_events
+FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+-- +goose Down
+DROP TABLE audit_events;
+DROP FUNCTION audit_events_append_only;
@@ -0,0 +1,40 @@
+-- +goose Up
+CREATE TABLE oauth_clients (
+    id UUID PRIMARY KEY,
+    owner_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    -- NULL for public clients, such as mobile apps, that can't keep a
+    -- secret and rely on PKCE alone
+    secret_hash TEXT,
+    redirect_uris TEXT[] NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX oauth_clients_owner_id_idx ON oauth_clients (owner_id);
+
+CREATE TABLE oauth_authorization_codes (
+    code_hash TEXT PRIMARY KEY,
+    client_id UUID NOT NULL REFERENCES oauth_clients ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT[] NOT NULL,
+    code_challenge TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    -- the session the code was exchanged for, revoked if the code is replayed
+    session_id UUID REFERENCES sessions ON DELETE SET NULL
+);
+
+-- sessions of OAuth clients are limited to scopes, those from login aren't
+ALTER TABLE sessions
+ADD COLUMN client_id UUID REFERENCES oauth_clients ON DELETE CASCADE,
+ADD COLUMN scopes TEXT[];
+
+-- +goose Down
+ALTER TABLE sessions
+DROP COLUMN client_id,
+DROP COLUMN scopes;
+
+DROP TABLE oauth_authorization_codes;
+DROP TABLE oauth_clients;
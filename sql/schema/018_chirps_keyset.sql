@@ -0,0 +1,8 @@
+-- +goose Up
+-- keyset pagination walks chirps in (created_at, id) order
+CREATE INDEX chirps_created_at_id_idx ON chirps (created_at, id);
+CREATE INDEX chirps_user_id_created_at_id_idx ON chirps (user_id, created_at, id);
+
+-- +goose Down
+DROP INDEX chirps_user_id_created_at_id_idx;
+DROP INDEX chirps_created_at_id_idx;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- an expression index rather than a generated column keeps the tsvector out
+-- of every SELECT * on chirps; queries must use the same expression
+CREATE INDEX chirps_body_search_idx ON chirps USING GIN (to_tsvector('english', body));
+
+-- +goose Down
+DROP INDEX chirps_body_search_idx;
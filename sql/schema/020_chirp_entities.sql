@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE chirp_tags (
+    chirp_id UUID NOT NULL REFERENCES chirps ON DELETE CASCADE,
+    tag TEXT NOT NULL,
+    start_offset INTEGER NOT NULL,
+    end_offset INTEGER NOT NULL,
+    PRIMARY KEY (chirp_id, start_offset)
+);
+
+CREATE INDEX chirp_tags_tag_idx ON chirp_tags (tag);
+
+CREATE TABLE chirp_mentions (
+    chirp_id UUID NOT NULL REFERENCES chirps ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    start_offset INTEGER NOT NULL,
+    end_offset INTEGER NOT NULL,
+    PRIMARY KEY (chirp_id, start_offset)
+);
+
+CREATE INDEX chirp_mentions_user_id_idx ON chirp_mentions (user_id);
+
+-- +goose Down
+DROP TABLE chirp_mentions;
+DROP TABLE chirp_tags;
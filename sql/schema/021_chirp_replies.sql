@@ -0,0 +1,8 @@
+-- +goose Up
+-- replies outlive a deleted parent and become top-level chirps
+ALTER TABLE chirps ADD COLUMN in_reply_to_id UUID REFERENCES chirps ON DELETE SET NULL;
+
+CREATE INDEX chirps_in_reply_to_id_idx ON chirps (in_reply_to_id);
+
+-- +goose Down
+ALTER TABLE chirps DROP COLUMN in_reply_to_id;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- a rechirp has nothing of its own and goes with the original; a quote
+-- keeps its body and loses the reference
+ALTER TABLE chirps
+    ADD COLUMN rechirp_of_id UUID REFERENCES chirps ON DELETE CASCADE,
+    ADD COLUMN quote_of_id UUID REFERENCES chirps ON DELETE SET NULL;
+
+CREATE UNIQUE INDEX chirps_user_id_rechirp_of_id_idx ON chirps (user_id, rechirp_of_id)
+    WHERE rechirp_of_id IS NOT NULL;
+CREATE INDEX chirps_quote_of_id_idx ON chirps (quote_of_id);
+
+-- +goose Down
+ALTER TABLE chirps DROP COLUMN quote_of_id, DROP COLUMN rechirp_of_id;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- the versions of a chirp that were replaced by an edit; the current one
+-- stays in chirps
+CREATE TABLE chirp_revisions (
+    id UUID PRIMARY KEY,
+    chirp_id UUID NOT NULL REFERENCES chirps ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    replaced_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX chirp_revisions_chirp_id_idx ON chirp_revisions (chirp_id, replaced_at);
+
+-- +goose Down
+DROP TABLE chirp_revisions;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- created_at is when a chirp was published, or saved for drafts; the
+-- scheduler moves it to the publication time
+ALTER TABLE chirps
+    ADD COLUMN status TEXT NOT NULL DEFAULT 'published'
+        CHECK (status IN ('draft', 'scheduled', 'published')),
+    ADD COLUMN publish_at TIMESTAMP,
+    ADD CONSTRAINT chirps_scheduled_publish_at CHECK (status <> 'scheduled' OR publish_at IS NOT NULL);
+
+CREATE INDEX chirps_scheduled_publish_at_idx ON chirps (publish_at) WHERE status = 'scheduled';
+CREATE INDEX chirps_user_id_unpublished_idx ON chirps (user_id) WHERE status <> 'published';
+
+-- +goose Down
+ALTER TABLE chirps DROP COLUMN publish_at, DROP COLUMN status;
@@ -0,0 +1,31 @@
+-- +goose Up
+-- blobs live in the configured BlobStore; rows keep where and what they are
+CREATE TABLE media_files (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+    content_type TEXT NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    storage_key TEXT NOT NULL,
+    thumbnail_key TEXT NOT NULL,
+    thumbnail_content_type TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX media_files_user_id_idx ON media_files (user_id);
+
+-- a chirp has up to 4 media, in order
+CREATE TABLE chirp_media_files (
+    chirp_id UUID NOT NULL REFERENCES chirps ON DELETE CASCADE,
+    media_id UUID NOT NULL REFERENCES media_files ON DELETE CASCADE,
+    position INT NOT NULL CHECK (position BETWEEN 0 AND 3),
+    PRIMARY KEY (chirp_id, position),
+    UNIQUE (chirp_id, media_id)
+);
+
+CREATE INDEX chirp_media_files_media_id_idx ON chirp_media_files (media_id);
+
+-- +goose Down
+DROP TABLE chirp_media_files;
+DROP TABLE media_files;
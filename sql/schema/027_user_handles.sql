@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN handle TEXT;
+CREATE UNIQUE INDEX users_handle_idx ON users (lower(handle));
+
+-- mentions used to be by email, which tied emails to users
+DELETE FROM chirp_mentions;
+
+-- +goose Down
+DROP INDEX users_handle_idx;
+ALTER TABLE users DROP COLUMN handle;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- times used to be the server's local time without a zone, which breaks
+-- when the server and the database disagree on it
+ALTER TABLE login_attempts
+ALTER COLUMN last_failure_at TYPE TIMESTAMPTZ USING last_failure_at AT TIME ZONE 'UTC',
+ADD COLUMN previous_failure_at TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE login_attempts
+DROP COLUMN previous_failure_at,
+ALTER COLUMN last_failure_at TYPE TIMESTAMP USING last_failure_at AT TIME ZONE 'UTC';
@@ -0,0 +1,7 @@
+-- +goose Up
+-- publish_at was written in UTC but compared with NOW() in the session's
+-- time zone, so scheduled chirps came out hours early or late
+ALTER TABLE chirps ALTER COLUMN publish_at TYPE TIMESTAMPTZ USING publish_at AT TIME ZONE 'UTC';
+
+-- +goose Down
+ALTER TABLE chirps ALTER COLUMN publish_at TYPE TIMESTAMP USING publish_at AT TIME ZONE 'UTC';
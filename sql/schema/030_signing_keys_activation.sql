@@ -0,0 +1,17 @@
+-- +goose Up
+-- a new key is published ahead of active_at so every server has loaded it
+-- before it signs anything; times are compared across servers, so they
+-- carry their zone
+ALTER TABLE signing_keys
+ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'UTC',
+ALTER COLUMN retired_at TYPE TIMESTAMPTZ USING retired_at AT TIME ZONE 'UTC',
+ADD COLUMN active_at TIMESTAMPTZ;
+
+UPDATE signing_keys SET active_at = created_at;
+ALTER TABLE signing_keys ALTER COLUMN active_at SET NOT NULL;
+
+-- +goose Down
+ALTER TABLE signing_keys
+DROP COLUMN active_at,
+ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE 'UTC',
+ALTER COLUMN retired_at TYPE TIMESTAMP USING retired_at AT TIME ZONE 'UTC';
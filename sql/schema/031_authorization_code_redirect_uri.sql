@@ -0,0 +1,7 @@
+-- +goose Up
+-- RFC 6749 4.1.3 only asks for redirect_uri at the token endpoint when the
+-- authorization request had one
+ALTER TABLE oauth_authorization_codes ADD COLUMN redirect_uri_provided BOOLEAN NOT NULL DEFAULT true;
+
+-- +goose Down
+ALTER TABLE oauth_authorization_codes DROP COLUMN redirect_uri_provided;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- searches read a stored tsvector instead of parsing every body again. It
+-- comes back with every SELECT * on chirps, which is acceptable as bodies
+-- are at most 140 bytes, which keeps their tsvectors small.
+DROP INDEX chirps_body_search_idx;
+ALTER TABLE chirps ADD COLUMN search_vector tsvector
+    GENERATED ALWAYS AS (to_tsvector('english', body)) STORED;
+CREATE INDEX chirps_search_vector_idx ON chirps USING GIN (search_vector);
+
+-- +goose Down
+DROP INDEX chirps_search_vector_idx;
+ALTER TABLE chirps DROP COLUMN search_vector;
+CREATE INDEX chirps_body_search_idx ON chirps USING GIN (to_tsvector('english', body));
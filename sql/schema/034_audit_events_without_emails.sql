@@ -0,0 +1,10 @@
+-- +goose Up
+-- events used to carry email addresses, which outlived deleted accounts.
+-- The append-only trigger is lifted just long enough to remove them.
+ALTER TABLE audit_events DISABLE TRIGGER audit_events_append_only;
+UPDATE audit_events SET payload = payload - 'email' - 'from' - 'to'
+WHERE action IN ('login.failed', 'user.email_changed', 'user.deleted');
+ALTER TABLE audit_events ENABLE TRIGGER audit_events_append_only;
+
+-- +goose Down
+-- the removed addresses can't be restored
@@ -40,3 +40,14 @@ func RespondWithError(w http.ResponseWriter, body map[string]string, status int)
 	w.WriteHeader(status)
 	w.Write(data)
 }
+
+func RespondWithJSON(w http.ResponseWriter, body any, status int) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}